@@ -10,7 +10,9 @@ import (
 	"github.com/pingcap/errors"
 
 	"github.com/amyangfei/data-dam/dam/central"
-	_ "github.com/amyangfei/data-dam/db/mysql" // Register MySQL database
+	_ "github.com/amyangfei/data-dam/db/mysql"    // Register MySQL database
+	_ "github.com/amyangfei/data-dam/db/postgres" // Register PostgreSQL database
+	_ "github.com/amyangfei/data-dam/db/sqlite"   // Register SQLite database
 	"github.com/amyangfei/data-dam/pkg/log"
 	"github.com/amyangfei/data-dam/pkg/utils"
 )
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"flag"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/BurntSushi/toml"
@@ -16,8 +17,23 @@ import (
 
 const (
 	defaultAppName string = "central controller"
+
+	// ModeGenerate generates random workload
+	ModeGenerate = "generate"
+	// ModeReplay replays recorded workload
+	ModeReplay = "replay"
+
+	replayFormatJSON = "json"
+	replayFormatSQL  = "sql"
 )
 
+// ReplayConfig is the configuration of replaying recorded workload
+type ReplayConfig struct {
+	File   string  `toml:"file" json:"file"`     // recorded DMLParams in JSON lines or SQL statements
+	Format string  `toml:"format" json:"format"` // json or sql, detected from file extension if not set
+	Speed  float64 `toml:"speed" json:"speed"`   // speed relative to the recorded time, 0 means replaying at `rate`
+}
+
 // Config is the configuration
 type Config struct {
 	flagSet *flag.FlagSet
@@ -27,13 +43,24 @@ type Config struct {
 
 	ConfigFile string `json:"config-file"`
 
-	Seconds    int64           `json:"-"`
-	Rate       int             `toml:"rate" json:"rate"`
-	Duration   string          `toml:"duration" json:"duration"`
-	Concurrent int             `toml:"concurrent" json:"concurrent"`
-	DBConfig   models.DBConfig `toml:"db-config" json:"db-config"`
-	OpWeight   []int           `toml:"op-weight" json:"op-weight"`
-	Schemas    []string        `toml:"schemas" json:"schemas"`
+	Seconds        int64            `json:"-"`
+	Rate           int              `toml:"rate" json:"rate"`
+	Duration       string           `toml:"duration" json:"duration"`
+	Concurrent     int              `toml:"concurrent" json:"concurrent"`
+	BatchSize      int              `toml:"batch-size" json:"batch-size"`
+	Coalesce       bool             `toml:"coalesce" json:"coalesce"`
+	DBConfig       models.DBConfig  `toml:"db-config" json:"db-config"`
+	OpWeight       []int            `toml:"op-weight" json:"op-weight"`
+	Schemas        []string         `toml:"schemas" json:"schemas"`
+	Mode           string           `toml:"mode" json:"mode"`
+	Journal        string           `toml:"journal" json:"journal"`
+	StatusAddr     string           `toml:"status-addr" json:"status-addr"`
+	SummaryFile    string           `toml:"summary-file" json:"summary-file"`
+	ReportInterval int              `toml:"report-interval" json:"report-interval"`
+	RateProfile    RateProfile      `toml:"rate-profile" json:"rate-profile"`
+	Phases         []*Phase         `toml:"phase" json:"phase"`
+	Replay         ReplayConfig     `toml:"replay" json:"replay"`
+	Txn            models.TxnConfig `toml:"txn" json:"txn"`
 
 	printVersion bool
 }
@@ -51,6 +78,17 @@ func NewConfig() *Config {
 	fs.IntVar(&cfg.Rate, "rate", 5, "number of requests per time unit (5/1s)")
 	fs.StringVar(&cfg.Duration, "duration", "10s", "test duration (0 = forever)")
 	fs.IntVar(&cfg.Concurrent, "concurrent", 10, "concurrent for database")
+	fs.IntVar(&cfg.BatchSize, "batch-size", 3, "number of jobs executed together by a worker")
+	fs.BoolVar(&cfg.Coalesce, "coalesce", false, "coalesce consecutive inserts and deletes of the same table into one statement")
+	fs.StringVar(&cfg.Mode, "mode", ModeGenerate, "run mode: generate, replay")
+	fs.StringVar(&cfg.Replay.File, "replay-file", "", "recorded workload file to replay, DMLParams in JSON lines or SQL statements")
+	fs.Float64Var(&cfg.Replay.Speed, "replay-speed", 1, "replay speed relative to the recorded time, 0 means replaying at rate")
+	fs.StringVar(&cfg.StatusAddr, "status-addr", "", "address of HTTP status server exposing /metrics, empty means disabled")
+	fs.IntVar(&cfg.ReportInterval, "report-interval", 10, "interval in seconds to report progress, 0 means disabled")
+	fs.StringVar(&cfg.SummaryFile, "summary-file", "", "path to write the end-of-run summary in JSON, empty means only printing it")
+	fs.StringVar(&cfg.Journal, "journal", "", "path of JSON lines journal recording every executed job, empty means no journal")
+	fs.Int64Var(&cfg.DBConfig.Seed, "seed", 0, "seed of random workload, the same seed and config generate the same operations, 0 means a time based seed")
+	fs.StringVar(&cfg.DBConfig.Type, "db-type", "", "database type, available types are the registered database names, such as mysql, postgres, sqlite")
 
 	return cfg
 }
@@ -96,15 +134,88 @@ func (c *Config) veirfy() error {
 	}
 	c.Seconds = int64(d.Seconds())
 
-	// TODO: currently support MySQL only, add more database support later
-	if !c.DBConfig.MySQL.Enabled {
-		return errors.New("support MySQL/MariaDB only")
+	switch c.Mode {
+	case ModeGenerate:
+	case ModeReplay:
+		err = c.Replay.adjust()
+		if err != nil {
+			return errors.Trace(err)
+		}
+	default:
+		return errors.NotValidf("mode %s", c.Mode)
+	}
+
+	err = c.RateProfile.adjust()
+	if err != nil {
+		return errors.Trace(err)
 	}
 
-	if len(c.OpWeight) != len(models.RealOpType) {
+	if c.BatchSize <= 0 {
+		return errors.NotValidf("batch-size %d", c.BatchSize)
+	}
+
+	if c.ReportInterval < 0 {
+		return errors.NotValidf("report-interval %d", c.ReportInterval)
+	}
+
+	err = c.DBConfig.Adjust()
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	err = c.Txn.Adjust()
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if c.Txn.Size > 0 && c.DBConfig.SQLFile.Path != "" {
+		return errors.NotSupportedf("txn with sql-file output, use txn-size of sql-file instead")
+	}
+
+	_, err = models.ParseDDLTypes(c.DBConfig.DDLTypes)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	if len(c.OpWeight) == 0 {
 		c.OpWeight = models.DefaultOpWeiht
 	}
+	c.OpWeight, err = normalizeOpWeight(c.OpWeight)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	if c.Mode == ModeGenerate {
+		err = c.adjustPhases()
+		if err != nil {
+			return errors.Trace(err)
+		}
+		for _, p := range c.Phases {
+			err = checkSQLFileOpWeight(&c.DBConfig, p.OpWeight)
+			if err != nil {
+				return errors.Annotatef(err, "phase %s", p.Name)
+			}
+		}
+	}
+
+	return nil
+}
 
+func (c *ReplayConfig) adjust() error {
+	if c.File == "" {
+		return errors.New("replay file is not set")
+	}
+	if c.Format == "" {
+		c.Format = replayFormatJSON
+		if strings.HasSuffix(strings.ToLower(c.File), ".sql") {
+			c.Format = replayFormatSQL
+		}
+	}
+	if c.Format != replayFormatJSON && c.Format != replayFormatSQL {
+		return errors.NotValidf("replay format %s", c.Format)
+	}
+	if c.Speed < 0 {
+		return errors.NotValidf("replay speed %f", c.Speed)
+	}
 	return nil
 }
 
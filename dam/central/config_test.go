@@ -0,0 +1,83 @@
+package central
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/amyangfei/data-dam/pkg/models"
+)
+
+func TestConfigDBType(t *testing.T) {
+	cfg := NewConfig()
+	cfg.DBConfig.SQLite.Enabled = true
+	require.NoError(t, cfg.veirfy())
+	assert.Equal(t, "sqlite", cfg.DBConfig.Type)
+
+	cfg = NewConfig()
+	cfg.DBConfig.Type = "SQLite"
+	require.NoError(t, cfg.veirfy())
+	assert.Equal(t, "sqlite", cfg.DBConfig.Type)
+
+	cfg = NewConfig()
+	cfg.DBConfig.MySQL.Enabled = true
+	cfg.DBConfig.SQLite.Enabled = true
+	assert.Error(t, cfg.veirfy())
+
+	cfg = NewConfig()
+	cfg.DBConfig.Type = "oracle"
+	err := cfg.veirfy()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "available types: sqlite")
+}
+
+func TestConfigTxn(t *testing.T) {
+	cfg := NewConfig()
+	cfg.DBConfig.Type = "sqlite"
+	cfg.Txn = models.TxnConfig{Size: 4, RollbackRatio: 0.5}
+	require.NoError(t, cfg.veirfy())
+
+	cfg.Txn.RollbackRatio = 1.5
+	assert.Error(t, cfg.veirfy())
+
+	cfg.Txn.RollbackRatio = 0.5
+	cfg.DBConfig.SQLFile.Path = "dam.sql"
+	err := cfg.veirfy()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "txn with sql-file")
+}
+
+func TestConfigUpsertHitRatio(t *testing.T) {
+	cfg := NewConfig()
+	cfg.DBConfig.Type = "sqlite"
+	require.NoError(t, cfg.veirfy())
+	assert.Equal(t, 0.5, *cfg.DBConfig.UpsertHitRatio)
+
+	// 0 is kept, no statement hits live keys
+	ratio := 0.0
+	cfg.DBConfig.UpsertHitRatio = &ratio
+	require.NoError(t, cfg.veirfy())
+	assert.Equal(t, 0.0, *cfg.DBConfig.UpsertHitRatio)
+
+	ratio = 1.5
+	assert.Error(t, cfg.veirfy())
+}
+
+func TestConfigSQLFileDDL(t *testing.T) {
+	cfg := NewConfig()
+	cfg.DBConfig.Type = "sqlite"
+	cfg.DBConfig.SQLFile.Path = "dam.sql"
+	cfg.OpWeight = []int{1, 1, 1, 1}
+	assert.Error(t, cfg.veirfy())
+
+	// DDL only in a phase is rejected too
+	cfg = NewConfig()
+	cfg.DBConfig.Type = "sqlite"
+	cfg.DBConfig.SQLFile.Path = "dam.sql"
+	cfg.OpWeight = []int{1, 1, 1}
+	require.NoError(t, cfg.veirfy())
+	ratio := 0.1
+	cfg.Phases = []*Phase{{Name: "ddl", DDLRatio: &ratio}}
+	assert.Error(t, cfg.veirfy())
+}
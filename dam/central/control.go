@@ -2,6 +2,8 @@ package central
 
 import (
 	"context"
+	"net/http"
+	"os"
 	"sync"
 	"time"
 
@@ -12,10 +14,6 @@ import (
 	"github.com/amyangfei/data-dam/pkg/models"
 )
 
-var (
-	backendBatchSize = 3
-)
-
 // RunError collects errors from sub goroutine
 type RunError struct {
 	source string
@@ -31,7 +29,14 @@ type Controller struct {
 	cfg *Config
 
 	closed       sync2.AtomicBool
+	rateChanged  sync2.AtomicBool // rate is changed by control API
 	runErrorChan chan *RunError
+	statusServer *http.Server
+	summary      *Summary
+
+	generator  *Generator // running generator, protected by the embedded Mutex
+	phase      *Phase     // running phase, protected by the embedded Mutex
+	dispatcher *models.JobDispatcher
 }
 
 // NewController returns a new central controller for data flow
@@ -48,8 +53,9 @@ func NewController(cfg *Config) *Controller {
 func (c *Controller) Start() error {
 	c.closed.Set(false)
 
-	// if c.cfg.Seconds = 0, runs forever until context is Done
-	if c.cfg.Seconds > 0 {
+	// generator stops after all phases finish, replayer stops at the end of file or
+	// after duration. if c.cfg.Seconds = 0, replayer runs until context is Done
+	if c.cfg.Mode == ModeReplay && c.cfg.Seconds > 0 {
 		go func() {
 			select {
 			case <-c.ctx.Done():
@@ -80,38 +86,127 @@ func (c *Controller) Start() error {
 		}
 	}()
 
-	creator := models.GetDBCreator("mysql")
-	dispatcher, err := models.NewJobDispatcher(c.ctx, c.cfg.Concurrent, backendBatchSize, &c.cfg.DBConfig, creator)
+	creator := models.GetDBCreator(c.cfg.DBConfig.Type)
+	dispatcher, err := models.NewJobDispatcher(c.ctx, c.cfg.Concurrent, c.cfg.BatchSize, &c.cfg.DBConfig, creator)
 	if err != nil {
 		return errors.Trace(err)
 	}
+	dispatcher.Txn = c.cfg.Txn
+	dispatcher.Coalesce = c.cfg.Coalesce
+	c.dispatcher = dispatcher
+	if c.cfg.StatusAddr != "" {
+		err = c.startStatusServer()
+		if err != nil {
+			return errors.Trace(err)
+		}
+		defer c.stopStatusServer()
+	}
+	if c.cfg.Journal != "" {
+		dispatcher.Journal, err = models.NewJournal(c.cfg.Journal)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		defer dispatcher.Journal.Close()
+	}
 
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		generator, err := NewGenerator(c.cfg, dispatcher)
-		if err != nil {
-			c.runErrorChan <- &RunError{"create generator", errors.Trace(err)}
+		if c.cfg.Mode == ModeReplay {
+			c.runReplayer(dispatcher)
 			return
 		}
-		err = generator.Run(c.ctx)
-		if err != nil {
-			c.runErrorChan <- &RunError{"generator run", errors.Trace(err)}
-		}
+		defer c.setPhase(nil, nil)
+		c.runPhases(dispatcher)
 	}()
 
+	startTime := time.Now()
+	if c.cfg.ReportInterval > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.runReporter(c.ctx, dispatcher, time.Duration(c.cfg.ReportInterval)*time.Second)
+		}()
+	}
+
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
 		dispatcher.Run(c.ctx)
+		if err := dispatcher.Close(); err != nil {
+			log.Errorf("close dispatcher error: %v", err)
+		}
 	}()
 
 	wg.Wait()
 	close(c.runErrorChan)
 
+	c.summary = NewSummary(c.targetRate(), dispatcher.Stats, time.Since(startTime))
+	c.summary.Print(os.Stdout)
+	if c.cfg.SummaryFile != "" {
+		err = c.summary.WriteJSON(c.cfg.SummaryFile)
+		if err != nil {
+			return errors.Trace(err)
+		}
+	}
+
 	return nil
 }
 
+func (c *Controller) setPhase(g *Generator, p *Phase) {
+	c.Lock()
+	defer c.Unlock()
+	c.generator = g
+	c.phase = p
+}
+
+func (c *Controller) getGenerator() *Generator {
+	c.Lock()
+	defer c.Unlock()
+	return c.generator
+}
+
+func (c *Controller) getPhase() *Phase {
+	c.Lock()
+	defer c.Unlock()
+	return c.phase
+}
+
+// targetRate returns the rate limit of the whole run, 0 if the rate is changed by
+// phases, rate profiles or control API, or records are replayed at recorded time.
+func (c *Controller) targetRate() int {
+	if c.rateChanged.Get() {
+		return 0
+	}
+	if c.cfg.Mode == ModeReplay {
+		if c.cfg.Replay.Speed > 0 {
+			return 0
+		}
+		return c.cfg.Rate
+	}
+	for _, p := range c.cfg.Phases {
+		if p.Rate != c.cfg.Phases[0].Rate || len(p.RateProfile) > 0 {
+			return 0
+		}
+	}
+	return c.cfg.Phases[0].Rate
+}
+
+// Summary returns the summary report after the controller finishes
+func (c *Controller) Summary() *Summary {
+	return c.summary
+}
+
+// runReplayer replays recorded workload and stops the controller when it finishes
+func (c *Controller) runReplayer(dispatcher *models.JobDispatcher) {
+	err := NewReplayer(c.cfg, dispatcher).Run(c.ctx)
+	if err != nil {
+		c.runErrorChan <- &RunError{"replayer run", errors.Trace(err)}
+		return
+	}
+	c.cancel()
+}
+
 // Close closes the controller
 func (c *Controller) Close() {
 	c.Lock()
@@ -0,0 +1,149 @@
+package central
+
+import (
+	"context"
+	"database/sql"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	_ "github.com/amyangfei/data-dam/db/sqlite" // Register SQLite database
+	"github.com/amyangfei/data-dam/pkg/models"
+)
+
+// newSQLiteConfig creates a SQLite database in a temporary directory and executes stmts
+// in it, the returned config generates workload of its main schema. cleanup closes the
+// database and removes the directory.
+func newSQLiteConfig(t *testing.T, stmts ...string) (*Config, *sql.DB, func()) {
+	dir, err := ioutil.TempDir("", "data-dam")
+	require.NoError(t, err)
+	path := filepath.Join(dir, "dam.db")
+	db, err := sql.Open("sqlite3", path)
+	cleanup := func() {
+		if db != nil {
+			db.Close()
+		}
+		os.RemoveAll(dir)
+	}
+	for _, stmt := range stmts {
+		if err != nil {
+			break
+		}
+		_, err = db.Exec(stmt)
+	}
+	if err != nil {
+		cleanup()
+		require.NoError(t, err)
+	}
+
+	cfg := NewConfig()
+	cfg.Schemas = []string{"main"}
+	cfg.DBConfig.Type = "sqlite"
+	cfg.DBConfig.SQLite = models.SQLiteConfig{Path: path}
+	return cfg, db, cleanup
+}
+
+// newTestDispatcher returns a running dispatcher executing jobs as configured by cfg,
+// it stops when ctx is done.
+func newTestDispatcher(ctx context.Context, t *testing.T, cfg *Config) *models.JobDispatcher {
+	dispatcher, err := models.NewJobDispatcher(ctx, cfg.Concurrent, cfg.BatchSize, &cfg.DBConfig, models.GetDBCreator(cfg.DBConfig.Type))
+	require.NoError(t, err)
+	dispatcher.Txn = cfg.Txn
+	dispatcher.Coalesce = cfg.Coalesce
+	go dispatcher.Run(ctx)
+	return dispatcher
+}
+
+// newTestGenerator returns a generator with tables of the main schema prepared,
+// generated jobs are executed by dispatcher.
+func newTestGenerator(t *testing.T, cfg *Config, dispatcher *models.JobDispatcher) *Generator {
+	ctx := context.Background()
+	g, err := NewGenerator(cfg, dispatcher)
+	require.NoError(t, err)
+	_, _, err = g.db.PrepareTables(ctx, "main")
+	require.NoError(t, err)
+	require.NoError(t, dispatcher.PrepareTables(ctx, "main"))
+	return g
+}
+
+// execute generates DML of each type in ops and waits for them being executed
+// by the dispatcher of g.
+func execute(ctx context.Context, t *testing.T, g *Generator, ops ...models.OpType) []*models.DMLParams {
+	params := make([]*models.DMLParams, 0, len(ops))
+	for _, op := range ops {
+		p, err := g.Next(ctx, op)
+		require.NoError(t, err)
+		g.dispatcher.AddDML(p)
+		params = append(params, p)
+	}
+	g.dispatcher.Flush()
+	return params
+}
+
+// repeatOps returns ops repeated n times
+func repeatOps(n int, ops ...models.OpType) []models.OpType {
+	repeated := make([]models.OpType, 0, n*len(ops))
+	for i := 0; i < n; i++ {
+		repeated = append(repeated, ops...)
+	}
+	return repeated
+}
+
+// countOps counts generated DML by type
+func countOps(params []*models.DMLParams) map[models.OpType]int64 {
+	counts := make(map[models.OpType]int64)
+	for _, p := range params {
+		counts[p.Type]++
+	}
+	return counts
+}
+
+func TestControllerWithSQLite(t *testing.T) {
+	cfg, db, cleanup := newSQLiteConfig(t, "CREATE TABLE t (id INTEGER PRIMARY KEY, name VARCHAR(32), score INT, created DATETIME)")
+	defer cleanup()
+	cfg.Rate = 200
+	cfg.Duration = "1s"
+	cfg.Concurrent = 2
+	cfg.OpWeight = []int{10, 4, 2, 1}
+	require.NoError(t, cfg.veirfy())
+
+	controller := NewController(cfg)
+	assert.NoError(t, controller.Start())
+	controller.Close()
+
+	var count int
+	require.NoError(t, db.QueryRow("SELECT COUNT(*) FROM t").Scan(&count))
+	assert.True(t, count > 0)
+
+	summary := controller.Summary()
+	require.NotNil(t, summary)
+	assert.True(t, summary.Total >= int64(count))
+	assert.True(t, summary.AchievedRate > 0)
+	assert.True(t, summary.Tables["main.t"] > 0)
+}
+
+func TestControllerTransactions(t *testing.T) {
+	cfg, _, cleanup := newSQLiteConfig(t, "CREATE TABLE t (id INTEGER PRIMARY KEY, name VARCHAR(32))")
+	defer cleanup()
+	cfg.Rate = 400
+	cfg.Duration = "1s"
+	cfg.Concurrent = 2
+	cfg.OpWeight = []int{1, 0, 0, 0}
+	cfg.Txn = models.TxnConfig{Size: 4, RollbackRatio: 0.5}
+	require.NoError(t, cfg.veirfy())
+
+	controller := NewController(cfg)
+	assert.NoError(t, controller.Start())
+	controller.Close()
+
+	// transactions of dispatcher are reported in summary
+	summary := controller.Summary()
+	require.NotNil(t, summary)
+	assert.True(t, summary.Commits > 0)
+	assert.True(t, summary.Rollbacks > 0)
+	assert.Equal(t, int64(0), summary.Errors)
+}
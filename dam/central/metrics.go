@@ -0,0 +1,48 @@
+package central
+
+import (
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/amyangfei/data-dam/pkg/models"
+)
+
+var (
+	generatedJobsCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "data_dam",
+			Subsystem: "generator",
+			Name:      "generated_jobs_total",
+			Help:      "total number of jobs generated by generator",
+		}, []string{"type", "schema", "table"})
+
+	limiterRateGauge = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: "data_dam",
+			Subsystem: "generator",
+			Name:      "limiter_rate",
+			Help:      "current rate limit of generated jobs per second",
+		})
+
+	registry     *prometheus.Registry
+	registryOnce sync.Once
+)
+
+// RegisterMetrics registers metrics of generator
+func RegisterMetrics(registry *prometheus.Registry) {
+	registry.MustRegister(generatedJobsCounter)
+	registry.MustRegister(limiterRateGauge)
+}
+
+// metricsRegistry returns the registry with all data dam metrics registered
+func metricsRegistry() *prometheus.Registry {
+	registryOnce.Do(func() {
+		registry = prometheus.NewRegistry()
+		registry.MustRegister(prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}))
+		registry.MustRegister(prometheus.NewGoCollector())
+		RegisterMetrics(registry)
+		models.RegisterMetrics(registry)
+	})
+	return registry
+}
@@ -0,0 +1,60 @@
+package central
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/amyangfei/data-dam/pkg/models"
+)
+
+func TestMetrics(t *testing.T) {
+	cfg, db, cleanup := newSQLiteConfig(t, "CREATE TABLE t (id INTEGER PRIMARY KEY, name VARCHAR(32))")
+	defer cleanup()
+	cfg.Rate = 200
+	cfg.Concurrent = 2
+	cfg.OpWeight = []int{1, 0, 0, 0}
+	require.NoError(t, cfg.veirfy())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	dispatcher := newTestDispatcher(ctx, t, cfg)
+	defer dispatcher.Close()
+	g, err := NewGenerator(cfg, dispatcher)
+	require.NoError(t, err)
+	defer g.Close()
+
+	generated := generatedJobsCounter.WithLabelValues(models.Insert.String(), "main", "t")
+	before := testutil.ToFloat64(generated)
+	runCtx, runCancel := context.WithCancel(ctx)
+	time.AfterFunc(200*time.Millisecond, runCancel)
+	require.NoError(t, g.Run(runCtx))
+	dispatcher.Flush()
+
+	// every generated insert is counted and executed
+	var count int
+	require.NoError(t, db.QueryRow("SELECT COUNT(*) FROM t").Scan(&count))
+	assert.True(t, count > 0)
+	assert.Equal(t, float64(count), testutil.ToFloat64(generated)-before)
+	assert.Equal(t, float64(200), testutil.ToFloat64(limiterRateGauge))
+
+	families, err := metricsRegistry().Gather()
+	require.NoError(t, err)
+	names := make(map[string]bool)
+	for _, family := range families {
+		names[family.GetName()] = true
+	}
+	for _, name := range []string{
+		"data_dam_generator_generated_jobs_total",
+		"data_dam_generator_limiter_rate",
+		"data_dam_dispatcher_executed_jobs_total",
+		"data_dam_dispatcher_job_duration_seconds",
+		"data_dam_dispatcher_queue_size",
+	} {
+		assert.True(t, names[name], name)
+	}
+}
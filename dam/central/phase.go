@@ -0,0 +1,166 @@
+package central
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/pingcap/errors"
+
+	"github.com/amyangfei/data-dam/pkg/log"
+	"github.com/amyangfei/data-dam/pkg/models"
+)
+
+// scale of DML weights when converting ddl-ratio to the weight of DDL
+const ddlRatioScale = 100
+
+// Phase is a stage of workload, fields not set are inherited from the top level config
+type Phase struct {
+	Name        string      `toml:"name" json:"name"`
+	Duration    string      `toml:"duration" json:"duration"` // 0 means forever, only allowed in the last phase
+	Rate        int         `toml:"rate" json:"rate"`
+	OpWeight    []int       `toml:"op-weight" json:"op-weight"`
+	Schemas     []string    `toml:"schemas" json:"schemas"`
+	DDLRatio    *float64    `toml:"ddl-ratio" json:"ddl-ratio"` // fraction of operations being DDL, overrides the DDL weight of op-weight
+	RateProfile RateProfile `toml:"rate-profile" json:"rate-profile"`
+
+	duration time.Duration
+}
+
+// adjustPhases fills phases with the top level config, a config without phases
+// runs a single phase of the top level config.
+func (c *Config) adjustPhases() error {
+	if len(c.Phases) == 0 {
+		c.Phases = []*Phase{{Name: "default"}}
+	}
+	for idx, p := range c.Phases {
+		if p.Name == "" {
+			p.Name = fmt.Sprintf("phase-%d", idx+1)
+		}
+		if p.Duration == "" {
+			p.Duration = c.Duration
+		}
+		if p.Rate == 0 {
+			p.Rate = c.Rate
+		}
+		if len(p.OpWeight) == 0 {
+			p.OpWeight = c.OpWeight
+		}
+		if len(p.Schemas) == 0 {
+			p.Schemas = c.Schemas
+		}
+		if len(p.RateProfile) == 0 {
+			p.RateProfile = c.RateProfile
+		}
+		err := p.adjust()
+		if err != nil {
+			return errors.Annotatef(err, "phase %s", p.Name)
+		}
+		if p.duration == 0 && idx != len(c.Phases)-1 {
+			return errors.NotValidf("phase %s runs forever but is not the last phase", p.Name)
+		}
+	}
+	return nil
+}
+
+func (p *Phase) adjust() error {
+	var err error
+	p.duration, err = time.ParseDuration(p.Duration)
+	if err != nil {
+		return errors.Annotatef(err, "parse duration")
+	}
+	if p.duration < 0 {
+		return errors.NotValidf("duration %s", p.Duration)
+	}
+	if p.Rate <= 0 {
+		return errors.NotValidf("rate %d", p.Rate)
+	}
+	p.OpWeight, err = normalizeOpWeight(p.OpWeight)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if p.DDLRatio != nil {
+		p.OpWeight, err = applyDDLRatio(p.OpWeight, *p.DDLRatio)
+		if err != nil {
+			return errors.Trace(err)
+		}
+	}
+	return errors.Trace(p.RateProfile.adjust())
+}
+
+// applyDDLRatio returns weights whose DDL weight makes DDL take ratio of all operations
+func applyDDLRatio(weights []int, ratio float64) ([]int, error) {
+	if ratio < 0 || ratio > 1 {
+		return nil, errors.NotValidf("ddl-ratio %f", ratio)
+	}
+	ddlIdx := -1
+	dmlSum := 0
+	result := make([]int, len(weights))
+	for idx := range weights {
+		if models.RealOpType[idx] == models.Ddl {
+			ddlIdx = idx
+			continue
+		}
+		result[idx] = weights[idx] * ddlRatioScale
+		dmlSum += result[idx]
+	}
+	if ddlIdx < 0 {
+		return nil, errors.NotSupportedf("ddl-ratio without DDL operation")
+	}
+	switch {
+	case ratio == 1:
+		for idx := range result {
+			result[idx] = 0
+		}
+		result[ddlIdx] = 1
+	case dmlSum == 0:
+		return nil, errors.NotValidf("ddl-ratio %f with all zero DML weights %v", ratio, weights)
+	default:
+		result[ddlIdx] = int(math.Round(float64(dmlSum) * ratio / (1 - ratio)))
+	}
+	return result, nil
+}
+
+// runPhases runs phases one by one with the same generator and dispatcher, and
+// stops the controller when all phases finish.
+func (c *Controller) runPhases(dispatcher *models.JobDispatcher) {
+	generator, err := NewGenerator(c.cfg, dispatcher)
+	if err != nil {
+		c.runErrorChan <- &RunError{"generator", errors.Trace(err)}
+		return
+	}
+	defer generator.Close()
+
+	for idx, p := range c.cfg.Phases {
+		generator.applyPhase(p)
+		log.Infof("phase %d/%d %s starts, duration: %s, rate: %d, op-weight: %v, schemas: %v",
+			idx+1, len(c.cfg.Phases), p.Name, p.Duration, generator.Rate(), generator.OpWeight(), p.Schemas)
+		err = c.runPhase(generator, p)
+		if err != nil {
+			c.runErrorChan <- &RunError{fmt.Sprintf("phase %s", p.Name), errors.Trace(err)}
+			return
+		}
+		if c.ctx.Err() != nil {
+			log.Infof("phase %s is interrupted", p.Name)
+			return
+		}
+		// jobs of the phase are executed before the next phase starts
+		dispatcher.Flush()
+		log.Infof("phase %s finishes", p.Name)
+	}
+	log.Infof("all %d phases finish", len(c.cfg.Phases))
+	c.cancel()
+}
+
+func (c *Controller) runPhase(generator *Generator, p *Phase) error {
+	c.setPhase(generator, p)
+
+	ctx := c.ctx
+	if p.duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(c.ctx, p.duration)
+		defer cancel()
+	}
+	return errors.Trace(generator.Run(ctx))
+}
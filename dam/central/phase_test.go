@@ -0,0 +1,155 @@
+package central
+
+import (
+	"database/sql"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/BurntSushi/toml"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/amyangfei/data-dam/pkg/models"
+)
+
+func TestApplyDDLRatio(t *testing.T) {
+	weights, err := applyDDLRatio([]int{2, 1, 1, 5}, 0.2)
+	require.NoError(t, err)
+	assert.Equal(t, []int{200, 100, 100, 100}, weights)
+
+	weights, err = applyDDLRatio([]int{2, 1, 1, 5}, 0)
+	require.NoError(t, err)
+	assert.Equal(t, []int{200, 100, 100, 0}, weights)
+
+	weights, err = applyDDLRatio([]int{0, 0, 0, 1}, 1)
+	require.NoError(t, err)
+	assert.Equal(t, []int{0, 0, 0, 1}, weights)
+
+	_, err = applyDDLRatio([]int{0, 0, 0, 1}, 0.5)
+	assert.Error(t, err)
+	_, err = applyDDLRatio([]int{1, 1, 1, 1}, 1.5)
+	assert.Error(t, err)
+}
+
+func TestConfigPhases(t *testing.T) {
+	data := `
+rate = 50
+duration = "1m"
+schemas = ["dam"]
+op-weight = [4, 2, 1, 0]
+
+[[phase]]
+name = "warmup"
+duration = "5m"
+op-weight = [1]
+
+[[phase]]
+rate = 100
+ddl-ratio = 0.5
+
+[[phase]]
+name = "cleanup"
+duration = "0"
+schemas = ["dam2"]
+op-weight = [1, 0, 9]
+`
+	cfg := NewConfig()
+	cfg.DBConfig.Type = "sqlite"
+	_, err := toml.Decode(data, cfg)
+	require.NoError(t, err)
+	require.NoError(t, cfg.veirfy())
+	require.Len(t, cfg.Phases, 3)
+
+	warmup := cfg.Phases[0]
+	assert.Equal(t, "warmup", warmup.Name)
+	assert.Equal(t, 50, warmup.Rate)
+	assert.Equal(t, []int{1, 0, 0, 0, 0, 0, 0, 0, 0}, warmup.OpWeight)
+	assert.Equal(t, []string{"dam"}, warmup.Schemas)
+
+	mixed := cfg.Phases[1]
+	assert.Equal(t, "phase-2", mixed.Name)
+	assert.Equal(t, "1m", mixed.Duration)
+	assert.Equal(t, 100, mixed.Rate)
+	assert.Equal(t, []int{400, 200, 100, 700, 0, 0, 0, 0, 0}, mixed.OpWeight)
+
+	cleanup := cfg.Phases[2]
+	assert.Equal(t, []string{"dam2"}, cleanup.Schemas)
+	assert.Equal(t, []int{1, 0, 9, 0, 0, 0, 0, 0, 0}, cleanup.OpWeight)
+
+	// only the last phase can run forever
+	cfg = NewConfig()
+	cfg.DBConfig.Type = "sqlite"
+	cfg.Phases = []*Phase{{Duration: "0"}, {Duration: "1s"}}
+	assert.Error(t, cfg.veirfy())
+}
+
+func TestControllerPhases(t *testing.T) {
+	dir, err := ioutil.TempDir("", "data-dam")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "dam.db")
+	db, err := sql.Open("sqlite3", path)
+	require.NoError(t, err)
+	defer db.Close()
+	_, err = db.Exec("CREATE TABLE t (id INTEGER PRIMARY KEY, name VARCHAR(32), score INT, created DATETIME)")
+	require.NoError(t, err)
+
+	cfg := NewConfig()
+	cfg.Concurrent = 2
+	cfg.Schemas = []string{"main"}
+	cfg.ReportInterval = 0
+	cfg.DBConfig.Type = "sqlite"
+	cfg.DBConfig.SQLite = models.SQLiteConfig{Path: path}
+	cfg.Phases = []*Phase{
+		{Name: "insert", Duration: "300ms", Rate: 200, OpWeight: []int{1}},
+		{Name: "update", Duration: "300ms", Rate: 200, OpWeight: []int{1, 1}},
+	}
+	require.NoError(t, cfg.veirfy())
+
+	controller := NewController(cfg)
+	require.NoError(t, controller.Start())
+	controller.Close()
+
+	counts := make(map[models.OpType]int64)
+	for _, op := range controller.Summary().Ops {
+		counts[op.Type] = op.Count
+	}
+	assert.True(t, counts[models.Insert] > 0)
+	assert.True(t, counts[models.Update] > 0)
+	assert.Zero(t, counts[models.Delete])
+	assert.Zero(t, counts[models.Ddl])
+	// ids of inserts continue across phases
+	assert.Zero(t, controller.Summary().Errors)
+}
+
+func TestGeneratorApplyPhase(t *testing.T) {
+	dir, err := ioutil.TempDir("", "data-dam")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	cfg := NewConfig()
+	cfg.Schemas = []string{"main"}
+	cfg.DBConfig.Type = "sqlite"
+	cfg.DBConfig.SQLite = models.SQLiteConfig{Path: filepath.Join(dir, "dam.db")}
+	require.NoError(t, cfg.veirfy())
+	g, err := NewGenerator(cfg, nil)
+	require.NoError(t, err)
+	defer g.Close()
+
+	weights := []int{1, 0, 0, 0, 0, 0, 0, 0, 0}
+	g.applyPhase(&Phase{Rate: 10, OpWeight: weights, Schemas: []string{"s"}})
+	assert.Equal(t, 10, g.Rate())
+	assert.Equal(t, weights, g.OpWeight())
+	assert.Equal(t, []string{"s"}, g.schemas)
+
+	// rate and weights set by control API are kept in later phases
+	require.NoError(t, g.SetRate(20))
+	require.NoError(t, g.SetOpWeight([]int{0, 1}))
+	g.applyPhase(&Phase{Rate: 30, OpWeight: weights, Schemas: []string{"s2"}})
+	assert.Equal(t, 20, g.Rate())
+	assert.Equal(t, []int{0, 1, 0, 0, 0, 0, 0, 0, 0}, g.OpWeight())
+	assert.Equal(t, []string{"s2"}, g.schemas)
+}
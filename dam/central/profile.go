@@ -0,0 +1,154 @@
+package central
+
+import (
+	"math"
+	"time"
+
+	"github.com/pingcap/errors"
+)
+
+// phase types of rate profile
+const (
+	PhaseHold  = "hold"
+	PhaseRamp  = "ramp"
+	PhaseStep  = "step"
+	PhaseBurst = "burst"
+	PhaseSine  = "sine"
+
+	// limiter blocks forever with zero rate, so a small rate is used instead
+	minProfileRate = 0.1
+)
+
+// RatePhase is a phase of rate profile
+//
+//	hold:  keeps `rate`
+//	ramp:  changes linearly from `from` to `to`
+//	step:  changes from `from` to `to` in `steps` equal steps
+//	burst: keeps `rate`, and raises to `peak` for `burst-duration` at the beginning of every `period`
+//	sine:  oscillates around `rate` with `amplitude` and `period`
+type RatePhase struct {
+	Type          string `toml:"type" json:"type"`
+	Duration      string `toml:"duration" json:"duration"`
+	Rate          int    `toml:"rate" json:"rate"`
+	From          int    `toml:"from" json:"from"`
+	To            int    `toml:"to" json:"to"`
+	Steps         int    `toml:"steps" json:"steps"`
+	Peak          int    `toml:"peak" json:"peak"`
+	Amplitude     int    `toml:"amplitude" json:"amplitude"`
+	Period        string `toml:"period" json:"period"`
+	BurstDuration string `toml:"burst-duration" json:"burst-duration"`
+
+	duration      time.Duration
+	period        time.Duration
+	burstDuration time.Duration
+}
+
+// RateProfile is a list of phases driving the rate limiter over time,
+// the final rate of the last phase is kept after all phases finish.
+type RateProfile []*RatePhase
+
+func parseDuration(name, s string) (time.Duration, error) {
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, errors.Annotatef(err, "parse %s", name)
+	}
+	if d <= 0 {
+		return 0, errors.NotValidf("%s %s", name, s)
+	}
+	return d, nil
+}
+
+func (p *RatePhase) adjust() error {
+	var err error
+	p.duration, err = parseDuration("duration", p.Duration)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	switch p.Type {
+	case PhaseHold:
+	case PhaseRamp:
+	case PhaseStep:
+		if p.Steps <= 0 {
+			return errors.NotValidf("steps %d of step phase", p.Steps)
+		}
+	case PhaseBurst:
+		p.period, err = parseDuration("period", p.Period)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		p.burstDuration, err = parseDuration("burst-duration", p.BurstDuration)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		if p.burstDuration > p.period {
+			return errors.NotValidf("burst-duration %s longer than period %s", p.BurstDuration, p.Period)
+		}
+	case PhaseSine:
+		p.period, err = parseDuration("period", p.Period)
+		if err != nil {
+			return errors.Trace(err)
+		}
+	default:
+		return errors.NotValidf("rate phase type %s", p.Type)
+	}
+	if p.Rate < 0 || p.From < 0 || p.To < 0 || p.Peak < 0 || p.Amplitude < 0 {
+		return errors.NotValidf("negative rate in %s phase", p.Type)
+	}
+	return nil
+}
+
+// rateAt returns the rate at elapsed time since the beginning of phase
+func (p *RatePhase) rateAt(elapsed time.Duration) float64 {
+	if elapsed > p.duration {
+		elapsed = p.duration
+	}
+	progress := float64(elapsed) / float64(p.duration)
+	from, to := float64(p.From), float64(p.To)
+	switch p.Type {
+	case PhaseRamp:
+		return from + (to-from)*progress
+	case PhaseStep:
+		step := math.Floor(progress * float64(p.Steps))
+		if step >= float64(p.Steps) {
+			step = float64(p.Steps) - 1
+		}
+		if p.Steps == 1 {
+			return to
+		}
+		return from + (to-from)*step/float64(p.Steps-1)
+	case PhaseBurst:
+		if elapsed%p.period < p.burstDuration {
+			return float64(p.Peak)
+		}
+		return float64(p.Rate)
+	case PhaseSine:
+		return float64(p.Rate) + float64(p.Amplitude)*math.Sin(2*math.Pi*float64(elapsed)/float64(p.period))
+	default:
+		return float64(p.Rate)
+	}
+}
+
+func (rp RateProfile) adjust() error {
+	for idx, p := range rp {
+		if err := p.adjust(); err != nil {
+			return errors.Annotatef(err, "rate-profile phase %d", idx)
+		}
+	}
+	return nil
+}
+
+// RateAt returns the rate at elapsed time since the beginning of profile
+func (rp RateProfile) RateAt(elapsed time.Duration) float64 {
+	if len(rp) == 0 {
+		return minProfileRate
+	}
+	var r float64
+	for _, p := range rp {
+		r = p.rateAt(elapsed)
+		if elapsed < p.duration {
+			break
+		}
+		elapsed -= p.duration
+	}
+	return math.Max(r, minProfileRate)
+}
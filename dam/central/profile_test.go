@@ -0,0 +1,79 @@
+package central
+
+import (
+	"testing"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRateProfile(t *testing.T) {
+	profile := RateProfile{
+		{Type: PhaseRamp, Duration: "10s", From: 0, To: 100},
+		{Type: PhaseHold, Duration: "10s", Rate: 100},
+		{Type: PhaseStep, Duration: "10s", From: 100, To: 400, Steps: 4},
+		{Type: PhaseBurst, Duration: "10s", Rate: 50, Peak: 500, Period: "4s", BurstDuration: "1s"},
+		{Type: PhaseSine, Duration: "10s", Rate: 100, Amplitude: 50, Period: "4s"},
+	}
+	require.NoError(t, profile.adjust())
+
+	cases := []struct {
+		elapsed time.Duration
+		rate    float64
+	}{
+		{0, minProfileRate},
+		{5 * time.Second, 50},
+		{15 * time.Second, 100},
+		{20 * time.Second, 100},
+		{23 * time.Second, 200},
+		{29 * time.Second, 400},
+		{30 * time.Second, 500},
+		{32 * time.Second, 50},
+		{34500 * time.Millisecond, 500},
+		{41 * time.Second, 150},
+		{43 * time.Second, 50},
+		{time.Hour, 100},
+	}
+	for _, cs := range cases {
+		assert.InDelta(t, cs.rate, profile.RateAt(cs.elapsed), 1e-6, "elapsed %s", cs.elapsed)
+	}
+
+	invalid := []RateProfile{
+		{{Type: "unknown", Duration: "1s"}},
+		{{Type: PhaseHold, Duration: "0s"}},
+		{{Type: PhaseStep, Duration: "1s", Steps: 0}},
+		{{Type: PhaseBurst, Duration: "1s", Period: "1s", BurstDuration: "2s"}},
+		{{Type: PhaseSine, Duration: "1s"}},
+		{{Type: PhaseHold, Duration: "1s", Rate: -1}},
+	}
+	for _, p := range invalid {
+		assert.Error(t, p.adjust())
+	}
+}
+
+func TestRateProfileFromTOML(t *testing.T) {
+	data := `
+[[rate-profile]]
+type = "ramp"
+duration = "30s"
+from = 10
+to = 100
+[[rate-profile]]
+type = "burst"
+duration = "1m"
+rate = 100
+peak = 500
+period = "10s"
+burst-duration = "2s"
+`
+	cfg := NewConfig()
+	cfg.DBConfig.Type = "sqlite"
+	_, err := toml.Decode(data, cfg)
+	require.NoError(t, err)
+	require.NoError(t, cfg.veirfy())
+	require.Len(t, cfg.RateProfile, 2)
+	assert.InDelta(t, 55, cfg.RateProfile.RateAt(15*time.Second), 1e-6)
+	assert.InDelta(t, 500, cfg.RateProfile.RateAt(41*time.Second), 1e-6)
+}
@@ -0,0 +1,285 @@
+package central
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pingcap/errors"
+	"golang.org/x/time/rate"
+
+	"github.com/amyangfei/data-dam/pkg/log"
+	"github.com/amyangfei/data-dam/pkg/models"
+)
+
+const (
+	// same as the timestamp comment written by sql file output
+	replayTimestampLayout = "2006-01-02 15:04:05.000"
+	replayMaxLineSize     = 64 * 1024 * 1024
+)
+
+// replayRecord is a recorded operation, a JSON line is a DMLParams with an
+// optional `start-time`, DDL is recorded with type `ddl` and its statement.
+type replayRecord struct {
+	models.DMLParams
+	BinaryColumns []string  `json:"binary-columns"` // columns of []byte values, which are base64 strings
+	Time          time.Time `json:"start-time"`
+	Rollback      bool      `json:"rollback"` // the job is rolled back in the journal
+}
+
+// Replayer reads recorded workload and pushes it to the dispatcher
+type Replayer struct {
+	cfg        *Config
+	dispatcher *models.JobDispatcher
+}
+
+// NewReplayer returns a new Replayer
+func NewReplayer(cfg *Config, dispatcher *models.JobDispatcher) *Replayer {
+	return &Replayer{
+		cfg:        cfg,
+		dispatcher: dispatcher,
+	}
+}
+
+// Run replays all records in the file, it returns after all DMLs are executed.
+// Records are replayed at the recorded time scaled by speed, records without
+// time or zero speed are replayed at `rate`.
+func (r *Replayer) Run(ctx context.Context) error {
+	f, err := os.Open(r.cfg.Replay.File)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer f.Close()
+
+	var next func() (*replayRecord, error)
+	switch r.cfg.Replay.Format {
+	case replayFormatSQL:
+		next = newSQLRecordReader(f)
+	default:
+		next = newJSONRecordReader(f)
+	}
+
+	var (
+		rl        = rate.NewLimiter(rate.Limit(r.cfg.Rate), 10)
+		speed     = r.cfg.Replay.Speed
+		firstTime time.Time
+		startTime = time.Now()
+		count     int
+	)
+	for {
+		record, err := next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return errors.Trace(err)
+		}
+		// jobs of rolled back transactions are not applied to database
+		if record.Rollback {
+			continue
+		}
+
+		if speed > 0 && !record.Time.IsZero() {
+			if firstTime.IsZero() {
+				firstTime = record.Time
+			}
+			delay := time.Duration(float64(record.Time.Sub(firstTime))/speed) - time.Since(startTime)
+			if delay > 0 {
+				select {
+				case <-ctx.Done():
+					return nil
+				case <-time.After(delay):
+				}
+			}
+		} else {
+			err = rl.Wait(ctx)
+			if err != nil {
+				if ctx.Err() != nil {
+					return nil
+				}
+				return errors.Trace(err)
+			}
+		}
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		if record.Type == models.Ddl {
+			ddl := &models.DDLParams{
+				Schema: record.Schema,
+				Table:  record.Table,
+				SQL:    record.SQL,
+			}
+			err = r.dispatcher.AddDDL(ddl)
+			if err != nil {
+				log.Warnf("execute DDL %s failed: %v", ddl.SQL, err)
+			}
+		} else {
+			r.dispatcher.AddDML(&record.DMLParams)
+		}
+		count++
+	}
+	r.dispatcher.Flush()
+	log.Infof("replayed %d records from %s", count, r.cfg.Replay.File)
+	return nil
+}
+
+func newJSONRecordReader(rd io.Reader) func() (*replayRecord, error) {
+	scanner := bufio.NewScanner(rd)
+	scanner.Buffer(nil, replayMaxLineSize)
+	lineNo := 0
+	return func() (*replayRecord, error) {
+		for scanner.Scan() {
+			lineNo++
+			line := bytes.TrimSpace(scanner.Bytes())
+			if len(line) == 0 {
+				continue
+			}
+			record := &replayRecord{}
+			decoder := json.NewDecoder(bytes.NewReader(line))
+			decoder.UseNumber()
+			err := decoder.Decode(record)
+			if err != nil {
+				return nil, errors.Annotatef(err, "line %d", lineNo)
+			}
+			convertNumbers(record.Keys)
+			convertNumbers(record.Values)
+			if rng := record.Range; rng != nil {
+				rng.Begin, rng.End = convertNumber(rng.Begin), convertNumber(rng.End)
+			}
+			err = models.DecodeBinaryValues(&record.DMLParams, record.BinaryColumns)
+			if err != nil {
+				return nil, errors.Annotatef(err, "line %d", lineNo)
+			}
+			return record, nil
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, errors.Trace(err)
+		}
+		return nil, io.EOF
+	}
+}
+
+// convertNumbers converts json.Number to int64 or float64, so they are bound as numbers
+func convertNumbers(m map[string]interface{}) {
+	for k, v := range m {
+		m[k] = convertNumber(v)
+	}
+}
+
+func convertNumber(v interface{}) interface{} {
+	n, ok := v.(json.Number)
+	if !ok {
+		return v
+	}
+	if i, err := n.Int64(); err == nil {
+		return i
+	}
+	if f, err := n.Float64(); err == nil {
+		return f
+	}
+	return v
+}
+
+// newSQLRecordReader reads statements ended with `;` at the end of line out of quotes,
+// `-- <timestamp>` comments give the time of following statements,
+// transaction statements are skipped because jobs are executed in different connections.
+func newSQLRecordReader(rd io.Reader) func() (*replayRecord, error) {
+	scanner := bufio.NewScanner(rd)
+	scanner.Buffer(nil, replayMaxLineSize)
+	var ts time.Time
+	return func() (*replayRecord, error) {
+		var stmt strings.Builder
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if stmt.Len() == 0 {
+				if line == "" {
+					continue
+				}
+				if strings.HasPrefix(line, "--") {
+					t, err := time.ParseInLocation(replayTimestampLayout, strings.TrimSpace(line[2:]), time.Local)
+					if err == nil {
+						ts = t
+					}
+					continue
+				}
+			} else {
+				stmt.WriteByte('\n')
+			}
+			stmt.WriteString(line)
+			if !strings.HasSuffix(line, ";") || !isCompleteStatement(stmt.String()) {
+				continue
+			}
+
+			sql := stmt.String()
+			stmt.Reset()
+			tp, ok := sqlOpType(sql)
+			if !ok {
+				continue
+			}
+			record := &replayRecord{Time: ts}
+			record.Type = tp
+			record.SQL = sql
+			return record, nil
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, errors.Trace(err)
+		}
+		if stmt.Len() > 0 {
+			return nil, errors.Errorf("incomplete statement %s", stmt.String())
+		}
+		return nil, io.EOF
+	}
+}
+
+// isCompleteStatement checks whether all quotes in statement are closed
+func isCompleteStatement(stmt string) bool {
+	var quote byte
+	for i := 0; i < len(stmt); i++ {
+		c := stmt[i]
+		switch {
+		case quote == 0:
+			if c == '\'' || c == '"' || c == '`' {
+				quote = c
+			}
+		case c == '\\' && quote != '`':
+			i++
+		case c == quote:
+			quote = 0
+		}
+	}
+	return quote == 0
+}
+
+// sqlOpType returns OpType of the statement, false for transaction statements
+func sqlOpType(sql string) (models.OpType, bool) {
+	fields := strings.Fields(strings.ToUpper(strings.TrimSuffix(sql, ";")))
+	if len(fields) == 0 {
+		return models.Flush, false
+	}
+	switch fields[0] {
+	case "BEGIN", "START", "COMMIT", "ROLLBACK":
+		return models.Flush, false
+	case "REPLACE":
+		return models.Replace, true
+	case "INSERT":
+		if len(fields) > 1 && fields[1] == "IGNORE" {
+			return models.InsertIgnore, true
+		}
+		if strings.Contains(strings.Join(fields, " "), "ON DUPLICATE KEY UPDATE") {
+			return models.Upsert, true
+		}
+		return models.Insert, true
+	case "UPDATE":
+		return models.Update, true
+	case "DELETE":
+		return models.Delete, true
+	default:
+		return models.Ddl, true
+	}
+}
@@ -0,0 +1,109 @@
+package central
+
+import (
+	"database/sql"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/amyangfei/data-dam/pkg/models"
+)
+
+func TestSQLRecordReader(t *testing.T) {
+	content := `-- 2019-03-01 10:00:00.000
+BEGIN;
+INSERT INTO t VALUES (1, 'a;
+b');
+COMMIT;
+-- 2019-03-01 10:00:01.500
+ALTER TABLE t ADD COLUMN c INT;
+`
+	next := newSQLRecordReader(strings.NewReader(content))
+	record, err := next()
+	require.NoError(t, err)
+	assert.Equal(t, models.Insert, record.Type)
+	assert.Equal(t, "INSERT INTO t VALUES (1, 'a;\nb');", record.SQL)
+	assert.Equal(t, 0, record.Time.Second())
+
+	record, err = next()
+	require.NoError(t, err)
+	assert.Equal(t, models.Ddl, record.Type)
+	assert.Equal(t, 1, record.Time.Second())
+
+	_, err = next()
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestReplayWithSQLite(t *testing.T) {
+	dir, err := ioutil.TempDir("", "data-dam")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "dam.db")
+	db, err := sql.Open("sqlite3", path)
+	require.NoError(t, err)
+	defer db.Close()
+	_, err = db.Exec("CREATE TABLE t (id INTEGER PRIMARY KEY, name VARCHAR(32))")
+	require.NoError(t, err)
+
+	records := `{"type":"insert","schema":"main","table":"t","keys":{"id":1},"values":{"id":1,"name":"a"},"start-time":"2019-03-01T10:00:00Z"}
+{"type":"insert","schema":"main","table":"t","keys":{"id":2},"values":{"id":2,"name":"b"},"start-time":"2019-03-01T10:00:00.1Z"}
+{"type":"ddl","schema":"main","table":"t","sql":"ALTER TABLE t ADD COLUMN c INT","start-time":"2019-03-01T10:00:00.2Z"}
+{"type":"update","schema":"main","table":"t","keys":{"id":2},"values":{"c":10},"start-time":"2019-03-01T10:00:00.3Z"}
+{"type":"delete","schema":"main","table":"t","keys":{"id":1},"start-time":"2019-03-01T10:00:00.4Z"}
+`
+	file := filepath.Join(dir, "records.json")
+	require.NoError(t, ioutil.WriteFile(file, []byte(records), 0644))
+
+	cfg := NewConfig()
+	cfg.Duration = "10s"
+	cfg.Mode = ModeReplay
+	cfg.Replay.File = file
+	cfg.Replay.Speed = 4
+	cfg.DBConfig.Type = "sqlite"
+	cfg.DBConfig.SQLite = models.SQLiteConfig{Path: path}
+	require.NoError(t, cfg.veirfy())
+	assert.Equal(t, replayFormatJSON, cfg.Replay.Format)
+
+	controller := NewController(cfg)
+	assert.NoError(t, controller.Start())
+	controller.Close()
+
+	var (
+		id, c int
+		count int
+	)
+	require.NoError(t, db.QueryRow("SELECT COUNT(*) FROM t").Scan(&count))
+	assert.Equal(t, 1, count)
+	require.NoError(t, db.QueryRow("SELECT id, c FROM t").Scan(&id, &c))
+	assert.Equal(t, 2, id)
+	assert.Equal(t, 10, c)
+}
+
+func TestJSONRecordReaderBinary(t *testing.T) {
+	record := &models.JournalRecord{
+		DMLParams: models.DMLParams{
+			Type:   models.RangeUpdate,
+			Schema: "main",
+			Table:  "t",
+			Values: map[string]interface{}{"id": int64(1), "data": []byte{0, 0xff, 'a'}, "name": "AP8="},
+			Range:  &models.RangeParams{Column: "data", Begin: []byte("b"), Limit: 2},
+		},
+		BinaryColumns: []string{"data"},
+	}
+	data, err := json.Marshal(record)
+	require.NoError(t, err)
+
+	next := newJSONRecordReader(strings.NewReader(string(data)))
+	replayed, err := next()
+	require.NoError(t, err)
+	assert.Equal(t, record.Values, replayed.Values)
+	assert.Equal(t, record.Range, replayed.Range)
+}
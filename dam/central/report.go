@@ -0,0 +1,65 @@
+package central
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/amyangfei/data-dam/pkg/log"
+	"github.com/amyangfei/data-dam/pkg/models"
+)
+
+// intervalReport is the statistics of jobs executed in a report interval
+type intervalReport struct {
+	rates   []string // ops/s of every OpType, such as `insert: 10.0`
+	ops     float64  // ops/s
+	errors  float64  // errors/s
+	errRate float64  // percentage of failed jobs
+}
+
+// newIntervalReport computes the report of jobs executed between the last snapshot
+// and snap in seconds, last is updated to snap.
+func newIntervalReport(last map[models.OpType]models.OpStats, snap *models.StatsSnapshot, seconds float64) *intervalReport {
+	var (
+		ops, errs int64
+		report    = &intervalReport{rates: make([]string, 0, len(snap.Ops))}
+	)
+	for _, op := range snap.Ops {
+		count := op.Count - last[op.Type].Count
+		ops += count
+		errs += op.Errors - last[op.Type].Errors
+		report.rates = append(report.rates, fmt.Sprintf("%s: %.1f", op.Type, float64(count)/seconds))
+		last[op.Type] = op
+	}
+	report.ops = float64(ops) / seconds
+	report.errors = float64(errs) / seconds
+	if ops > 0 {
+		report.errRate = float64(errs) / float64(ops) * 100
+	}
+	return report
+}
+
+// runReporter logs throughput, error rate and backlog of dispatcher every interval
+func (c *Controller) runReporter(ctx context.Context, dispatcher *models.JobDispatcher, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var (
+		startTime = time.Now()
+		lastTime  = startTime
+		last      = make(map[models.OpType]models.OpStats)
+	)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			report := newIntervalReport(last, dispatcher.Stats.Snapshot(), now.Sub(lastTime).Seconds())
+			log.Infof("[ %.0fs ] ops: %.1f/s (%s), errors: %.1f/s (%.2f%%), backlog: %d",
+				now.Sub(startTime).Seconds(), report.ops, strings.Join(report.rates, ", "),
+				report.errors, report.errRate, dispatcher.Backlog())
+			lastTime = now
+		}
+	}
+}
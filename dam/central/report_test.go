@@ -0,0 +1,41 @@
+package central
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/amyangfei/data-dam/pkg/models"
+)
+
+func TestIntervalReport(t *testing.T) {
+	last := make(map[models.OpType]models.OpStats)
+	report := newIntervalReport(last, &models.StatsSnapshot{
+		Ops: []models.OpStats{
+			{Type: models.Insert, Count: 20, Errors: 2},
+			{Type: models.Update, Count: 10},
+		},
+	}, 2)
+	assert.Equal(t, []string{"insert: 10.0", "update: 5.0"}, report.rates)
+	assert.Equal(t, 15.0, report.ops)
+	assert.Equal(t, 1.0, report.errors)
+	assert.InDelta(t, 6.67, report.errRate, 0.01)
+
+	// only jobs executed after the last snapshot are counted
+	report = newIntervalReport(last, &models.StatsSnapshot{
+		Ops: []models.OpStats{
+			{Type: models.Insert, Count: 30, Errors: 7},
+			{Type: models.Update, Count: 10},
+			{Type: models.Delete, Count: 10},
+		},
+	}, 4)
+	assert.Equal(t, []string{"insert: 2.5", "update: 0.0", "delete: 2.5"}, report.rates)
+	assert.Equal(t, 5.0, report.ops)
+	assert.Equal(t, 1.25, report.errors)
+	assert.Equal(t, 25.0, report.errRate)
+
+	// no job in the interval
+	report = newIntervalReport(last, &models.StatsSnapshot{Ops: []models.OpStats{{Type: models.Insert, Count: 30, Errors: 7}}}, 1)
+	assert.Zero(t, report.ops)
+	assert.Zero(t, report.errRate)
+}
@@ -0,0 +1,177 @@
+package central
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+
+	"github.com/pingcap/errors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/amyangfei/data-dam/pkg/log"
+)
+
+// startStatusServer starts the HTTP server exposing `/metrics` and the control API
+func (c *Controller) startStatusServer() error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(metricsRegistry(), promhttp.HandlerOpts{}))
+	mux.HandleFunc("/api/v1/status", c.handleStatus)
+	mux.HandleFunc("/api/v1/pause", c.handlePause)
+	mux.HandleFunc("/api/v1/resume", c.handleResume)
+	mux.HandleFunc("/api/v1/rate", c.handleRate)
+	mux.HandleFunc("/api/v1/op-weight", c.handleOpWeight)
+
+	ln, err := net.Listen("tcp", c.cfg.StatusAddr)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	c.statusServer = &http.Server{Handler: mux}
+	go func() {
+		log.Infof("status server listens on %s", ln.Addr())
+		err := c.statusServer.Serve(ln)
+		if err != nil && err != http.ErrServerClosed {
+			log.Errorf("status server error: %v", err)
+		}
+	}()
+	return nil
+}
+
+// stopStatusServer closes the HTTP server if it is started
+func (c *Controller) stopStatusServer() {
+	if c.statusServer == nil {
+		return
+	}
+	if err := c.statusServer.Close(); err != nil {
+		log.Errorf("close status server error: %v", err)
+	}
+}
+
+// Status is the runtime status of controller returned by the control API
+type Status struct {
+	Mode     string `json:"mode"`
+	Phase    string `json:"phase,omitempty"` // name of running phase
+	Running  bool   `json:"running"`         // whether generator is running
+	Paused   bool   `json:"paused"`
+	Rate     int    `json:"rate"`
+	OpWeight []int  `json:"op-weight"`
+	Backlog  int    `json:"backlog"`
+	Total    int64  `json:"total"`
+	Errors   int64  `json:"errors"`
+}
+
+func (c *Controller) status() *Status {
+	st := &Status{
+		Mode:     c.cfg.Mode,
+		Rate:     c.cfg.Rate,
+		OpWeight: c.cfg.OpWeight,
+		Backlog:  c.dispatcher.Backlog(),
+	}
+	st.Total, st.Errors = c.dispatcher.Stats.Snapshot().Total()
+	if g := c.getGenerator(); g != nil {
+		st.Running = true
+		st.Paused = g.Paused()
+		st.Rate = g.Rate()
+		st.OpWeight = g.OpWeight()
+	}
+	if p := c.getPhase(); p != nil {
+		st.Phase = p.Name
+	}
+	return st
+}
+
+func (c *Controller) handleStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, errors.Errorf("method %s is not allowed", r.Method))
+		return
+	}
+	writeJSON(w, http.StatusOK, c.status())
+}
+
+func (c *Controller) handlePause(w http.ResponseWriter, r *http.Request) {
+	g, ok := c.generatorForUpdate(w, r)
+	if !ok {
+		return
+	}
+	g.Pause()
+	log.Info("generator is paused by control API")
+	writeJSON(w, http.StatusOK, c.status())
+}
+
+func (c *Controller) handleResume(w http.ResponseWriter, r *http.Request) {
+	g, ok := c.generatorForUpdate(w, r)
+	if !ok {
+		return
+	}
+	g.Resume()
+	log.Info("generator is resumed by control API")
+	writeJSON(w, http.StatusOK, c.status())
+}
+
+// handleRate changes rate with body `{"rate": 100}`
+func (c *Controller) handleRate(w http.ResponseWriter, r *http.Request) {
+	g, ok := c.generatorForUpdate(w, r)
+	if !ok {
+		return
+	}
+	var req struct {
+		Rate int `json:"rate"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, errors.Trace(err))
+		return
+	}
+	if err := g.SetRate(req.Rate); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	c.rateChanged.Set(true)
+	log.Infof("rate is changed to %d by control API", req.Rate)
+	writeJSON(w, http.StatusOK, c.status())
+}
+
+// handleOpWeight changes weights of operations with body `{"op-weight": [4, 2, 1, 0, 1, 1, 1]}`
+func (c *Controller) handleOpWeight(w http.ResponseWriter, r *http.Request) {
+	g, ok := c.generatorForUpdate(w, r)
+	if !ok {
+		return
+	}
+	var req struct {
+		OpWeight []int `json:"op-weight"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, errors.Trace(err))
+		return
+	}
+	if err := g.SetOpWeight(req.OpWeight); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	log.Infof("op-weight is changed to %v by control API", req.OpWeight)
+	writeJSON(w, http.StatusOK, c.status())
+}
+
+// generatorForUpdate checks the request method and returns the running generator
+func (c *Controller) generatorForUpdate(w http.ResponseWriter, r *http.Request) (*Generator, bool) {
+	if r.Method != http.MethodPost && r.Method != http.MethodPut {
+		writeError(w, http.StatusMethodNotAllowed, errors.Errorf("method %s is not allowed", r.Method))
+		return nil, false
+	}
+	g := c.getGenerator()
+	if g == nil {
+		writeError(w, http.StatusServiceUnavailable, errors.New("generator is not running"))
+		return nil, false
+	}
+	return g, true
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Errorf("write response error: %v", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, code int, err error) {
+	writeJSON(w, code, map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,79 @@
+package central
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/amyangfei/data-dam/pkg/models"
+)
+
+func TestControlAPI(t *testing.T) {
+	dir, err := ioutil.TempDir("", "data-dam")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	cfg := NewConfig()
+	cfg.DBConfig.Type = "sqlite"
+	cfg.DBConfig.SQLite = models.SQLiteConfig{Path: filepath.Join(dir, "dam.db")}
+	require.NoError(t, cfg.veirfy())
+
+	c := NewController(cfg)
+	c.dispatcher, err = models.NewJobDispatcher(context.Background(), 1, 1, &cfg.DBConfig, models.GetDBCreator("sqlite"))
+	require.NoError(t, err)
+	defer c.dispatcher.Close()
+
+	call := func(handler http.HandlerFunc, method, body string) (int, *Status) {
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest(method, "/", strings.NewReader(body)))
+		st := &Status{}
+		if w.Code == http.StatusOK {
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), st))
+		}
+		return w.Code, st
+	}
+
+	code, st := call(c.handleStatus, http.MethodGet, "")
+	assert.Equal(t, http.StatusOK, code)
+	assert.False(t, st.Running)
+	code, _ = call(c.handlePause, http.MethodPost, "")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+
+	g, err := NewGenerator(cfg, c.dispatcher)
+	require.NoError(t, err)
+	defer g.Close()
+	c.setPhase(g, nil)
+
+	code, st = call(c.handlePause, http.MethodPost, "")
+	assert.Equal(t, http.StatusOK, code)
+	assert.True(t, st.Running)
+	assert.True(t, st.Paused)
+	code, st = call(c.handleResume, http.MethodPost, "")
+	assert.Equal(t, http.StatusOK, code)
+	assert.False(t, st.Paused)
+
+	code, st = call(c.handleRate, http.MethodPost, `{"rate": 50}`)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, 50, st.Rate)
+	code, _ = call(c.handleRate, http.MethodPost, `{"rate": 0}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+	code, _ = call(c.handleRate, http.MethodGet, "")
+	assert.Equal(t, http.StatusMethodNotAllowed, code)
+
+	code, st = call(c.handleOpWeight, http.MethodPut, `{"op-weight": [1, 2]}`)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, []int{1, 2, 0, 0, 0, 0, 0, 0, 0}, st.OpWeight)
+	code, _ = call(c.handleOpWeight, http.MethodPut, `{"op-weight": [0, 0]}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+	code, _ = call(c.handleOpWeight, http.MethodPut, `{"op-weight": [1, 1, 1, 1, 1, 1, 1, 1, 1, 1]}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+}
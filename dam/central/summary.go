@@ -0,0 +1,92 @@
+package central
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pingcap/errors"
+
+	"github.com/amyangfei/data-dam/pkg/models"
+)
+
+// Summary is the report of a run
+type Summary struct {
+	Duration     float64 `json:"duration-seconds"`
+	TargetRate   int     `json:"target-rate,omitempty"` // 0 if the rate is changed by phases, rate profiles or control API
+	AchievedRate float64 `json:"achieved-rate"`
+	Total        int64   `json:"total"`
+	Errors       int64   `json:"errors"`
+
+	*models.StatsSnapshot
+}
+
+// NewSummary creates a summary from statistics of dispatcher, targetRate is the rate
+// limit of the whole run, 0 if it is not fixed.
+func NewSummary(targetRate int, stats *models.Stats, elapsed time.Duration) *Summary {
+	s := &Summary{
+		Duration:      elapsed.Seconds(),
+		TargetRate:    targetRate,
+		StatsSnapshot: stats.Snapshot(),
+	}
+	s.Total, s.Errors = s.StatsSnapshot.Total()
+	if elapsed > 0 {
+		s.AchievedRate = float64(s.Total) / elapsed.Seconds()
+	}
+	return s
+}
+
+// Print prints the summary in human readable format
+func (s *Summary) Print(w io.Writer) {
+	fmt.Fprintf(w, "duration: %.1fs, ", s.Duration)
+	if s.TargetRate > 0 {
+		fmt.Fprintf(w, "target rate: %d/s, ", s.TargetRate)
+	}
+	fmt.Fprintf(w, "achieved rate: %.1f/s, total: %d, errors: %d\n", s.AchievedRate, s.Total, s.Errors)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "type\tcount\terrors\tp50(ms)\tp95(ms)\tp99(ms)\tmax(ms)")
+	for _, op := range s.Ops {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%.2f\t%.2f\t%.2f\t%.2f\n",
+			op.Type, op.Count, op.Errors, op.P50, op.P95, op.P99, op.Max)
+	}
+	tw.Flush()
+
+	if s.Commits+s.Rollbacks > 0 {
+		fmt.Fprintf(w, "transactions: %d committed, %d rolled back\n", s.Commits, s.Rollbacks)
+	}
+	if len(s.ErrorCodes) > 0 {
+		fmt.Fprintln(w, "errors by code:")
+		printCounts(w, s.ErrorCodes)
+	}
+	if len(s.Tables) > 0 {
+		fmt.Fprintln(w, "jobs by table:")
+		printCounts(w, s.Tables)
+	}
+}
+
+// WriteJSON writes the summary to file in JSON format
+func (s *Summary) WriteJSON(path string) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return errors.Trace(err)
+	}
+	return errors.Trace(ioutil.WriteFile(path, data, 0644))
+}
+
+func printCounts(w io.Writer, counts map[string]int64) {
+	keys := make([]string, 0, len(counts))
+	for k := range counts {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, k := range keys {
+		fmt.Fprintf(tw, "  %s\t%d\n", k, counts[k])
+	}
+	tw.Flush()
+}
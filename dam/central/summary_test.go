@@ -0,0 +1,82 @@
+package central
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/amyangfei/data-dam/pkg/models"
+)
+
+func TestSummary(t *testing.T) {
+	cfg, _, cleanup := newSQLiteConfig(t, "CREATE TABLE t (id INTEGER PRIMARY KEY, name VARCHAR(32))")
+	defer cleanup()
+	cfg.Rate = 100
+	cfg.Concurrent = 2
+	require.NoError(t, cfg.veirfy())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	dispatcher := newTestDispatcher(ctx, t, cfg)
+	defer dispatcher.Close()
+	g := newTestGenerator(t, cfg, dispatcher)
+	defer g.Close()
+	counts := countOps(execute(ctx, t, g, repeatOps(10, models.Insert, models.Insert, models.Update, models.Delete)...))
+
+	summary := NewSummary(cfg.Rate, dispatcher.Stats, 2*time.Second)
+	assert.Equal(t, 2.0, summary.Duration)
+	assert.Equal(t, 100, summary.TargetRate)
+	assert.Equal(t, int64(40), summary.Total)
+	assert.Equal(t, int64(0), summary.Errors)
+	assert.Equal(t, 20.0, summary.AchievedRate)
+	assert.Equal(t, map[string]int64{"main.t": 40}, summary.Tables)
+	require.Len(t, summary.Ops, len(counts))
+	for _, op := range summary.Ops {
+		assert.Equal(t, counts[op.Type], op.Count, op.Type)
+		assert.True(t, op.P50 <= op.P99 && op.P99 <= op.Max)
+	}
+
+	var buf bytes.Buffer
+	summary.Print(&buf)
+	assert.Contains(t, buf.String(), "target rate: 100/s, achieved rate: 20.0/s, total: 40, errors: 0")
+}
+
+func TestSummaryTargetRate(t *testing.T) {
+	cfg := NewConfig()
+	cfg.Rate = 100
+	cfg.DBConfig.Type = "sqlite"
+	require.NoError(t, cfg.veirfy())
+	c := NewController(cfg)
+	assert.Equal(t, 100, c.targetRate())
+
+	var buf bytes.Buffer
+	NewSummary(c.targetRate(), models.NewStats(), time.Second).Print(&buf)
+	assert.Contains(t, buf.String(), "target rate: 100/s")
+
+	// rate changed by control API
+	c.rateChanged.Set(true)
+	assert.Zero(t, c.targetRate())
+
+	// phases with different rates
+	cfg = NewConfig()
+	cfg.Rate = 100
+	cfg.DBConfig.Type = "sqlite"
+	cfg.Phases = []*Phase{{Duration: "1s"}, {Rate: 200}}
+	require.NoError(t, cfg.veirfy())
+	assert.Zero(t, NewController(cfg).targetRate())
+
+	// rate profile
+	cfg = NewConfig()
+	cfg.DBConfig.Type = "sqlite"
+	cfg.RateProfile = RateProfile{{Type: PhaseHold, Rate: 10, Duration: "1s"}}
+	require.NoError(t, cfg.veirfy())
+	assert.Zero(t, NewController(cfg).targetRate())
+
+	buf.Reset()
+	NewSummary(0, models.NewStats(), time.Second).Print(&buf)
+	assert.NotContains(t, buf.String(), "target rate")
+}
@@ -2,88 +2,376 @@ package central
 
 import (
 	"context"
-	"math/rand"
+	"sync"
 	"time"
 
 	"github.com/pingcap/errors"
 	"github.com/smallnest/weighted"
 	"golang.org/x/time/rate"
 
+	"github.com/amyangfei/data-dam/pkg/log"
 	"github.com/amyangfei/data-dam/pkg/models"
 )
 
+const profileUpdateInterval = 100 * time.Millisecond
+
 // Generator is a database operation generator
 type Generator struct {
-	rate       int
 	db         models.DB
-	weight     weighted.W
 	dispatcher *models.JobDispatcher
 	cfg        *Config
+	limiter    *rate.Limiter
+
+	mu          sync.Mutex // protects fields below, which can be changed at runtime
+	weight      weighted.W
+	opWeight    []int
+	schemas     []string
+	paused      bool
+	resumeCh    chan struct{} // closed when generator is resumed
+	profile     RateProfile   // drives rate limiter over time if not empty, stopped when rate is set manually
+	rateSet     bool          // rate is set manually, which is kept in later phases
+	opWeightSet bool          // weights are set manually, which are kept in later phases
+
+	insertMu   sync.Mutex          // protects inserted and rolledBack
+	inserted   []insertedID        // ids assigned by database, tracked before the next DML is generated
+	rolledBack []*models.DMLParams // DMLs of rolled back transactions, untracked before the next DML is generated
+}
+
+// insertedID is the id assigned by database to a row inserted without its auto increment column
+type insertedID struct {
+	schema string
+	table  string
+	id     int64
 }
 
 // NewGenerator returns a new Generator
 func NewGenerator(cfg *Config, dispatcher *models.JobDispatcher) (*Generator, error) {
-
-	// FIXME: support MySQL only now
-	creator := models.GetDBCreator("mysql")
+	creator := models.GetDBCreator(cfg.DBConfig.Type)
 	db, err := creator.Create(&cfg.DBConfig)
 	if err != nil {
 		return nil, errors.Trace(err)
 	}
 
-	weight := &weighted.SW{}
-	for idx := range cfg.OpWeight {
-		weight.Add(models.RealOpType[idx], cfg.OpWeight[idx])
-	}
-
 	gen := &Generator{
-		rate:       cfg.Rate,
 		db:         db,
-		weight:     weight,
 		dispatcher: dispatcher,
 		cfg:        cfg,
+		limiter:    rate.NewLimiter(rate.Limit(cfg.Rate), 10),
+		schemas:    cfg.Schemas,
+		profile:    cfg.RateProfile,
+	}
+	gen.setOpWeight(cfg.OpWeight)
+	if dispatcher != nil && cfg.DBConfig.AutoIncrement {
+		dispatcher.SetInsertHook(gen.addInsertedID)
+	}
+	if dispatcher != nil && cfg.Txn.Size > 0 {
+		dispatcher.SetRollbackHook(gen.addRolledBack)
 	}
 	return gen, nil
 }
 
+// addInsertedID is called by workers of dispatcher, the id is tracked by the
+// generator goroutine because DB is not safe for concurrent use.
+func (g *Generator) addInsertedID(schema, table string, id int64) {
+	g.insertMu.Lock()
+	defer g.insertMu.Unlock()
+	g.inserted = append(g.inserted, insertedID{schema: schema, table: table, id: id})
+}
+
+// addRolledBack is called by workers of dispatcher like addInsertedID
+func (g *Generator) addRolledBack(dml *models.DMLParams) {
+	g.insertMu.Lock()
+	defer g.insertMu.Unlock()
+	g.rolledBack = append(g.rolledBack, dml)
+}
+
+func (g *Generator) trackInsertedIDs() {
+	g.insertMu.Lock()
+	inserted, rolledBack := g.inserted, g.rolledBack
+	g.inserted, g.rolledBack = nil, nil
+	g.insertMu.Unlock()
+	for _, ins := range inserted {
+		g.db.TrackInsertID(ins.schema, ins.table, ins.id)
+	}
+	for _, dml := range rolledBack {
+		g.db.UntrackDML(dml)
+	}
+}
+
+// Pause pauses generating operations, operations already dispatched are still executed
+func (g *Generator) Pause() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.paused {
+		return
+	}
+	g.paused = true
+	g.resumeCh = make(chan struct{})
+}
+
+// Resume resumes a paused generator
+func (g *Generator) Resume() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if !g.paused {
+		return
+	}
+	g.paused = false
+	close(g.resumeCh)
+}
+
+// Paused returns whether generator is paused
+func (g *Generator) Paused() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.paused
+}
+
+// waitResume blocks until generator is resumed or ctx is done
+func (g *Generator) waitResume(ctx context.Context) {
+	g.mu.Lock()
+	ch := g.resumeCh
+	paused := g.paused
+	g.mu.Unlock()
+	if !paused {
+		return
+	}
+	select {
+	case <-ch:
+	case <-ctx.Done():
+	}
+}
+
+// Rate returns the current rate limit
+func (g *Generator) Rate() int {
+	return int(g.limiter.Limit())
+}
+
+// SetRate changes rate limit of the running generator
+func (g *Generator) SetRate(r int) error {
+	if r <= 0 {
+		return errors.NotValidf("rate %d", r)
+	}
+	g.mu.Lock()
+	if len(g.profile) > 0 {
+		log.Info("rate profile is stopped because rate is set manually")
+		g.profile = nil
+	}
+	g.rateSet = true
+	g.mu.Unlock()
+	g.setLimit(float64(r))
+	return nil
+}
+
+func (g *Generator) setLimit(r float64) {
+	g.limiter.SetLimit(rate.Limit(r))
+	limiterRateGauge.Set(r)
+}
+
+// runProfile updates rate limiter according to rate profile until ctx is done
+// or the profile is stopped.
+func (g *Generator) runProfile(ctx context.Context) {
+	ticker := time.NewTicker(profileUpdateInterval)
+	defer ticker.Stop()
+	start := time.Now()
+	for {
+		g.mu.Lock()
+		profile := g.profile
+		if len(profile) > 0 {
+			g.setLimit(profile.RateAt(time.Since(start)))
+		}
+		g.mu.Unlock()
+		if len(profile) == 0 {
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// OpWeight returns the current weights of operations
+func (g *Generator) OpWeight() []int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return append([]int(nil), g.opWeight...)
+}
+
+// SetOpWeight replaces weights of operations, missing weights are zero
+func (g *Generator) SetOpWeight(weights []int) error {
+	weights, err := normalizeOpWeight(weights)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	err = checkSQLFileOpWeight(&g.cfg.DBConfig, weights)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	g.setOpWeight(weights)
+	g.mu.Lock()
+	g.opWeightSet = true
+	g.mu.Unlock()
+	return nil
+}
+
+func (g *Generator) setOpWeight(weights []int) {
+	weight := &weighted.SW{}
+	for idx := range weights {
+		weight.Add(models.RealOpType[idx], weights[idx])
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.weight = weight
+	g.opWeight = append([]int(nil), weights...)
+}
+
+// applyPhase switches generator to the rate, weights, schemas and rate profile of phase,
+// rate and weights set manually are kept instead. Table cache, next ids and live keys
+// are kept across phases.
+func (g *Generator) applyPhase(p *Phase) {
+	g.mu.Lock()
+	g.schemas = p.Schemas
+	rateSet, opWeightSet := g.rateSet, g.opWeightSet
+	if !rateSet {
+		g.profile = p.RateProfile
+	}
+	g.mu.Unlock()
+	if !rateSet {
+		g.setLimit(float64(p.Rate))
+	}
+	if !opWeightSet {
+		g.setOpWeight(p.OpWeight)
+	}
+}
+
+// normalizeOpWeight pads weights with zeros to the number of operation types
+func normalizeOpWeight(weights []int) ([]int, error) {
+	if len(weights) > len(models.RealOpType) {
+		return nil, errors.NotValidf("op-weight %v with more than %d weights", weights, len(models.RealOpType))
+	}
+	normalized := make([]int, len(models.RealOpType))
+	sum := 0
+	for idx, w := range weights {
+		if w < 0 {
+			return nil, errors.NotValidf("negative op-weight %v", weights)
+		}
+		normalized[idx] = w
+		sum += w
+	}
+	if sum == 0 {
+		return nil, errors.NotValidf("op-weight %v with all zeros", weights)
+	}
+	return normalized, nil
+}
+
+// checkSQLFileOpWeight checks no DDL is generated if DMLs are written to sql file, DDLs
+// in sql file are never executed so the table cache can't be refreshed from database.
+func checkSQLFileOpWeight(cfg *models.DBConfig, weights []int) error {
+	if cfg.SQLFile.Path == "" {
+		return nil
+	}
+	for idx := range weights {
+		if models.RealOpType[idx] == models.Ddl && weights[idx] > 0 {
+			return errors.NotSupportedf("DDL with sql-file output")
+		}
+	}
+	return nil
+}
+
+// Close closes the database used by generator
+func (g *Generator) Close() {
+	if err := g.db.Close(); err != nil {
+		log.Errorf("close generator database error: %v", err)
+	}
+}
+
 // Run starts generator's main loop
 func (g *Generator) Run(ctx context.Context) error {
-	var (
-		err error
-		rl  = rate.NewLimiter(rate.Limit(g.rate), 10)
-	)
-	for _, schema := range g.cfg.Schemas {
+	var err error
+	g.mu.Lock()
+	schemas, profile := g.schemas, g.profile
+	g.mu.Unlock()
+	limiterRateGauge.Set(float64(g.Rate()))
+	if len(profile) > 0 {
+		go g.runProfile(ctx)
+	}
+	g.db.SetSchemas(schemas)
+	for _, schema := range schemas {
 		_, _, err = g.db.PrepareTables(ctx, schema)
 		if err != nil {
 			return errors.Trace(err)
 		}
+		err = g.dispatcher.PrepareTables(ctx, schema)
+		if err != nil {
+			return errors.Trace(err)
+		}
 	}
-	rand.Seed(time.Now().UnixNano())
 	for {
-		err = rl.Wait(ctx)
+		g.waitResume(ctx)
+		err = g.limiter.Wait(ctx)
 		if err != nil {
-			if err == context.Canceled {
+			// limiter fails before ctx is done if the wait exceeds deadline of phase
+			_, hasDeadline := ctx.Deadline()
+			if ctx.Err() != nil || hasDeadline {
 				return nil
 			}
 			return errors.Trace(err)
 		}
-		params, err := g.Next(ctx)
+		opType, err := g.nextOpType()
+		if err != nil {
+			return errors.Trace(err)
+		}
+		if opType == models.Ddl {
+			err = g.runDDL(ctx)
+			if err != nil {
+				return errors.Trace(err)
+			}
+			continue
+		}
+		params, err := g.Next(ctx, opType)
 		if err != nil {
 			return errors.Trace(err)
 		}
+		generatedJobsCounter.WithLabelValues(params.Type.String(), params.Schema, params.Table).Inc()
 		g.dispatcher.AddDML(params)
 	}
 }
 
-// Next generates next database operation (DML only, DDL support is wip).
-// This function is not goroutine-safe.
-// You MUST use the snchronization primitive to protect it in concurrent cases.
-func (g *Generator) Next(ctx context.Context) (*models.DMLParams, error) {
+func (g *Generator) nextOpType() (models.OpType, error) {
+	g.mu.Lock()
 	val := g.weight.Next()
+	g.mu.Unlock()
 	opType, ok := val.(models.OpType)
 	if !ok {
-		return nil, errors.Errorf("get invalid optype: %v from weighted generator", val)
+		return opType, errors.Errorf("get invalid optype: %v from weighted generator", val)
+	}
+	return opType, nil
+}
+
+// runDDL generates a DDL, waits for it being executed by the dispatcher and
+// refreshes the table cache used by generator.
+func (g *Generator) runDDL(ctx context.Context) error {
+	ddl, err := g.db.GenerateDDL(ctx)
+	if err != nil {
+		return errors.Trace(err)
 	}
+	generatedJobsCounter.WithLabelValues(models.Ddl.String(), ddl.Schema, ddl.Table).Inc()
+	err = g.dispatcher.AddDDL(ddl)
+	if err != nil {
+		// the table is not changed, no need to refresh table cache
+		log.Warnf("execute DDL %s failed: %v", ddl.SQL, err)
+		return nil
+	}
+	return errors.Trace(g.db.RefreshTableCache(ctx, ddl))
+}
+
+// Next generates next DML operation of the given type.
+// This function is not goroutine-safe.
+// You MUST use the snchronization primitive to protect it in concurrent cases.
+func (g *Generator) Next(ctx context.Context, opType models.OpType) (*models.DMLParams, error) {
+	g.trackInsertedIDs()
 	params, err := g.db.GenerateDML(ctx, opType)
 	if err != nil {
 		return nil, errors.Trace(err)
@@ -0,0 +1,52 @@
+package central
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/amyangfei/data-dam/pkg/models"
+)
+
+func TestGeneratorAutoIncrement(t *testing.T) {
+	cfg, db, cleanup := newSQLiteConfig(t,
+		"CREATE TABLE t (id INTEGER PRIMARY KEY, name VARCHAR(32))",
+		"INSERT INTO t VALUES (1, 'a'), (3, 'b'), (8, 'c')")
+	defer cleanup()
+	cfg.Concurrent = 2
+	cfg.DBConfig.AutoIncrement = true
+	require.NoError(t, cfg.veirfy())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	dispatcher := newTestDispatcher(ctx, t, cfg)
+	defer dispatcher.Close()
+	g := newTestGenerator(t, cfg, dispatcher)
+	defer g.Close()
+
+	// live keys are loaded, then another writer inserts a row
+	_, err := g.Next(ctx, models.Update)
+	require.NoError(t, err)
+	_, err = db.Exec("INSERT INTO t VALUES (100, 'd')")
+	require.NoError(t, err)
+
+	p, err := g.Next(ctx, models.Insert)
+	require.NoError(t, err)
+	assert.Empty(t, p.Keys)
+	assert.NotContains(t, p.Values, "id")
+	dispatcher.AddDML(p)
+	dispatcher.Flush()
+
+	// the id assigned by database is tracked, the row of another writer is unknown
+	live := map[int64]bool{1: true, 3: true, 8: true, 101: true}
+	for len(live) > 0 {
+		p, err = g.Next(ctx, models.Delete)
+		require.NoError(t, err)
+		require.Equal(t, models.Delete, p.Type)
+		id := p.Keys["id"].(int64)
+		assert.True(t, live[id], id)
+		delete(live, id)
+	}
+}
@@ -0,0 +1,71 @@
+package dbutil
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/amyangfei/data-dam/pkg/models"
+)
+
+type testDialect struct{}
+
+func (testDialect) QuoteName(name string) string {
+	return "[" + name + "]"
+}
+
+func (testDialect) TableName(schema, name string) string {
+	return fmt.Sprintf("[%s].[%s]", schema, name)
+}
+
+func (testDialect) Placeholder(n int) string {
+	return fmt.Sprintf(":%d", n)
+}
+
+func (testDialect) IsIntegerColumn(column *models.Column) bool {
+	return column.Tp == "int"
+}
+
+func (testDialect) IsBinaryColumn(column *models.Column) bool {
+	return column.Tp == "blob"
+}
+
+func TestGenValueTuples(t *testing.T) {
+	var args []interface{}
+	rows := []map[string]interface{}{
+		{"a": 1, "b": "x"},
+		{"a": 2, "b": "y"},
+	}
+	tuples := GenValueTuples(testDialect{}, []string{"a", "b"}, rows, &args)
+	assert.Equal(t, []string{":1, :2", ":3, :4"}, tuples)
+	assert.Equal(t, []interface{}{1, "x", 2, "y"}, args)
+	assert.Equal(t, "[a], [b]", JoinNames(testDialect{}, []string{"a", "b"}))
+}
+
+func TestFieldNames(t *testing.T) {
+	fields := map[string]interface{}{"c": 1, "a": 2, "b": 3}
+	assert.Equal(t, []string{"a", "b", "c"}, FieldNames(fields, true))
+	assert.ElementsMatch(t, []string{"a", "b", "c"}, FieldNames(fields, false))
+}
+
+func TestUpdatedNames(t *testing.T) {
+	keys := map[string]interface{}{"id": 1}
+	assert.Equal(t, []string{"a", "b"}, UpdatedNames([]string{"id", "a", "b"}, keys))
+	assert.Equal(t, []string{"id"}, UpdatedNames([]string{"id"}, keys))
+}
+
+func TestKeyValue(t *testing.T) {
+	d := testDialect{}
+	assert.Equal(t, int64(-1), KeyValue(d, &models.Column{Tp: "int"}, []byte("-1")))
+	assert.Equal(t, uint64(1<<63), KeyValue(d, &models.Column{Tp: "int"}, []byte("9223372036854775808")))
+	assert.Equal(t, []byte("ab"), KeyValue(d, &models.Column{Tp: "blob"}, []byte("ab")))
+	assert.Equal(t, "ab", KeyValue(d, &models.Column{Tp: "text"}, []byte("ab")))
+	assert.Equal(t, int64(3), KeyValue(d, &models.Column{Tp: "text"}, int64(3)))
+}
+
+func TestIsLowCardinalityColumn(t *testing.T) {
+	assert.True(t, IsLowCardinalityColumn(&models.Column{Tp: "boolean"}))
+	assert.True(t, IsLowCardinalityColumn(&models.Column{Tp: "TINYINT"}))
+	assert.False(t, IsLowCardinalityColumn(&models.Column{Tp: "varchar"}))
+}
@@ -0,0 +1,25 @@
+// Package dbutil contains helpers shared by database backends, which are
+// independent of SQL dialect except for what a Dialect describes.
+package dbutil
+
+import (
+	"github.com/amyangfei/data-dam/pkg/models"
+)
+
+// Dialect describes quoting, placeholders and column types of a database
+type Dialect interface {
+	// QuoteName quotes an identifier, such as a column name.
+	QuoteName(name string) string
+
+	// TableName returns the quoted name of table with schema.
+	TableName(schema, name string) string
+
+	// Placeholder returns the placeholder of the n-th argument of a statement, n starts from 1.
+	Placeholder(n int) string
+
+	// IsIntegerColumn checks whether column is of an integer type.
+	IsIntegerColumn(column *models.Column) bool
+
+	// IsBinaryColumn checks whether column stores bytes.
+	IsBinaryColumn(column *models.Column) bool
+}
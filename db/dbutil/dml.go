@@ -0,0 +1,56 @@
+package dbutil
+
+import (
+	"sort"
+	"strings"
+)
+
+// UpdatedNames returns names of non-key fields updated by an upsert, or all names if
+// every field is a key, so that the statement always has an update clause.
+func UpdatedNames(names []string, keys map[string]interface{}) []string {
+	updated := make([]string, 0, len(names))
+	for _, name := range names {
+		if _, ok := keys[name]; !ok {
+			updated = append(updated, name)
+		}
+	}
+	if len(updated) == 0 {
+		return names
+	}
+	return updated
+}
+
+// GenValueTuples returns placeholders of fields of every row, such as `?, ?`, and appends values to args
+func GenValueTuples(d Dialect, names []string, rows []map[string]interface{}, args *[]interface{}) []string {
+	tuples := make([]string, 0, len(rows))
+	for _, row := range rows {
+		holders := make([]string, 0, len(names))
+		for _, name := range names {
+			*args = append(*args, row[name])
+			holders = append(holders, d.Placeholder(len(*args)))
+		}
+		tuples = append(tuples, strings.Join(holders, ", "))
+	}
+	return tuples
+}
+
+// JoinNames quotes names and joins them with commas
+func JoinNames(d Dialect, names []string) string {
+	quoted := make([]string, 0, len(names))
+	for _, name := range names {
+		quoted = append(quoted, d.QuoteName(name))
+	}
+	return strings.Join(quoted, ", ")
+}
+
+// FieldNames returns names of fields, which are sorted if sorted is set
+func FieldNames(fields map[string]interface{}, sorted bool) []string {
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	if sorted {
+		sort.Strings(names)
+	}
+	return names
+}
@@ -0,0 +1,138 @@
+package dbutil
+
+import (
+	"database/sql"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+
+	"github.com/pingcap/errors"
+
+	"github.com/amyangfei/data-dam/pkg/models"
+	"github.com/amyangfei/data-dam/pkg/utils"
+)
+
+// FindColumn returns the column named name, nil if there is no such column
+func FindColumn(columns []*models.Column, name string) *models.Column {
+	for _, column := range columns {
+		if column.Name == name {
+			return column
+		}
+	}
+
+	return nil
+}
+
+// FindColumns maps column names of each index to columns, unknown names are skipped
+func FindColumns(columns []*models.Column, indexColumns map[string][]string) map[string][]*models.Column {
+	result := make(map[string][]*models.Column)
+
+	for keyName, indexCols := range indexColumns {
+		cols := make([]*models.Column, 0, len(indexCols))
+		for _, name := range indexCols {
+			column := FindColumn(columns, name)
+			if column != nil {
+				cols = append(cols, column)
+			}
+		}
+		result[keyName] = cols
+	}
+
+	return result
+}
+
+// HasIndex checks whether table has a unique or non-unique index named name
+func HasIndex(table *models.Table, name string) bool {
+	_, ok := table.IndexColumns[name]
+	if ok {
+		return true
+	}
+	_, ok = table.NonUniqueIndexColumns[name]
+	return ok
+}
+
+// GenColumnName generates a column name which is not in the table
+func GenColumnName(rnd *rand.Rand, table *models.Table) string {
+	for {
+		name := "c_" + strings.ToLower(utils.RandomString(rnd, 8))
+		if FindColumn(table.Columns, name) == nil {
+			return name
+		}
+	}
+}
+
+// IsLowCardinalityColumn checks whether random values of a column are likely
+// to be duplicated, such a column is not suitable for unique index
+func IsLowCardinalityColumn(column *models.Column) bool {
+	switch strings.ToUpper(column.Tp) {
+	case "TINYINT", "BOOL", "BOOLEAN", "BIT", "ENUM", "SET", "YEAR":
+		return true
+	}
+	return false
+}
+
+// KeyValue converts a scanned value of key column to the type of generated values
+func KeyValue(d Dialect, column *models.Column, value interface{}) interface{} {
+	b, ok := value.([]byte)
+	if !ok {
+		return value
+	}
+	switch {
+	case d.IsIntegerColumn(column):
+		if v, err := strconv.ParseInt(string(b), 10, 64); err == nil {
+			return v
+		}
+		if v, err := strconv.ParseUint(string(b), 10, 64); err == nil {
+			return v
+		}
+		return string(b)
+	case d.IsBinaryColumn(column):
+		return b
+	default:
+		return string(b)
+	}
+}
+
+// GetKeys returns keys of all rows in table ordered by key columns,
+// rows with NULL in key columns are skipped.
+func GetKeys(db *sql.DB, d Dialect, table *models.Table) ([]interface{}, error) {
+	columns := table.KeyColumns()
+	if len(columns) == 0 {
+		return nil, nil
+	}
+	names := make([]string, 0, len(columns))
+	for _, column := range columns {
+		names = append(names, column.Name)
+	}
+	joined := JoinNames(d, names)
+	stmt := fmt.Sprintf("SELECT %s FROM %s ORDER BY %s", joined, d.TableName(table.Schema, table.Name), joined)
+	rows, err := db.Query(stmt)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	defer rows.Close()
+
+	var (
+		keys   = make([]interface{}, 0)
+		values = make([]interface{}, len(columns))
+		dest   = make([]interface{}, len(columns))
+	)
+	for idx := range values {
+		dest[idx] = &values[idx]
+	}
+	for rows.Next() {
+		if err := rows.Scan(dest...); err != nil {
+			return nil, errors.Trace(err)
+		}
+		valid := true
+		for idx, column := range columns {
+			values[idx] = KeyValue(d, column, values[idx])
+			valid = valid && values[idx] != nil
+		}
+		if valid {
+			keys = append(keys, models.EncodeKey(values))
+		}
+	}
+	return keys, errors.Trace(rows.Err())
+}
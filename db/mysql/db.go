@@ -10,6 +10,7 @@ import (
 
 	"github.com/pingcap/errors"
 
+	"github.com/amyangfei/data-dam/db/dbutil"
 	"github.com/amyangfei/data-dam/pkg/models"
 )
 
@@ -19,14 +20,15 @@ const (
 
 // ImpMySQLDB implements models.DB
 type ImpMySQLDB struct {
+	*models.Workload
+
 	db         *sql.DB
+	tx         *sql.Tx // transaction started by Begin, DMLs are executed in it if not nil
 	verbose    bool
 	sortFields bool
-
-	entries      []string                 // table name cache: a `schema`.`table` slice
-	tables       map[string]*models.Table // table cache: `schema`.`table` -> table
-	cacheColumns map[string][]string      // table columns cache: `schema`.`table` -> column names list
-	nextIDs      map[string]int64         // table next id cache: `schema`.`table` -> next primary id
+	ddlTypes   []models.DDLType
+	rnd        *rand.Rand // random source of generated DDL, shared with Workload
+	sink       *sqlSink   // writes DML to sql file instead of executing if not nil
 }
 
 type mysqlCreator struct {
@@ -51,12 +53,21 @@ func createDB(cfg models.MySQLConfig) (*sql.DB, error) {
 // Create creates a models.DB
 func (c mysqlCreator) Create(cfg *models.DBConfig) (models.DB, error) {
 	md := &ImpMySQLDB{
-		sortFields:   cfg.SortFields,
-		verbose:      cfg.Verbose,
-		entries:      make([]string, 0),
-		tables:       make(map[string]*models.Table),
-		cacheColumns: make(map[string][]string),
-		nextIDs:      make(map[string]int64),
+		sortFields: cfg.SortFields,
+		verbose:    cfg.Verbose,
+		ddlTypes:   defaultDDLTypes,
+		rnd:        rand.New(rand.NewSource(cfg.Seed)),
+	}
+	if len(cfg.DDLTypes) > 0 {
+		ddlTypes, err := models.ParseDDLTypes(cfg.DDLTypes)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		md.ddlTypes = ddlTypes
+	}
+	// ids assigned by database are unknown when DMLs are written to sql files
+	if cfg.SQLFile.Path != "" && cfg.AutoIncrement {
+		return nil, errors.NotSupportedf("auto-increment with sql-file output")
 	}
 	db, err := createDB(cfg.MySQL)
 	if err != nil {
@@ -65,35 +76,20 @@ func (c mysqlCreator) Create(cfg *models.DBConfig) (models.DB, error) {
 		}
 		return nil, errors.Trace(err)
 	}
-	md.db = db
-	return md, nil
-}
-
-func (md *ImpMySQLDB) clearTableCache(schema, table string) {
-	key := TableName(schema, table)
-	for i := range md.entries {
-		if md.entries[i] == key {
-			md.entries = append(md.entries[:i], md.entries[i+1:]...)
-			break
+	// table structures, max ids and keys of existing rows are read from database even if
+	// DMLs are written to sql files, the connection is checked here instead of at the first query.
+	if cfg.SQLFile.Path != "" {
+		if err = db.Ping(); err != nil {
+			db.Close()
+			return nil, errors.Annotatef(err, "sql-file output requires a database with the tables, %s:%d", cfg.MySQL.Host, cfg.MySQL.Port)
 		}
 	}
-	delete(md.tables, key)
-	delete(md.cacheColumns, key)
-	delete(md.nextIDs, key)
-}
-
-func (md *ImpMySQLDB) clearAllTableCache() {
-	md.entries = make([]string, 0)
-	md.tables = make(map[string]*models.Table)
-	md.cacheColumns = make(map[string][]string)
-	md.nextIDs = make(map[string]int64)
-}
-
-func (md *ImpMySQLDB) getNextID(schema, table string) int64 {
-	key := TableName(schema, table)
-	nextID := md.nextIDs[key]
-	md.nextIDs[key] = nextID + 1
-	return nextID
+	md.db = db
+	md.Workload = models.NewWorkload(tableSource{db: db, offline: cfg.SQLFile.Path != ""}, md.rnd, cfg)
+	if cfg.SQLFile.Path != "" {
+		md.sink = openSQLSink(cfg.SQLFile)
+	}
+	return md, nil
 }
 
 func genSetFields(values map[string]interface{}, args *[]interface{}) string {
@@ -134,85 +130,101 @@ func genWhere(keys map[string]interface{}, args *[]interface{}) string {
 	return buf.String()
 }
 
-// PrepareTables implements `PrepareTables` of modes.DB
-func (md *ImpMySQLDB) PrepareTables(ctx context.Context, schema string) ([]*models.Table, [][]string, error) {
-	names, err := findTables(md.db, schema)
-	if err != nil {
-		return nil, nil, errors.Trace(err)
-	}
+// genPlainSQL replaces placeholders in statement with escaped literal values
+func (md *ImpMySQLDB) genPlainSQL(stmt string, args []interface{}) string {
 	var (
-		tables      = make([]*models.Table, 0, len(names))
-		columnNames = make([][]string, 0, len(names))
+		buf strings.Builder
+		idx = 0
 	)
-	for _, name := range names {
-		t, columnName, err := md.GetTable(ctx, schema, name)
-		if err != nil {
-			return nil, nil, errors.Trace(err)
+	buf.Grow(len(stmt))
+	for i := 0; i < len(stmt); i++ {
+		if stmt[i] != '?' || idx >= len(args) {
+			buf.WriteByte(stmt[i])
+			continue
 		}
-		tables = append(tables, t)
-		columnNames = append(columnNames, columnName)
+		buf.WriteString(formatValue(args[idx]))
+		idx++
 	}
-	return tables, columnNames, nil
+	return buf.String()
 }
 
-// GetTable implements `GetTable` of models.DB
-func (md *ImpMySQLDB) GetTable(ctx context.Context, schema, table string) (*models.Table, []string, error) {
-	key := TableName(schema, table)
+// executor executes statements in *sql.DB or *sql.Tx
+type executor interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
 
-	value, ok := md.tables[key]
-	if ok {
-		return value, md.cacheColumns[key], nil
+func (md *ImpMySQLDB) executor() executor {
+	if md.tx != nil {
+		return md.tx
 	}
+	return md.db
+}
 
-	t, err := getTableFromDB(md.db, schema, table)
+// Begin implements `Begin` of models.DB
+func (md *ImpMySQLDB) Begin(_ context.Context) error {
+	if md.tx != nil {
+		return errors.New("transaction is already started")
+	}
+	// jobs in progress are finished when dispatcher is canceled, so the transaction is not bound to ctx
+	tx, err := md.db.Begin()
 	if err != nil {
-		return nil, nil, errors.Trace(err)
+		return errors.Trace(err)
 	}
+	md.tx = tx
+	return nil
+}
 
-	// compute cache column list for column mapping
-	columns := make([]string, 0, len(t.Columns))
-	for _, c := range t.Columns {
-		columns = append(columns, c.Name)
+// Commit implements `Commit` of models.DB
+func (md *ImpMySQLDB) Commit(_ context.Context) error {
+	if md.tx == nil {
+		return errors.New("transaction is not started")
 	}
+	err := md.tx.Commit()
+	md.tx = nil
+	return errors.Trace(err)
+}
 
-	nextID, err := getMaxID(md.db, schema, table)
-	nextID++
-	if err != nil {
-		return nil, nil, errors.Trace(err)
+// Rollback implements `Rollback` of models.DB
+func (md *ImpMySQLDB) Rollback(_ context.Context) error {
+	if md.tx == nil {
+		return errors.New("transaction is not started")
 	}
-
-	md.entries = append(md.entries, key)
-	md.tables[key] = t
-	md.cacheColumns[key] = columns
-	md.nextIDs[key] = nextID
-	return t, columns, nil
+	err := md.tx.Rollback()
+	md.tx = nil
+	return errors.Trace(err)
 }
 
-func (md *ImpMySQLDB) genPlainSQL(stmt string, args []interface{}) string {
-	for _, arg := range args {
-		if arg == nil {
-			stmt = strings.Replace(stmt, "?", "NULL", 1)
-		} else {
-			switch arg.(type) {
-			case int, int32, int64:
-				stmt = strings.Replace(stmt, "?", fmt.Sprintf("%d", arg), 1)
-			case float32, float64:
-				stmt = strings.Replace(stmt, "?", fmt.Sprintf("%f", arg), 1)
-			default:
-				stmt = strings.Replace(stmt, "?", fmt.Sprintf("'%s'", arg), 1)
-			}
+// execSQL executes a DML statement, or writes the rendered statement to sql file.
+// returns the last insert id of the statement, which is 0 in sql file mode.
+func (md *ImpMySQLDB) execSQL(stmt string, args []interface{}) (int64, error) {
+	var (
+		id  int64
+		err error
+	)
+	if md.sink != nil {
+		err = md.sink.writeDML(md.genPlainSQL(stmt, args))
+	} else {
+		var res sql.Result
+		res, err = md.executor().Exec(stmt, args...)
+		if err == nil {
+			id, err = res.LastInsertId()
 		}
 	}
-	return stmt
+
+	if md.verbose {
+		fmt.Println(md.genPlainSQL(stmt, args))
+	}
+
+	return id, errors.Trace(err)
 }
 
 // Insert implements `Insert` of models.DB
-func (md *ImpMySQLDB) Insert(_ context.Context, schema, table string, values map[string]interface{}) error {
+func (md *ImpMySQLDB) Insert(_ context.Context, schema, table string, values map[string]interface{}) (int64, error) {
 	var (
 		args        = make([]interface{}, 0, len(values))
 		buf, valbuf strings.Builder
 		idx         = 0
-		err         error
 	)
 
 	build := func(key string, value interface{}) {
@@ -242,13 +254,112 @@ func (md *ImpMySQLDB) Insert(_ context.Context, schema, table string, values map
 		}
 	}
 	stmt := fmt.Sprintf("INSERT INTO `%s`.`%s` (%s) VALUES (%s);", schema, table, buf.String(), valbuf.String())
-	_, err = md.db.Exec(stmt, args...)
+	id, err := md.execSQL(stmt, args)
+	return id, errors.Trace(err)
+}
 
-	if md.verbose {
-		stmt = md.genPlainSQL(stmt, args)
-		fmt.Println(stmt)
+// Upsert implements `Upsert` of models.DB
+func (md *ImpMySQLDB) Upsert(_ context.Context, tp models.OpType, schema, table string, keys map[string]interface{}, values map[string]interface{}) error {
+	var (
+		names  = dbutil.FieldNames(values, md.sortFields)
+		args   = make([]interface{}, 0, len(names))
+		tuple  = dbutil.GenValueTuples(dialect{}, names, []map[string]interface{}{values}, &args)[0]
+		target = fmt.Sprintf("%s (%s) VALUES (%s)", TableName(schema, table), dbutil.JoinNames(dialect{}, names), tuple)
+		stmt   string
+	)
+	switch tp {
+	case models.Replace:
+		stmt = fmt.Sprintf("REPLACE INTO %s;", target)
+	case models.Upsert:
+		assigns := make([]string, 0, len(names))
+		for _, name := range dbutil.UpdatedNames(names, keys) {
+			quoted := "`" + escapeName(name) + "`"
+			assigns = append(assigns, fmt.Sprintf("%s = VALUES(%s)", quoted, quoted))
+		}
+		stmt = fmt.Sprintf("INSERT INTO %s ON DUPLICATE KEY UPDATE %s;", target, strings.Join(assigns, ", "))
+	case models.InsertIgnore:
+		stmt = fmt.Sprintf("INSERT IGNORE INTO %s;", target)
+	default:
+		return errors.NotValidf("upsert OpType %s", tp)
+	}
+	_, err := md.execSQL(stmt, args)
+	return errors.Trace(err)
+}
+
+// RangeUpdate implements `RangeUpdate` of models.DB
+func (md *ImpMySQLDB) RangeUpdate(_ context.Context, schema, table string, rng *models.RangeParams, values map[string]interface{}) error {
+	args := make([]interface{}, 0, len(values)+2)
+	kvs := genSetFields(values, &args)
+	where := genRangeWhere(rng, &args)
+	stmt := fmt.Sprintf("UPDATE %s SET %s WHERE %s%s;", TableName(schema, table), kvs, where, genLimit(rng))
+	_, err := md.execSQL(stmt, args)
+	return errors.Trace(err)
+}
+
+// RangeDelete implements `RangeDelete` of models.DB
+func (md *ImpMySQLDB) RangeDelete(_ context.Context, schema, table string, rng *models.RangeParams) error {
+	args := make([]interface{}, 0, 2)
+	where := genRangeWhere(rng, &args)
+	stmt := fmt.Sprintf("DELETE FROM %s WHERE %s%s;", TableName(schema, table), where, genLimit(rng))
+	_, err := md.execSQL(stmt, args)
+	return errors.Trace(err)
+}
+
+// genRangeWhere generates the condition of rng, such as "`id` BETWEEN ? AND ?" or "`c` = ?"
+func genRangeWhere(rng *models.RangeParams, args *[]interface{}) string {
+	if rng.End == nil {
+		return genWhere(map[string]interface{}{rng.Column: rng.Begin}, args)
+	}
+	*args = append(*args, rng.Begin, rng.End)
+	return fmt.Sprintf("`%s` BETWEEN ? AND ?", escapeName(rng.Column))
+}
+
+func genLimit(rng *models.RangeParams) string {
+	if rng.Limit <= 0 {
+		return ""
+	}
+	return fmt.Sprintf(" LIMIT %d", rng.Limit)
+}
+
+// BatchInsert implements `BatchInsert` of models.DB
+func (md *ImpMySQLDB) BatchInsert(_ context.Context, schema, table string, rows []map[string]interface{}) error {
+	if len(rows) == 0 {
+		return nil
+	}
+	var (
+		names  = dbutil.FieldNames(rows[0], md.sortFields)
+		args   = make([]interface{}, 0, len(names)*len(rows))
+		tuples = dbutil.GenValueTuples(dialect{}, names, rows, &args)
+	)
+	for idx := range tuples {
+		tuples[idx] = "(" + tuples[idx] + ")"
 	}
+	stmt := fmt.Sprintf("INSERT INTO %s (%s) VALUES %s;",
+		TableName(schema, table), dbutil.JoinNames(dialect{}, names), strings.Join(tuples, ", "))
+	_, err := md.execSQL(stmt, args)
+	return errors.Trace(err)
+}
 
+// BatchDelete implements `BatchDelete` of models.DB
+func (md *ImpMySQLDB) BatchDelete(_ context.Context, schema, table string, keys []map[string]interface{}) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	var (
+		names  = dbutil.FieldNames(keys[0], md.sortFields)
+		args   = make([]interface{}, 0, len(names)*len(keys))
+		tuples = dbutil.GenValueTuples(dialect{}, names, keys, &args)
+		target = dbutil.JoinNames(dialect{}, names)
+	)
+	// composite keys are compared as row values, such as `(a, b) IN ((?, ?), (?, ?))`
+	if len(names) > 1 {
+		target = "(" + target + ")"
+		for idx := range tuples {
+			tuples[idx] = "(" + tuples[idx] + ")"
+		}
+	}
+	stmt := fmt.Sprintf("DELETE FROM %s WHERE %s IN (%s);", TableName(schema, table), target, strings.Join(tuples, ", "))
+	_, err := md.execSQL(stmt, args)
 	return errors.Trace(err)
 }
 
@@ -258,13 +369,7 @@ func (md *ImpMySQLDB) Update(_ context.Context, schema, table string, keys map[s
 	kvs := genSetFields(values, &args)
 	where := genWhere(keys, &args)
 	stmt := fmt.Sprintf("UPDATE `%s`.`%s` SET %s WHERE %s;", schema, table, kvs, where)
-	_, err := md.db.Exec(stmt, args...)
-
-	if md.verbose {
-		stmt = md.genPlainSQL(stmt, args)
-		fmt.Println(stmt)
-	}
-
+	_, err := md.execSQL(stmt, args)
 	return errors.Trace(err)
 }
 
@@ -273,134 +378,32 @@ func (md *ImpMySQLDB) Delete(_ context.Context, schema, table string, keys map[s
 	args := make([]interface{}, 0, len(keys))
 	where := genWhere(keys, &args)
 	stmt := fmt.Sprintf("DELETE FROM `%s`.`%s` WHERE %s;", schema, table, where)
-	_, err := md.db.Exec(stmt, args...)
-
-	if md.verbose {
-		stmt = md.genPlainSQL(stmt, args)
-		fmt.Println(stmt)
-	}
+	_, err := md.execSQL(stmt, args)
+	return errors.Trace(err)
+}
 
+// Exec implements `Exec` of models.DB
+func (md *ImpMySQLDB) Exec(_ context.Context, stmt string) error {
+	_, err := md.execSQL(stmt, nil)
 	return errors.Trace(err)
 }
 
 // Close implements `Close` of models.DB
 func (md *ImpMySQLDB) Close() error {
-	if md.db != nil {
-		err := md.db.Close()
+	if md.sink != nil {
+		err := md.sink.close()
+		md.sink = nil
 		if err != nil {
 			return errors.Trace(err)
 		}
 	}
-	return nil
-}
-
-// GenerateDML implements `GenerateDML` of models.DB
-func (md *ImpMySQLDB) GenerateDML(_ context.Context, opType models.OpType) (*models.DMLParams, error) {
-	if len(md.entries) == 0 {
-		return nil, errors.New("ImpMySQLDB has no table cache")
-	}
-	entry := md.entries[rand.Intn(len(md.entries))]
-	table, ok := md.tables[entry]
-	if !ok {
-		return nil, errors.Errorf("%s not in table cache", entry)
-	}
-	var (
-		params *models.DMLParams
-		err    error
-	)
-	switch opType {
-	case models.Insert:
-		params, err = md.genInsertSQL(table)
-	case models.Update:
-		params, err = md.genUpdateSQL(table)
-	case models.Delete:
-		params, err = md.genDeleteSQL(table)
-	default:
-		return nil, errors.NotValidf("DML OpType: %d", opType)
-	}
-	if err != nil {
-		return nil, errors.Trace(err)
-	}
-	return params, nil
-}
-
-func (md *ImpMySQLDB) genInsertSQL(table *models.Table) (*models.DMLParams, error) {
-	var err error
-	id := md.getNextID(table.Schema, table.Name)
-	keys := map[string]interface{}{
-		"id": id,
-	}
-	values := map[string]interface{}{
-		"id": id,
-	}
-	for _, column := range table.Columns {
-		if column.Name == "id" {
-			continue
-		}
-		values[column.Name], err = genRandomValue(column)
+	if md.db != nil {
+		err := md.db.Close()
 		if err != nil {
-			return nil, errors.Trace(err)
-		}
-	}
-	params := &models.DMLParams{
-		Type:   models.Insert,
-		Schema: table.Schema,
-		Table:  table.Name,
-		Keys:   keys,
-		Values: values,
-	}
-	return params, nil
-}
-
-func (md *ImpMySQLDB) genUpdateSQL(table *models.Table) (*models.DMLParams, error) {
-	id, err := getRandID(md.db, table.Schema, table.Name)
-	if err != nil {
-		return nil, errors.Trace(err)
-	}
-	keys := map[string]interface{}{
-		"id": id,
-	}
-	var column *models.Column
-	// FIXME: better column selection and way to avoid infinite loop
-	for {
-		column = table.Columns[rand.Intn(len(table.Columns))]
-		if column.Name != "id" && column.Key != "PRI" && column.Key != "UNI" {
-			break
+			return errors.Trace(err)
 		}
 	}
-	value, err := genRandomValue(column)
-	if err != nil {
-		return nil, errors.Trace(err)
-	}
-	values := map[string]interface{}{
-		column.Name: value,
-	}
-
-	params := &models.DMLParams{
-		Type:   models.Update,
-		Schema: table.Schema,
-		Table:  table.Name,
-		Keys:   keys,
-		Values: values,
-	}
-	return params, nil
-}
-
-func (md *ImpMySQLDB) genDeleteSQL(table *models.Table) (*models.DMLParams, error) {
-	id, err := getRandID(md.db, table.Schema, table.Name)
-	if err != nil {
-		return nil, errors.Trace(err)
-	}
-	keys := map[string]interface{}{
-		"id": id,
-	}
-	params := &models.DMLParams{
-		Type:   models.Delete,
-		Schema: table.Schema,
-		Table:  table.Name,
-		Keys:   keys,
-	}
-	return params, nil
+	return nil
 }
 
 func init() {
@@ -0,0 +1,491 @@
+package mysql
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pingcap/errors"
+
+	"github.com/amyangfei/data-dam/db/dbutil"
+	"github.com/amyangfei/data-dam/pkg/models"
+	"github.com/amyangfei/data-dam/pkg/utils"
+)
+
+var (
+	// defaultDDLTypes contains DDL types generated if `ddl-types` is not configured
+	defaultDDLTypes = []models.DDLType{
+		models.AddColumn,
+		models.DropColumn,
+		models.CreateIndex,
+		models.DropIndex,
+		models.ModifyColumn,
+		models.ChangeColumn,
+	}
+
+	// addColumnTypes contains column definitions used in ADD COLUMN, all of
+	// them must be supported by `genRandomValue`
+	addColumnTypes = []string{
+		"TINYINT",
+		"SMALLINT",
+		"INT",
+		"BIGINT",
+		"DOUBLE",
+		"DECIMAL(20,5)",
+		"DATETIME",
+		"CHAR(16)",
+		"VARCHAR(64)",
+		"TEXT",
+	}
+)
+
+// GenerateDDL implements `GenerateDDL` of models.DB
+func (md *ImpMySQLDB) GenerateDDL(_ context.Context) (*models.DDLParams, error) {
+	table, err := md.RandomTable()
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	var params *models.DDLParams
+	switch md.ddlTypes[md.rnd.Intn(len(md.ddlTypes))] {
+	case models.AddColumn:
+		params, err = md.genAddColumnDDL(table)
+	case models.DropColumn:
+		params, err = md.genDropColumnDDL(table)
+	case models.CreateIndex:
+		params, err = md.genCreateIndexDDL(table)
+	case models.DropIndex:
+		params, err = md.genDropIndexDDL(table)
+	case models.CreateTable:
+		params, err = md.genCreateTableDDL(table.Schema)
+	case models.DropTable:
+		params, err = md.genDropTableDDL(table)
+	case models.TruncateTable:
+		params, err = md.genTruncateTableDDL(table)
+	case models.RenameTable:
+		params, err = md.genRenameTableDDL(table)
+	case models.ModifyColumn:
+		params, err = md.genModifyColumnDDL(table)
+	case models.ChangeColumn:
+		params, err = md.genChangeColumnDDL(table)
+	}
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	// falls back to ADD COLUMN if the chosen DDL can't be applied to the table
+	if params == nil {
+		params, err = md.genAddColumnDDL(table)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+	}
+	return params, nil
+}
+
+// ExecDDL implements `ExecDDL` of models.DB
+func (md *ImpMySQLDB) ExecDDL(_ context.Context, ddl *models.DDLParams) error {
+	var err error
+	// DDL is only written if writing to sql file, the database is never changed
+	if md.sink != nil {
+		err = md.sink.writeDDL(ddl.SQL)
+	} else {
+		_, err = md.db.Exec(ddl.SQL)
+	}
+
+	if md.verbose {
+		fmt.Println(ddl.SQL)
+	}
+
+	return errors.Trace(err)
+}
+
+func (md *ImpMySQLDB) genAddColumnDDL(table *models.Table) (*models.DDLParams, error) {
+	name := dbutil.GenColumnName(md.rnd, table)
+	tp := addColumnTypes[md.rnd.Intn(len(addColumnTypes))]
+	params := &models.DDLParams{
+		Type:   models.AddColumn,
+		Schema: table.Schema,
+		Table:  table.Name,
+		SQL:    fmt.Sprintf("ALTER TABLE %s ADD COLUMN `%s` %s NULL;", TableName(table.Schema, table.Name), name, tp),
+	}
+	return params, nil
+}
+
+// genDropColumnDDL returns nil if no column can be dropped safely
+func (md *ImpMySQLDB) genDropColumnDDL(table *models.Table) (*models.DDLParams, error) {
+	candidates := make([]*models.Column, 0, len(table.Columns))
+	for _, column := range table.Columns {
+		if isDroppableColumn(table, column) {
+			candidates = append(candidates, column)
+		}
+	}
+	// keep at least one non-key column, which is required by update generation
+	if len(candidates) < 2 {
+		return nil, nil
+	}
+	column := candidates[md.rnd.Intn(len(candidates))]
+	params := &models.DDLParams{
+		Type:   models.DropColumn,
+		Schema: table.Schema,
+		Table:  table.Name,
+		SQL:    fmt.Sprintf("ALTER TABLE %s DROP COLUMN `%s`;", TableName(table.Schema, table.Name), escapeName(column.Name)),
+	}
+	return params, nil
+}
+
+// genModifyColumnDDL widens the type of a column, returns nil if no column can be widened
+func (md *ImpMySQLDB) genModifyColumnDDL(table *models.Table) (*models.DDLParams, error) {
+	var (
+		candidates = make([]*models.Column, 0, len(table.Columns))
+		newTypes   = make([]string, 0, len(table.Columns))
+	)
+	for _, column := range table.Columns {
+		if column.Extra != "" {
+			continue
+		}
+		tp, ok := widenColumnType(column, isIndexedColumn(table, column))
+		if ok {
+			candidates = append(candidates, column)
+			newTypes = append(newTypes, tp)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil, nil
+	}
+	idx := md.rnd.Intn(len(candidates))
+	column := candidates[idx]
+	params := &models.DDLParams{
+		Type:   models.ModifyColumn,
+		Schema: table.Schema,
+		Table:  table.Name,
+		SQL: fmt.Sprintf("ALTER TABLE %s MODIFY COLUMN `%s` %s %s;",
+			TableName(table.Schema, table.Name), escapeName(column.Name), newTypes[idx], columnNullable(column)),
+	}
+	return params, nil
+}
+
+// genChangeColumnDDL renames a column and keeps its type, returns nil if no column can be renamed
+func (md *ImpMySQLDB) genChangeColumnDDL(table *models.Table) (*models.DDLParams, error) {
+	candidates := make([]*models.Column, 0, len(table.Columns))
+	for _, column := range table.Columns {
+		// key columns are required by DML generation
+		if !table.IsKeyColumn(column) && column.Extra == "" {
+			candidates = append(candidates, column)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil, nil
+	}
+	column := candidates[md.rnd.Intn(len(candidates))]
+	params := &models.DDLParams{
+		Type:   models.ChangeColumn,
+		Schema: table.Schema,
+		Table:  table.Name,
+		SQL: fmt.Sprintf("ALTER TABLE %s CHANGE COLUMN `%s` `%s` %s %s;",
+			TableName(table.Schema, table.Name), escapeName(column.Name), dbutil.GenColumnName(md.rnd, table), columnType(column), columnNullable(column)),
+	}
+	return params, nil
+}
+
+// widenColumnType returns a wider type of the column which can store all
+// values of the original type without loss, returns false if there is no one.
+func widenColumnType(column *models.Column, indexed bool) (string, bool) {
+	unsigned := ""
+	if column.Unsigned {
+		unsigned = " UNSIGNED"
+	}
+	switch strings.ToUpper(column.Tp) {
+	case "TINYINT":
+		return "SMALLINT" + unsigned, true
+	case "SMALLINT":
+		return "MEDIUMINT" + unsigned, true
+	case "MEDIUMINT":
+		return "INT" + unsigned, true
+	case "INT", "INTEGER":
+		return "BIGINT" + unsigned, true
+	case "FLOAT":
+		return "DOUBLE" + unsigned, true
+	case "DECIMAL":
+		// DECIMAL(M,D): M <= 65, D <= 30, keep the number of integer digits not decreased
+		m, d := 10, 0
+		parts := strings.Split(column.SubTp, ",")
+		if column.SubTp != "" {
+			var err error
+			m, err = strconv.Atoi(strings.TrimSpace(parts[0]))
+			if err != nil {
+				return "", false
+			}
+			if len(parts) > 1 {
+				d, err = strconv.Atoi(strings.TrimSpace(parts[1]))
+				if err != nil {
+					return "", false
+				}
+			}
+		}
+		incM := minInt(5, 65-m)
+		if incM <= 0 {
+			return "", false
+		}
+		incD := minInt(minInt(2, 30-d), incM)
+		return fmt.Sprintf("DECIMAL(%d,%d)%s", m+incM, d+incD, unsigned), true
+	case "CHAR":
+		n, err := strconv.Atoi(column.SubTp)
+		if err != nil || n >= 255 {
+			return "", false
+		}
+		return fmt.Sprintf("CHAR(%d)", minInt(2*n, 255)), true
+	case "VARCHAR":
+		n, err := strconv.Atoi(column.SubTp)
+		if err != nil {
+			return "", false
+		}
+		// max length of an indexed column and a row in utf8mb4
+		limit := 16383
+		if indexed {
+			limit = 768
+		}
+		m := minInt(2*n, limit)
+		if m <= n {
+			return "", false
+		}
+		return fmt.Sprintf("VARCHAR(%d)", m), true
+	case "TEXT":
+		if indexed {
+			return "", false
+		}
+		return "MEDIUMTEXT", true
+	case "MEDIUMTEXT":
+		if indexed {
+			return "", false
+		}
+		return "LONGTEXT", true
+	}
+	return "", false
+}
+
+// columnType returns the full type definition of a column
+func columnType(column *models.Column) string {
+	tp := column.Tp
+	if column.SubTp != "" {
+		tp += "(" + column.SubTp + ")"
+	}
+	if column.Unsigned {
+		tp += " UNSIGNED"
+	}
+	return tp
+}
+
+func columnNullable(column *models.Column) string {
+	if column.NotNull {
+		return "NOT NULL"
+	}
+	return "NULL"
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// genCreateTableDDL creates a table with `id` as primary key and some random columns
+func (md *ImpMySQLDB) genCreateTableDDL(schema string) (*models.DDLParams, error) {
+	name := md.genTableName(schema)
+	n := md.rnd.Intn(5) + 2
+	columns := make([]string, 0, n+2)
+	columns = append(columns, "`id` BIGINT NOT NULL")
+	for i := 0; i < n; i++ {
+		tp := addColumnTypes[md.rnd.Intn(len(addColumnTypes))]
+		columns = append(columns, fmt.Sprintf("`c%d` %s NULL", i, tp))
+	}
+	columns = append(columns, "PRIMARY KEY (`id`)")
+	params := &models.DDLParams{
+		Type:   models.CreateTable,
+		Schema: schema,
+		Table:  name,
+		SQL:    fmt.Sprintf("CREATE TABLE %s (%s);", TableName(schema, name), strings.Join(columns, ", ")),
+	}
+	return params, nil
+}
+
+// genDropTableDDL returns nil if the table is the last cached table
+func (md *ImpMySQLDB) genDropTableDDL(table *models.Table) (*models.DDLParams, error) {
+	if md.TableCount() < 2 {
+		return nil, nil
+	}
+	params := &models.DDLParams{
+		Type:   models.DropTable,
+		Schema: table.Schema,
+		Table:  table.Name,
+		SQL:    fmt.Sprintf("DROP TABLE %s;", TableName(table.Schema, table.Name)),
+	}
+	return params, nil
+}
+
+func (md *ImpMySQLDB) genTruncateTableDDL(table *models.Table) (*models.DDLParams, error) {
+	params := &models.DDLParams{
+		Type:   models.TruncateTable,
+		Schema: table.Schema,
+		Table:  table.Name,
+		SQL:    fmt.Sprintf("TRUNCATE TABLE %s;", TableName(table.Schema, table.Name)),
+	}
+	return params, nil
+}
+
+func (md *ImpMySQLDB) genRenameTableDDL(table *models.Table) (*models.DDLParams, error) {
+	name := md.genTableName(table.Schema)
+	params := &models.DDLParams{
+		Type:     models.RenameTable,
+		Schema:   table.Schema,
+		Table:    table.Name,
+		NewTable: name,
+		SQL:      fmt.Sprintf("RENAME TABLE %s TO %s;", TableName(table.Schema, table.Name), TableName(table.Schema, name)),
+	}
+	return params, nil
+}
+
+// genTableName generates a table name which is not in table cache
+func (md *ImpMySQLDB) genTableName(schema string) string {
+	for {
+		name := "t_" + strings.ToLower(utils.RandomString(md.rnd, 8))
+		if _, ok := md.CachedTable(schema, name); !ok {
+			return name
+		}
+	}
+}
+
+// genCreateIndexDDL creates a secondary or unique index on one or two columns,
+// returns nil if no column can be indexed
+func (md *ImpMySQLDB) genCreateIndexDDL(table *models.Table) (*models.DDLParams, error) {
+	unique := md.rnd.Intn(2) == 0
+	candidates := make([]*models.Column, 0, len(table.Columns))
+	for _, column := range table.Columns {
+		if column.Key == "PRI" || !isIndexableColumn(column) {
+			continue
+		}
+		if unique && dbutil.IsLowCardinalityColumn(column) {
+			continue
+		}
+		candidates = append(candidates, column)
+	}
+	if len(candidates) == 0 {
+		return nil, nil
+	}
+
+	n := 1
+	if len(candidates) > 1 && md.rnd.Intn(2) == 0 {
+		n = 2
+	}
+	columns := make([]*models.Column, 0, n)
+	for _, idx := range md.rnd.Perm(len(candidates))[:n] {
+		columns = append(columns, candidates[idx])
+	}
+
+	// a unique index makes its columns not updatable, keep at least one updatable column
+	if unique {
+		remain := 0
+		for _, column := range table.UpdatableColumns() {
+			if dbutil.FindColumn(columns, column.Name) == nil {
+				remain++
+			}
+		}
+		if remain == 0 {
+			unique = false
+		}
+	}
+
+	var (
+		name   string
+		prefix = "idx_"
+		stmt   = "CREATE INDEX"
+	)
+	if unique {
+		prefix = "uk_"
+		stmt = "CREATE UNIQUE INDEX"
+	}
+	for {
+		name = prefix + strings.ToLower(utils.RandomString(md.rnd, 8))
+		if !dbutil.HasIndex(table, name) {
+			break
+		}
+	}
+	names := make([]string, 0, len(columns))
+	for _, column := range columns {
+		names = append(names, "`"+escapeName(column.Name)+"`")
+	}
+
+	params := &models.DDLParams{
+		Type:   models.CreateIndex,
+		Schema: table.Schema,
+		Table:  table.Name,
+		SQL:    fmt.Sprintf("%s `%s` ON %s (%s);", stmt, name, TableName(table.Schema, table.Name), strings.Join(names, ", ")),
+	}
+	return params, nil
+}
+
+// genDropIndexDDL returns nil if there is no index except the primary key
+func (md *ImpMySQLDB) genDropIndexDDL(table *models.Table) (*models.DDLParams, error) {
+	names := make([]string, 0, len(table.IndexColumns)+len(table.NonUniqueIndexColumns))
+	for name := range table.IndexColumns {
+		if name != "primary" {
+			names = append(names, name)
+		}
+	}
+	for name := range table.NonUniqueIndexColumns {
+		names = append(names, name)
+	}
+	if len(names) == 0 {
+		return nil, nil
+	}
+	// sort to make the choice independent of map iteration order
+	sort.Strings(names)
+	name := names[md.rnd.Intn(len(names))]
+	params := &models.DDLParams{
+		Type:   models.DropIndex,
+		Schema: table.Schema,
+		Table:  table.Name,
+		SQL:    fmt.Sprintf("DROP INDEX `%s` ON %s;", escapeName(name), TableName(table.Schema, table.Name)),
+	}
+	return params, nil
+}
+
+// isDroppableColumn checks whether a column is neither a key column nor
+// part of any index nor a generated column
+func isDroppableColumn(table *models.Table, column *models.Column) bool {
+	return !table.IsKeyColumn(column) && column.Extra == "" && !isIndexedColumn(table, column)
+}
+
+// isIndexedColumn checks whether a column is part of any index
+func isIndexedColumn(table *models.Table, column *models.Column) bool {
+	if column.Key != "" {
+		return true
+	}
+	for _, cols := range table.IndexColumns {
+		if dbutil.FindColumn(cols, column.Name) != nil {
+			return true
+		}
+	}
+	for _, cols := range table.NonUniqueIndexColumns {
+		if dbutil.FindColumn(cols, column.Name) != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// isIndexableColumn checks whether a column can be indexed without prefix length
+func isIndexableColumn(column *models.Column) bool {
+	switch strings.ToUpper(column.Tp) {
+	case "TINYTEXT", "TEXT", "MEDIUMTEXT", "LONGTEXT",
+		"TINYBLOB", "BLOB", "MEDIUMBLOB", "LONGBLOB",
+		"JSON", "GEOMETRY":
+		return false
+	case "VARCHAR", "VARBINARY":
+		// avoids exceeding the max key length, which is 3072 bytes for utf8mb4 in InnoDB
+		n, err := strconv.Atoi(column.SubTp)
+		return err == nil && n <= 768
+	}
+	return true
+}
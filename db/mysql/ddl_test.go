@@ -0,0 +1,190 @@
+package mysql
+
+import (
+	"context"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/pingcap/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/amyangfei/data-dam/pkg/models"
+)
+
+func TestWidenColumnType(t *testing.T) {
+	cases := []struct {
+		column   *models.Column
+		indexed  bool
+		expected string
+		ok       bool
+	}{
+		{&models.Column{Tp: "tinyint", SubTp: "4"}, false, "SMALLINT", true},
+		{&models.Column{Tp: "int", Unsigned: true}, false, "BIGINT UNSIGNED", true},
+		{&models.Column{Tp: "bigint", SubTp: "20"}, false, "", false},
+		{&models.Column{Tp: "float"}, false, "DOUBLE", true},
+		{&models.Column{Tp: "decimal", SubTp: "10,2"}, false, "DECIMAL(15,4)", true},
+		{&models.Column{Tp: "decimal", SubTp: "63,29"}, false, "DECIMAL(65,30)", true},
+		{&models.Column{Tp: "decimal", SubTp: "65,30"}, false, "", false},
+		{&models.Column{Tp: "char", SubTp: "200"}, false, "CHAR(255)", true},
+		{&models.Column{Tp: "char", SubTp: "255"}, false, "", false},
+		{&models.Column{Tp: "varchar", SubTp: "64"}, false, "VARCHAR(128)", true},
+		{&models.Column{Tp: "varchar", SubTp: "500"}, true, "VARCHAR(768)", true},
+		{&models.Column{Tp: "varchar", SubTp: "768"}, true, "", false},
+		{&models.Column{Tp: "text"}, false, "MEDIUMTEXT", true},
+		{&models.Column{Tp: "datetime"}, false, "", false},
+	}
+	for _, cs := range cases {
+		tp, ok := widenColumnType(cs.column, cs.indexed)
+		assert.Equal(t, cs.ok, ok, "%+v", cs.column)
+		assert.Equal(t, cs.expected, tp, "%+v", cs.column)
+	}
+}
+
+// newDDLTable creates table `s`.`t` with primary key `id`, columns `a`, `b`, `c`,
+// and `c` is indexed
+func newDDLTable() *models.Table {
+	var (
+		id = &models.Column{Idx: 0, Name: "id", Tp: "bigint", Key: "PRI", NotNull: true}
+		a  = &models.Column{Idx: 1, Name: "a", Tp: "varchar", SubTp: "32"}
+		b  = &models.Column{Idx: 2, Name: "b", Tp: "int"}
+		c  = &models.Column{Idx: 3, Name: "c", Tp: "int", Key: "MUL"}
+	)
+	return &models.Table{
+		Schema:                "s",
+		Name:                  "t",
+		Columns:               []*models.Column{id, a, b, c},
+		IndexColumns:          map[string][]*models.Column{"primary": {id}},
+		NonUniqueIndexColumns: map[string][]*models.Column{"idx_c": {c}},
+	}
+}
+
+func TestGenAddColumnDDL(t *testing.T) {
+	md := &ImpMySQLDB{rnd: rand.New(rand.NewSource(1))}
+	table := newDDLTable()
+	for i := 0; i < 10; i++ {
+		params, err := md.genAddColumnDDL(table)
+		require.NoError(t, err)
+		assert.Equal(t, models.AddColumn, params.Type)
+		assert.Equal(t, "t", params.Table)
+		assert.True(t, strings.HasPrefix(params.SQL, "ALTER TABLE `s`.`t` ADD COLUMN `c_"), params.SQL)
+		assert.True(t, strings.HasSuffix(params.SQL, " NULL;"), params.SQL)
+	}
+}
+
+func TestGenDropColumnDDL(t *testing.T) {
+	md := &ImpMySQLDB{rnd: rand.New(rand.NewSource(1))}
+	table := newDDLTable()
+	// key columns and indexed columns are never dropped
+	dropped := make(map[string]bool)
+	for i := 0; i < 20; i++ {
+		params, err := md.genDropColumnDDL(table)
+		require.NoError(t, err)
+		require.NotNil(t, params)
+		dropped[params.SQL] = true
+	}
+	assert.Equal(t, map[string]bool{
+		"ALTER TABLE `s`.`t` DROP COLUMN `a`;": true,
+		"ALTER TABLE `s`.`t` DROP COLUMN `b`;": true,
+	}, dropped)
+
+	// the last droppable column is kept for updates
+	table.Columns = table.Columns[:2]
+	params, err := md.genDropColumnDDL(table)
+	require.NoError(t, err)
+	assert.Nil(t, params)
+}
+
+func TestGenCreateIndexDDL(t *testing.T) {
+	md := &ImpMySQLDB{rnd: rand.New(rand.NewSource(1))}
+	table := newDDLTable()
+	// `b` is the only updatable column left after `a` and `c` are in a unique index
+	table.IndexColumns["uk_a_c"] = []*models.Column{table.Columns[1], table.Columns[3]}
+	var unique, nonUnique int
+	for i := 0; i < 50; i++ {
+		params, err := md.genCreateIndexDDL(table)
+		require.NoError(t, err)
+		require.NotNil(t, params)
+		assert.Equal(t, models.CreateIndex, params.Type)
+		assert.NotContains(t, params.SQL, "`id`")
+		if strings.HasPrefix(params.SQL, "CREATE UNIQUE INDEX `uk_") {
+			unique++
+			assert.NotContains(t, params.SQL, "`b`", params.SQL)
+		} else {
+			nonUnique++
+			assert.True(t, strings.HasPrefix(params.SQL, "CREATE INDEX `idx_"), params.SQL)
+		}
+	}
+	assert.True(t, unique > 0)
+	assert.True(t, nonUnique > 0)
+}
+
+// tableSourceStub is a models.TableSource of empty tables in memory
+type tableSourceStub struct {
+	models.TableSource
+	tables map[string]*models.Table
+}
+
+func (s tableSourceStub) FindTables(_ string) ([]string, error) {
+	names := make([]string, 0, len(s.tables))
+	for name := range s.tables {
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+func (s tableSourceStub) LoadTable(schema, table string) (*models.Table, error) {
+	t, ok := s.tables[table]
+	if !ok {
+		return nil, errors.NotFoundf("table %s", TableName(schema, table))
+	}
+	return t, nil
+}
+
+func (s tableSourceStub) MaxID(_, _, _ string) (int64, error) {
+	return 0, nil
+}
+
+func (s tableSourceStub) IsIntegerColumn(column *models.Column) bool {
+	return isIntegerColumn(column)
+}
+
+func TestGenTableDDL(t *testing.T) {
+	table := newDDLTable()
+	source := tableSourceStub{tables: map[string]*models.Table{"t": table}}
+	md := &ImpMySQLDB{rnd: rand.New(rand.NewSource(1))}
+	md.Workload = models.NewWorkload(source, md.rnd, &models.DBConfig{})
+	ctx := context.Background()
+	_, _, err := md.PrepareTables(ctx, "s")
+	require.NoError(t, err)
+
+	params, err := md.genCreateTableDDL("s")
+	require.NoError(t, err)
+	assert.Equal(t, models.CreateTable, params.Type)
+	assert.NotEqual(t, "t", params.Table)
+	assert.True(t, strings.HasPrefix(params.SQL, "CREATE TABLE `s`.`"+params.Table+"` (`id` BIGINT NOT NULL, "), params.SQL)
+	assert.True(t, strings.HasSuffix(params.SQL, ", PRIMARY KEY (`id`));"), params.SQL)
+
+	params, err = md.genRenameTableDDL(table)
+	require.NoError(t, err)
+	assert.Equal(t, models.RenameTable, params.Type)
+	_, ok := md.CachedTable("s", params.NewTable)
+	assert.False(t, ok)
+	assert.Equal(t, "RENAME TABLE `s`.`t` TO `s`.`"+params.NewTable+"`;", params.SQL)
+
+	params, err = md.genTruncateTableDDL(table)
+	require.NoError(t, err)
+	assert.Equal(t, "TRUNCATE TABLE `s`.`t`;", params.SQL)
+
+	// the last cached table is never dropped
+	params, err = md.genDropTableDDL(table)
+	require.NoError(t, err)
+	assert.Nil(t, params)
+	source.tables["u"] = newDDLTable()
+	source.tables["u"].Name = "u"
+	require.NoError(t, md.RefreshTableCache(ctx, &models.DDLParams{Type: models.CreateTable, Schema: "s", Table: "u"}))
+	params, err = md.genDropTableDDL(table)
+	require.NoError(t, err)
+	assert.Equal(t, &models.DDLParams{Type: models.DropTable, Schema: "s", Table: "t", SQL: "DROP TABLE `s`.`t`;"}, params)
+}
@@ -0,0 +1,153 @@
+package mysql
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pingcap/errors"
+	"gopkg.in/natefinch/lumberjack.v2"
+
+	"github.com/amyangfei/data-dam/pkg/models"
+)
+
+const timestampLayout = "2006-01-02 15:04:05.000"
+
+var (
+	sqlFilesMu sync.Mutex
+	sqlFiles   = make(map[string]*sqlFile) // file path -> shared sql file
+)
+
+// sqlFile is a rotating sql file shared by all ImpMySQLDBs writing to the same path
+type sqlFile struct {
+	sync.Mutex
+	path  string
+	out   *lumberjack.Logger
+	cfg   models.SQLFileConfig
+	sinks []*sqlSink // sinks using this file, in opening order
+}
+
+// sqlSink writes statements of one ImpMySQLDB, statements are grouped into a
+// transaction if `txn-size` is set, the transaction is written as a whole block.
+type sqlSink struct {
+	file    *sqlFile
+	stmts   []string  // statements of the pending transaction, protected by file
+	startTs time.Time // generated time of the first pending statement
+}
+
+func openSQLSink(cfg models.SQLFileConfig) *sqlSink {
+	sqlFilesMu.Lock()
+	defer sqlFilesMu.Unlock()
+
+	f, ok := sqlFiles[cfg.Path]
+	if !ok {
+		f = &sqlFile{
+			path: cfg.Path,
+			out: &lumberjack.Logger{
+				Filename:   cfg.Path,
+				MaxSize:    cfg.MaxSize,
+				MaxBackups: cfg.MaxBackups,
+				LocalTime:  true,
+			},
+			cfg: cfg,
+		}
+		sqlFiles[cfg.Path] = f
+	}
+	s := &sqlSink{file: f}
+	f.Lock()
+	f.sinks = append(f.sinks, s)
+	f.Unlock()
+	return s
+}
+
+// writeDML writes a rendered DML statement, or appends it to the pending transaction
+func (s *sqlSink) writeDML(stmt string) error {
+	f := s.file
+	f.Lock()
+	defer f.Unlock()
+
+	if f.cfg.TxnSize <= 0 {
+		return errors.Trace(f.write(time.Now(), []string{stmt}, false))
+	}
+	if len(s.stmts) == 0 {
+		s.startTs = time.Now()
+	}
+	s.stmts = append(s.stmts, stmt)
+	if len(s.stmts) < f.cfg.TxnSize {
+		return nil
+	}
+	return errors.Trace(s.flush())
+}
+
+// writeDDL writes a DDL statement, pending transactions of all sinks are
+// written before it because DDL causes an implicit commit.
+func (s *sqlSink) writeDDL(stmt string) error {
+	f := s.file
+	f.Lock()
+	defer f.Unlock()
+
+	for _, sink := range f.sinks {
+		if err := sink.flush(); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	return errors.Trace(f.write(time.Now(), []string{stmt}, false))
+}
+
+// close writes the pending transaction, the file is closed when no sink uses it
+func (s *sqlSink) close() error {
+	sqlFilesMu.Lock()
+	defer sqlFilesMu.Unlock()
+
+	f := s.file
+	f.Lock()
+	defer f.Unlock()
+
+	err := s.flush()
+	for i := range f.sinks {
+		if f.sinks[i] == s {
+			f.sinks = append(f.sinks[:i], f.sinks[i+1:]...)
+			break
+		}
+	}
+	if len(f.sinks) == 0 {
+		delete(sqlFiles, f.path)
+		if err2 := f.out.Close(); err == nil {
+			err = err2
+		}
+	}
+	return errors.Trace(err)
+}
+
+// flush writes the pending transaction, the caller must hold the lock of file
+func (s *sqlSink) flush() error {
+	if len(s.stmts) == 0 {
+		return nil
+	}
+	err := s.file.write(s.startTs, s.stmts, true)
+	s.stmts = s.stmts[:0]
+	return errors.Trace(err)
+}
+
+// write writes statements in one block, so a transaction never spans rotated files
+func (f *sqlFile) write(ts time.Time, stmts []string, txn bool) error {
+	var buf strings.Builder
+	if f.cfg.Timestamp {
+		buf.WriteString("-- " + ts.Format(timestampLayout) + "\n")
+	}
+	if txn {
+		buf.WriteString("BEGIN;\n")
+	}
+	for _, stmt := range stmts {
+		buf.WriteString(stmt)
+		if !strings.HasSuffix(stmt, ";") {
+			buf.WriteByte(';')
+		}
+		buf.WriteByte('\n')
+	}
+	if txn {
+		buf.WriteString("COMMIT;\n")
+	}
+	_, err := f.out.Write([]byte(buf.String()))
+	return errors.Trace(err)
+}
@@ -0,0 +1,139 @@
+package mysql
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/amyangfei/data-dam/pkg/models"
+)
+
+func TestGenPlainSQL(t *testing.T) {
+	md := &ImpMySQLDB{}
+	args := []interface{}{"a?'b\\\n", nil, 10, 1.5, []byte{0x1, 0xab}, true}
+	stmt := md.genPlainSQL("INSERT INTO `t` VALUES (?, ?, ?, ?, ?, ?);", args)
+	assert.Equal(t, "INSERT INTO `t` VALUES ('a?\\'b\\\\\\n', NULL, 10, 1.5, X'01AB', TRUE);", stmt)
+}
+
+func TestSQLFileRequiresDB(t *testing.T) {
+	// a closed port refuses the connection at once
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	port := l.Addr().(*net.TCPAddr).Port
+	require.NoError(t, l.Close())
+
+	dir, err := ioutil.TempDir("", "data-dam")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	cfg := &models.DBConfig{
+		MySQL:   models.MySQLConfig{Host: "127.0.0.1", Port: port, User: "root"},
+		SQLFile: models.SQLFileConfig{Path: filepath.Join(dir, "dam.sql")},
+	}
+	_, err = mysqlCreator{}.Create(cfg)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "sql-file output requires a database with the tables")
+	_, err = os.Stat(cfg.SQLFile.Path)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestSQLSink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "data-dam")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	cfg := models.SQLFileConfig{Path: filepath.Join(dir, "dam.sql"), TxnSize: 2}
+	s1 := openSQLSink(cfg)
+	s2 := openSQLSink(cfg)
+	require.NoError(t, s1.writeDML("INSERT 1;"))
+	require.NoError(t, s2.writeDML("INSERT 2;"))
+	require.NoError(t, s1.writeDML("INSERT 3;"))
+	require.NoError(t, s1.writeDML("INSERT 4;"))
+	require.NoError(t, s1.writeDDL("ALTER 1;"))
+	require.NoError(t, s1.writeDML("INSERT 5;"))
+	require.NoError(t, s1.close())
+	require.NoError(t, s2.close())
+
+	data, err := ioutil.ReadFile(cfg.Path)
+	require.NoError(t, err)
+	expected := "BEGIN;\nINSERT 1;\nINSERT 3;\nCOMMIT;\n" +
+		"BEGIN;\nINSERT 4;\nCOMMIT;\n" +
+		"BEGIN;\nINSERT 2;\nCOMMIT;\n" +
+		"ALTER 1;\n" +
+		"BEGIN;\nINSERT 5;\nCOMMIT;\n"
+	assert.Equal(t, expected, string(data))
+}
+
+func TestBatchStatements(t *testing.T) {
+	dir, err := ioutil.TempDir("", "data-dam")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	cfg := models.SQLFileConfig{Path: filepath.Join(dir, "dam.sql")}
+	md := &ImpMySQLDB{sortFields: true, sink: openSQLSink(cfg)}
+	rows := []map[string]interface{}{{"id": 1, "name": "a"}, {"id": 2, "name": "b"}}
+	require.NoError(t, md.BatchInsert(context.Background(), "s", "t", rows))
+	require.NoError(t, md.BatchDelete(context.Background(), "s", "t", []map[string]interface{}{{"id": 1}, {"id": 2}}))
+	keys := []map[string]interface{}{{"a": 1, "b": "x"}, {"a": 2, "b": "y"}}
+	require.NoError(t, md.BatchDelete(context.Background(), "s", "t", keys))
+	require.NoError(t, md.sink.close())
+
+	data, err := ioutil.ReadFile(cfg.Path)
+	require.NoError(t, err)
+	expected := "INSERT INTO `s`.`t` (`id`, `name`) VALUES (1, 'a'), (2, 'b');\n" +
+		"DELETE FROM `s`.`t` WHERE `id` IN (1, 2);\n" +
+		"DELETE FROM `s`.`t` WHERE (`a`, `b`) IN ((1, 'x'), (2, 'y'));\n"
+	assert.Equal(t, expected, string(data))
+}
+
+func TestUpsertStatements(t *testing.T) {
+	dir, err := ioutil.TempDir("", "data-dam")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	cfg := models.SQLFileConfig{Path: filepath.Join(dir, "dam.sql")}
+	md := &ImpMySQLDB{sortFields: true, sink: openSQLSink(cfg)}
+	keys := map[string]interface{}{"id": 1}
+	values := map[string]interface{}{"id": 1, "name": "a"}
+	for _, tp := range []models.OpType{models.Replace, models.Upsert, models.InsertIgnore} {
+		require.NoError(t, md.Upsert(context.Background(), tp, "s", "t", keys, values))
+	}
+	// a row of key columns only updates its keys
+	require.NoError(t, md.Upsert(context.Background(), models.Upsert, "s", "t", keys, keys))
+	assert.Error(t, md.Upsert(context.Background(), models.Insert, "s", "t", keys, values))
+	require.NoError(t, md.sink.close())
+
+	data, err := ioutil.ReadFile(cfg.Path)
+	require.NoError(t, err)
+	expected := "REPLACE INTO `s`.`t` (`id`, `name`) VALUES (1, 'a');\n" +
+		"INSERT INTO `s`.`t` (`id`, `name`) VALUES (1, 'a') ON DUPLICATE KEY UPDATE `name` = VALUES(`name`);\n" +
+		"INSERT IGNORE INTO `s`.`t` (`id`, `name`) VALUES (1, 'a');\n" +
+		"INSERT INTO `s`.`t` (`id`) VALUES (1) ON DUPLICATE KEY UPDATE `id` = VALUES(`id`);\n"
+	assert.Equal(t, expected, string(data))
+}
+
+func TestRangeStatements(t *testing.T) {
+	dir, err := ioutil.TempDir("", "data-dam")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	cfg := models.SQLFileConfig{Path: filepath.Join(dir, "dam.sql")}
+	md := &ImpMySQLDB{sortFields: true, sink: openSQLSink(cfg)}
+	between := &models.RangeParams{Column: "id", Begin: int64(3), End: int64(7)}
+	require.NoError(t, md.RangeUpdate(context.Background(), "s", "t", between, map[string]interface{}{"name": "a"}))
+	indexed := &models.RangeParams{Column: "c", Begin: "x", Limit: 4}
+	require.NoError(t, md.RangeDelete(context.Background(), "s", "t", indexed))
+	require.NoError(t, md.sink.close())
+
+	data, err := ioutil.ReadFile(cfg.Path)
+	require.NoError(t, err)
+	expected := "UPDATE `s`.`t` SET `name` = 'a' WHERE `id` BETWEEN 3 AND 7;\n" +
+		"DELETE FROM `s`.`t` WHERE `c` = 'x' LIMIT 4;\n"
+	assert.Equal(t, expected, string(data))
+}
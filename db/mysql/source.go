@@ -0,0 +1,55 @@
+package mysql
+
+import (
+	"database/sql"
+	"math/rand"
+
+	"github.com/amyangfei/data-dam/db/dbutil"
+	"github.com/amyangfei/data-dam/pkg/models"
+)
+
+// tableSource implements models.TableSource. Tables, max ids and keys are always
+// read from database, which is required even if DMLs are written to sql files.
+type tableSource struct {
+	db      *sql.DB
+	offline bool // DMLs are written to sql file, so rows in database are never changed
+}
+
+// FindTables implements `FindTables` of models.TableSource
+func (s tableSource) FindTables(schema string) ([]string, error) {
+	return findTables(s.db, schema)
+}
+
+// LoadTable implements `LoadTable` of models.TableSource
+func (s tableSource) LoadTable(schema, table string) (*models.Table, error) {
+	return getTableFromDB(s.db, schema, table)
+}
+
+// MaxID implements `MaxID` of models.TableSource
+func (s tableSource) MaxID(schema, table, column string) (int64, error) {
+	return getMaxID(s.db, schema, table, column)
+}
+
+// Keys implements `Keys` of models.TableSource
+func (s tableSource) Keys(table *models.Table) ([]interface{}, error) {
+	return dbutil.GetKeys(s.db, dialect{}, table)
+}
+
+// ColumnValue implements `ColumnValue` of models.TableSource
+func (s tableSource) ColumnValue(table *models.Table, column *models.Column, keys map[string]interface{}) (interface{}, bool, error) {
+	// the row in database is missing or stale, the live row is changed alone
+	if s.offline {
+		return nil, false, nil
+	}
+	return getColumnValue(s.db, table, column, keys)
+}
+
+// IsIntegerColumn implements `IsIntegerColumn` of models.TableSource
+func (s tableSource) IsIntegerColumn(column *models.Column) bool {
+	return isIntegerColumn(column)
+}
+
+// GenValue implements `GenValue` of models.TableSource
+func (s tableSource) GenValue(rnd *rand.Rand, column *models.Column) (interface{}, error) {
+	return genRandomValue(rnd, column)
+}
@@ -8,21 +8,19 @@ import (
 	"strconv"
 	"strings"
 	"time"
-	"unsafe"
 
 	"github.com/pingcap/errors"
 
+	"github.com/amyangfei/data-dam/db/dbutil"
 	"github.com/amyangfei/data-dam/pkg/models"
+	"github.com/amyangfei/data-dam/pkg/utils"
 )
 
 const (
 	queryMaxRetry = 3
-	letterBytes   = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
-	letterIdxBits = 6                    // 6 bits to represent a letter index
-	letterIdxMask = 1<<letterIdxBits - 1 // All 1-bits, as many as letterIdxBits
-	letterIdxMax  = 63 / letterIdxBits   // # of letter indices fitting in 63 bits
 	tinyIntMax    = 1 << 7
 	smallIntMax   = 1 << 15
+	mediumIntMax  = 1 << 23
 )
 
 // TableName returns table name with schema
@@ -34,6 +32,29 @@ func escapeName(name string) string {
 	return strings.Replace(name, "`", "``", -1)
 }
 
+// dialect implements dbutil.Dialect for MySQL
+type dialect struct{}
+
+func (dialect) QuoteName(name string) string {
+	return "`" + escapeName(name) + "`"
+}
+
+func (dialect) TableName(schema, name string) string {
+	return TableName(schema, name)
+}
+
+func (dialect) Placeholder(n int) string {
+	return "?"
+}
+
+func (dialect) IsIntegerColumn(column *models.Column) bool {
+	return isIntegerColumn(column)
+}
+
+func (dialect) IsBinaryColumn(column *models.Column) bool {
+	return isBinaryColumn(column)
+}
+
 func querySQL(db *sql.DB, query string, maxRetry int) (*sql.Rows, error) {
 	// TODO: add retry mechanism
 	rows, err := db.Query(query)
@@ -48,6 +69,7 @@ func getTableFromDB(db *sql.DB, schema string, name string) (*models.Table, erro
 	table.Schema = schema
 	table.Name = name
 	table.IndexColumns = make(map[string][]*models.Column)
+	table.NonUniqueIndexColumns = make(map[string][]*models.Column)
 
 	err := getTableColumns(db, table, queryMaxRetry)
 	if err != nil {
@@ -119,8 +141,12 @@ func getTableColumns(db *sql.DB, table *models.Table, maxRetry int) error {
 		column.Extra = string(data[5])
 		bracketIdx := strings.Index(column.Tp, "(")
 		if bracketIdx > 0 {
-			column.SubTp = column.Tp[bracketIdx+1 : len(column.Tp)-1]
+			// strip attributes after the brackets, such as `int(10) unsigned`
+			column.SubTp = column.Tp[bracketIdx+1 : strings.LastIndex(column.Tp, ")")]
 			column.Tp = column.Tp[:bracketIdx]
+		} else if spaceIdx := strings.Index(column.Tp, " "); spaceIdx > 0 {
+			// integer types have no display width since MySQL 8.0.19, such as `int unsigned`
+			column.Tp = column.Tp[:spaceIdx]
 		}
 
 		if strings.ToLower(string(data[2])) == "no" {
@@ -172,7 +198,10 @@ func getTableIndex(db *sql.DB, table *models.Table, maxRetry int) error {
 		| t     |          0 | ucd      |            2 | d           | A         |           0 |     NULL | NULL   | YES  | BTREE      |         |               |
 		+-------+------------+----------+--------------+-------------+-----------+-------------+----------+--------+------+------------+---------+---------------+
 	*/
-	var columns = make(map[string][]string)
+	var (
+		columns          = make(map[string][]string)
+		nonUniqueColumns = make(map[string][]string)
+	)
 	for rows.Next() {
 		data := make([]sql.RawBytes, len(rowColumns))
 		values := make([]interface{}, len(rowColumns))
@@ -187,46 +216,22 @@ func getTableIndex(db *sql.DB, table *models.Table, maxRetry int) error {
 		}
 
 		nonUnique := string(data[1])
+		keyName := strings.ToLower(string(data[2]))
 		if nonUnique == "0" {
-			keyName := strings.ToLower(string(data[2]))
 			columns[keyName] = append(columns[keyName], string(data[4]))
+		} else {
+			nonUniqueColumns[keyName] = append(nonUniqueColumns[keyName], string(data[4]))
 		}
 	}
 	if rows.Err() != nil {
 		return errors.Trace(rows.Err())
 	}
 
-	table.IndexColumns = findColumns(table.Columns, columns)
-	return nil
-}
-
-func findColumn(columns []*models.Column, indexColumn string) *models.Column {
-	for _, column := range columns {
-		if column.Name == indexColumn {
-			return column
-		}
-	}
-
+	table.IndexColumns = dbutil.FindColumns(table.Columns, columns)
+	table.NonUniqueIndexColumns = dbutil.FindColumns(table.Columns, nonUniqueColumns)
 	return nil
 }
 
-func findColumns(columns []*models.Column, indexColumns map[string][]string) map[string][]*models.Column {
-	result := make(map[string][]*models.Column)
-
-	for keyName, indexCols := range indexColumns {
-		cols := make([]*models.Column, 0, len(indexCols))
-		for _, name := range indexCols {
-			column := findColumn(columns, name)
-			if column != nil {
-				cols = append(cols, column)
-			}
-		}
-		result[keyName] = cols
-	}
-
-	return result
-}
-
 func findTables(db *sql.DB, schema string) ([]string, error) {
 	query := fmt.Sprintf("SHOW TABLES FROM `%s`", schema)
 	rows, err := querySQL(db, query, queryMaxRetry)
@@ -252,168 +257,222 @@ func findTables(db *sql.DB, schema string) ([]string, error) {
 	return tables, nil
 }
 
-func getMaxID(db *sql.DB, schema, table string) (int64, error) {
-	stmt := fmt.Sprintf("SELECT IFNULL(max(id), 0) FROM `%s`.`%s`", schema, table)
-	rows, err := db.Query(stmt)
-	if err != nil {
-		return 0, errors.Trace(err)
+// isIntegerColumn checks whether column is of an integer type
+func isIntegerColumn(column *models.Column) bool {
+	switch strings.ToUpper(column.Tp) {
+	case "TINYINT", "SMALLINT", "MEDIUMINT", "INT", "INTEGER", "BIGINT":
+		return true
 	}
-	defer rows.Close()
+	return false
+}
+
+// isBinaryColumn checks whether values of column are binary strings
+func isBinaryColumn(column *models.Column) bool {
+	upper := strings.ToUpper(column.Tp)
+	return strings.Contains(upper, "BLOB") || strings.Contains(upper, "BINARY")
+}
+
+func getMaxID(db *sql.DB, schema, table, column string) (int64, error) {
+	stmt := fmt.Sprintf("SELECT IFNULL(MAX(`%s`), 0) FROM %s", escapeName(column), TableName(schema, table))
 	var id int64
-	for rows.Next() {
-		if err := rows.Scan(&id); err != nil {
-			return 0, errors.Trace(err)
-		}
-	}
-	return id, nil
+	err := db.QueryRow(stmt).Scan(&id)
+	return id, errors.Trace(err)
 }
 
-func getRandID(db *sql.DB, schema, table string) (int, error) {
-	stmt := fmt.Sprintf("SELECT IFNULL(id, 0) FROM `%s`.`%s` ORDER BY RAND() LIMIT 1", schema, table)
-	rows, err := db.Query(stmt)
-	if err != nil {
-		return 0, errors.Trace(err)
+// getColumnValue returns the value of column in the row identified by keys, false if there is no such row
+func getColumnValue(db *sql.DB, table *models.Table, column *models.Column, keys map[string]interface{}) (interface{}, bool, error) {
+	args := make([]interface{}, 0, len(keys))
+	stmt := fmt.Sprintf("SELECT `%s` FROM %s WHERE %s LIMIT 1",
+		escapeName(column.Name), TableName(table.Schema, table.Name), genWhere(keys, &args))
+	var value interface{}
+	err := db.QueryRow(stmt, args...).Scan(&value)
+	if err == sql.ErrNoRows {
+		return nil, false, nil
 	}
-	defer rows.Close()
-	var id int
-	for rows.Next() {
-		if err := rows.Scan(&id); err != nil {
-			return 0, errors.Trace(err)
-		}
+	if err != nil {
+		return nil, false, errors.Trace(err)
 	}
-	return id, nil
+	return dbutil.KeyValue(dialect{}, column, value), true, nil
 }
 
-func genRandomValue(column *models.Column) (interface{}, error) {
+func genRandomValue(rnd *rand.Rand, column *models.Column) (interface{}, error) {
 	booleans := []string{"TRUE", "FALSE"}
 	upper := strings.ToUpper(column.Tp)
 	var value interface{}
 	switch upper {
 	case "TINYINT":
-		value = rand.Intn(tinyIntMax)
+		value = rnd.Intn(tinyIntMax)
 	case "SMALLINT":
-		value = rand.Intn(smallIntMax)
+		value = rnd.Intn(smallIntMax)
+	case "MEDIUMINT":
+		value = rnd.Intn(mediumIntMax)
 	case "INT":
-		value = rand.Int31()
+		value = rnd.Int31()
 	case "INTUNSIGNED":
-		value = rand.Int31()
+		value = rnd.Int31()
 	case "BOOLEAN":
-		value = booleans[rand.Intn(len(booleans))]
+		value = booleans[rnd.Intn(len(booleans))]
 	case "BIGINT":
-		value = rand.Int63()
+		value = rnd.Int63()
 	case "BIGINTUNSIGNED":
-		value = rand.Int63()
+		value = rnd.Int63()
 	case "FLOAT":
-		value = rand.Float32() * math.MaxFloat32
+		value = rnd.Float32() * math.MaxFloat32
 	case "DOUBLE":
-		value = rand.ExpFloat64()
+		value = rnd.ExpFloat64()
 	case "DOUBLEUNSIGNED":
-		value = rand.ExpFloat64()
+		value = rnd.ExpFloat64()
 	case "DECIMAL":
-		value = strconv.FormatFloat(rand.ExpFloat64(), 'f', 5, 64)
+		value = strconv.FormatFloat(rnd.ExpFloat64(), 'f', 5, 64)
 	case "DATETIME", "TIMESTAMP", "TIMESTAMPONUPDATE":
-		t := genRandomTime()
+		t := utils.RandomTime(rnd)
 		value = fmt.Sprintf("%.4d-%.2d-%.2d %.2d:%.2d:%.2d", t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second())
+	case "DATE":
+		t := utils.RandomTime(rnd)
+		value = fmt.Sprintf("%.4d-%.2d-%.2d", t.Year(), t.Month(), t.Day())
 	case "TIME":
-		t := genRandomTime()
+		t := utils.RandomTime(rnd)
 		value = fmt.Sprintf("%.2d:%.2d:%.2d", t.Hour(), t.Minute(), t.Second())
 	case "YEAR":
-		t := genRandomTime()
+		t := utils.RandomTime(rnd)
 		value = fmt.Sprintf("%.4d", t.Year())
 	case "CHAR":
 		n, err := strconv.Atoi(column.SubTp)
 		if err != nil {
 			return nil, errors.Trace(err)
 		}
-		value = genRandStringBytesMaskImprSrcUnsafe(n)
+		value = utils.RandomString(rnd, n)
 	case "VARCHAR":
 		n, err := strconv.Atoi(column.SubTp)
 		if err != nil {
 			return nil, errors.Trace(err)
 		}
-		value = genRandStringBytesMaskImprSrcUnsafe(rand.Intn(n) + 1)
-	case "BLOB":
-		value = genRandomByteString(20)
-	case "TEXT":
-		value = genRandomUnicodeString(20)
+		value = utils.RandomString(rnd, rnd.Intn(n)+1)
+	case "BINARY":
+		n, err := binaryLength(column)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		value = genRandomByteString(rnd, n)
+	case "VARBINARY":
+		n, err := binaryLength(column)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		value = genRandomByteString(rnd, rnd.Intn(n)+1)
+	case "TINYBLOB", "BLOB", "MEDIUMBLOB", "LONGBLOB":
+		value = genRandomByteString(rnd, 20)
+	case "TINYTEXT", "TEXT", "MEDIUMTEXT", "LONGTEXT":
+		value = genRandomUnicodeString(rnd, 20)
 	case "ENUM":
 		candidates := strings.Split(column.SubTp, ",")
-		val := candidates[rand.Intn(len(candidates))]
+		val := candidates[rnd.Intn(len(candidates))]
 		val = val[1 : len(val)-1]
 		value = val
 	case "SET":
 		candidates := strings.Split(column.SubTp, ",")
 		s := make([]string, 0, len(candidates))
 		for _, candidate := range candidates {
-			if rand.Intn(2) == 0 {
+			if rnd.Intn(2) == 0 {
 				s = append(s, candidate[1:len(candidate)-1])
 			}
 		}
 		value = strings.Join(s, ",")
+	default:
+		return nil, errors.NotSupportedf("column %s of type %s", column.Name, column.Tp)
 	}
 	return value, nil
 }
 
-func genRandomTime() time.Time {
-	min := time.Date(1970, 1, 1, 0, 0, 0, 0, time.UTC).Unix()
-	max := time.Date(2037, 12, 31, 0, 0, 0, 0, time.UTC).Unix()
-	delta := max - min
-	sec := rand.Int63n(delta) + min
-	return time.Unix(sec, 0)
-}
-
-// https://stackoverflow.com/a/31832326/1115857
-func genRandStringBytesMaskImprSrcUnsafe(n int) string {
-	b := make([]byte, n)
-	// A src.Int63() generates 63 random bits, enough for letterIdxMax characters!
-	for i, cache, remain := n-1, rand.Int63(), letterIdxMax; i >= 0; {
-		if remain == 0 {
-			cache, remain = rand.Int63(), letterIdxMax
-		}
-		if idx := int(cache & letterIdxMask); idx < len(letterBytes) {
-			b[i] = letterBytes[idx]
-			i--
-		}
-		cache >>= letterIdxBits
-		remain--
+// binaryLength returns the length of a BINARY or VARBINARY column, which is 1 if not specified
+func binaryLength(column *models.Column) (int, error) {
+	if column.SubTp == "" {
+		return 1, nil
 	}
-
-	return *(*string)(unsafe.Pointer(&b))
+	n, err := strconv.Atoi(column.SubTp)
+	if err != nil {
+		return 0, errors.Trace(err)
+	}
+	return n, nil
 }
 
-func genRandomUnicodeString(n int) string {
+func genRandomUnicodeString(rnd *rand.Rand, n int) string {
 	var builder strings.Builder
-	builder.Grow(2 + 3*n)
-	builder.WriteByte('\'')
+	builder.Grow(3 * n)
 	for i := 0; i < n; i++ {
 		// 50% chance generating ASCII string, 50% chance generating Unicode string
 		var r rune
-		switch rand.Intn(2) {
+		switch rnd.Intn(2) {
 		case 0:
-			r = rune(rand.Intn(0x80))
+			r = rune(rnd.Intn(0x80))
 		case 1:
-			r = rune(rand.Intn(0xd800))
-		}
-		switch r {
-		case '\'':
-			builder.WriteString("''")
-		case '\\':
-			builder.WriteString(`\\`)
-		default:
-			builder.WriteRune(r)
+			r = rune(rnd.Intn(0xd800))
 		}
+		builder.WriteRune(r)
 	}
-	builder.WriteByte('\'')
 	return builder.String()
 }
 
-func genRandomByteString(n int) string {
-	var builder strings.Builder
-	builder.Grow(3 + 2*n)
-	builder.WriteString("x'")
-	for i := 0; i < n; i++ {
-		fmt.Fprintf(&builder, "%02X", rand.Intn(256))
+func genRandomByteString(rnd *rand.Rand, n int) []byte {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = byte(rnd.Intn(256))
 	}
-	builder.WriteString("'")
-	return builder.String()
+	return b
+}
+
+// formatValue formats a value as SQL literal, strings are escaped as MySQL does
+func formatValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "NULL"
+	case bool:
+		if v {
+			return "TRUE"
+		}
+		return "FALSE"
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return fmt.Sprintf("%d", v)
+	case float32:
+		return strconv.FormatFloat(float64(v), 'g', -1, 32)
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	case []byte:
+		return fmt.Sprintf("X'%X'", v)
+	case time.Time:
+		return "'" + v.Format("2006-01-02 15:04:05.999999") + "'"
+	case string:
+		return escapeString(v)
+	default:
+		return escapeString(fmt.Sprintf("%v", v))
+	}
+}
+
+// escapeString quotes a string literal, it is the same as `mysql_real_escape_string`
+func escapeString(s string) string {
+	var buf strings.Builder
+	buf.Grow(len(s) + 2)
+	buf.WriteByte('\'')
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case 0:
+			buf.WriteString(`\0`)
+		case '\n':
+			buf.WriteString(`\n`)
+		case '\r':
+			buf.WriteString(`\r`)
+		case '\\':
+			buf.WriteString(`\\`)
+		case '\'':
+			buf.WriteString(`\'`)
+		case '"':
+			buf.WriteString(`\"`)
+		case 0x1a:
+			buf.WriteString(`\Z`)
+		default:
+			buf.WriteByte(c)
+		}
+	}
+	buf.WriteByte('\'')
+	return buf.String()
 }
@@ -0,0 +1,32 @@
+package mysql
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/amyangfei/data-dam/pkg/models"
+)
+
+func TestGenRandomBinaryValue(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	for i := 0; i < 10; i++ {
+		value, err := genRandomValue(rnd, &models.Column{Name: "b", Tp: "binary", SubTp: "16"})
+		require.NoError(t, err)
+		assert.Len(t, value, 16)
+
+		value, err = genRandomValue(rnd, &models.Column{Name: "vb", Tp: "varbinary", SubTp: "8"})
+		require.NoError(t, err)
+		n := len(value.([]byte))
+		assert.True(t, n >= 1 && n <= 8, "length %d", n)
+	}
+
+	value, err := genRandomValue(rnd, &models.Column{Name: "b", Tp: "binary"})
+	require.NoError(t, err)
+	assert.Len(t, value, 1)
+
+	_, err = genRandomValue(rnd, &models.Column{Name: "g", Tp: "geometry"})
+	assert.Error(t, err)
+}
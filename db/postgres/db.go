@@ -0,0 +1,456 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+
+	_ "github.com/lib/pq" // import postgres driver
+	"github.com/pingcap/errors"
+
+	"github.com/amyangfei/data-dam/db/dbutil"
+	"github.com/amyangfei/data-dam/pkg/models"
+)
+
+const (
+	defaultTimeout = 3 // seconds
+)
+
+// ImpPostgresDB implements models.DB
+type ImpPostgresDB struct {
+	*models.Workload
+
+	db         *sql.DB
+	tx         *sql.Tx // transaction started by Begin, DMLs are executed in it if not nil
+	verbose    bool
+	sortFields bool
+	ddlTypes   []models.DDLType
+	rnd        *rand.Rand // random source of generated DDL, shared with Workload
+}
+
+type postgresCreator struct {
+}
+
+func createDB(cfg models.PostgresConfig) (*sql.DB, error) {
+	sslMode := cfg.SSLMode
+	if sslMode == "" {
+		sslMode = "disable"
+	}
+	dsn := fmt.Sprintf(
+		"host=%s port=%d user=%s password='%s' dbname=%s sslmode=%s connect_timeout=%d",
+		cfg.Host,
+		cfg.Port,
+		cfg.User,
+		escapeConnValue(cfg.Password),
+		cfg.Database,
+		sslMode,
+		defaultTimeout,
+	)
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	return db, nil
+}
+
+// escapeConnValue escapes a value in single quotes of libpq connection string
+func escapeConnValue(value string) string {
+	return strings.NewReplacer(`\`, `\\`, "'", `\'`).Replace(value)
+}
+
+// Create creates a models.DB
+func (c postgresCreator) Create(cfg *models.DBConfig) (models.DB, error) {
+	pd := &ImpPostgresDB{
+		sortFields: cfg.SortFields,
+		verbose:    cfg.Verbose,
+		ddlTypes:   defaultDDLTypes,
+		rnd:        rand.New(rand.NewSource(cfg.Seed)),
+	}
+	if cfg.SQLFile.Path != "" {
+		return nil, errors.NotSupportedf("sql-file output in PostgreSQL")
+	}
+	if len(cfg.DDLTypes) > 0 {
+		ddlTypes, err := models.ParseDDLTypes(cfg.DDLTypes)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		for _, tp := range ddlTypes {
+			if !isSupportedDDLType(tp) {
+				return nil, errors.NotSupportedf("DDL type %s in PostgreSQL", tp)
+			}
+		}
+		pd.ddlTypes = ddlTypes
+	}
+	db, err := createDB(cfg.Postgres)
+	if err != nil {
+		if db != nil {
+			db.Close()
+		}
+		return nil, errors.Trace(err)
+	}
+	pd.db = db
+	pd.Workload = models.NewWorkload(tableSource{db}, pd.rnd, cfg)
+	return pd, nil
+}
+
+// genSetFields generates `"k1" = $1, "k2" = $2` style assignments
+func genSetFields(values map[string]interface{}, args *[]interface{}) string {
+	parts := make([]string, 0, len(values))
+	for k, v := range values {
+		*args = append(*args, v)
+		parts = append(parts, fmt.Sprintf("%s = $%d", quoteName(k), len(*args)))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// genWhere generates `"k1" = $1 AND "k2" IS NULL` style conditions
+func genWhere(keys map[string]interface{}, args *[]interface{}) string {
+	parts := make([]string, 0, len(keys))
+	for k, v := range keys {
+		// NULL can't be used as a parameter of IS in PostgreSQL
+		if v == nil {
+			parts = append(parts, fmt.Sprintf("%s IS NULL", quoteName(k)))
+			continue
+		}
+		*args = append(*args, v)
+		parts = append(parts, fmt.Sprintf("%s = $%d", quoteName(k), len(*args)))
+	}
+	return strings.Join(parts, " AND ")
+}
+
+// genPlainSQL replaces `$N` placeholders in statement with escaped literal values
+func (pd *ImpPostgresDB) genPlainSQL(stmt string, args []interface{}) string {
+	var buf strings.Builder
+	buf.Grow(len(stmt))
+	for i := 0; i < len(stmt); i++ {
+		if stmt[i] != '$' {
+			buf.WriteByte(stmt[i])
+			continue
+		}
+		// the whole number is parsed so that `$1` never matches the prefix of `$10`
+		end := i + 1
+		for end < len(stmt) && stmt[end] >= '0' && stmt[end] <= '9' {
+			end++
+		}
+		n, err := strconv.Atoi(stmt[i+1 : end])
+		if err != nil || n < 1 || n > len(args) {
+			buf.WriteByte(stmt[i])
+			continue
+		}
+		buf.WriteString(formatValue(args[n-1]))
+		i = end - 1
+	}
+	return buf.String()
+}
+
+// executor executes statements in *sql.DB or *sql.Tx
+type executor interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+func (pd *ImpPostgresDB) executor() executor {
+	if pd.tx != nil {
+		return pd.tx
+	}
+	return pd.db
+}
+
+// Begin implements `Begin` of models.DB
+func (pd *ImpPostgresDB) Begin(_ context.Context) error {
+	if pd.tx != nil {
+		return errors.New("transaction is already started")
+	}
+	// jobs in progress are finished when dispatcher is canceled, so the transaction is not bound to ctx
+	tx, err := pd.db.Begin()
+	if err != nil {
+		return errors.Trace(err)
+	}
+	pd.tx = tx
+	return nil
+}
+
+// Commit implements `Commit` of models.DB
+func (pd *ImpPostgresDB) Commit(_ context.Context) error {
+	if pd.tx == nil {
+		return errors.New("transaction is not started")
+	}
+	err := pd.tx.Commit()
+	pd.tx = nil
+	return errors.Trace(err)
+}
+
+// Rollback implements `Rollback` of models.DB
+func (pd *ImpPostgresDB) Rollback(_ context.Context) error {
+	if pd.tx == nil {
+		return errors.New("transaction is not started")
+	}
+	err := pd.tx.Rollback()
+	pd.tx = nil
+	return errors.Trace(err)
+}
+
+// Insert implements `Insert` of models.DB
+func (pd *ImpPostgresDB) Insert(_ context.Context, schema, table string, values map[string]interface{}) (int64, error) {
+	var (
+		args    = make([]interface{}, 0, len(values))
+		columns = make([]string, 0, len(values))
+		holders = make([]string, 0, len(values))
+		err     error
+	)
+
+	build := func(key string, value interface{}) {
+		args = append(args, value)
+		columns = append(columns, quoteName(key))
+		holders = append(holders, fmt.Sprintf("$%d", len(args)))
+	}
+
+	if pd.sortFields {
+		var keys []string
+		for k := range values {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			build(k, values[k])
+		}
+	} else {
+		for k, v := range values {
+			build(k, v)
+		}
+	}
+	stmt := fmt.Sprintf("INSERT INTO %s (%s) VALUES", TableName(schema, table), strings.Join(columns, ", "))
+	if len(values) == 0 {
+		stmt = fmt.Sprintf("INSERT INTO %s DEFAULT VALUES", TableName(schema, table))
+	} else {
+		stmt = fmt.Sprintf("%s (%s)", stmt, strings.Join(holders, ", "))
+	}
+	// lib/pq doesn't support LastInsertId, the id assigned to the omitted
+	// auto increment column is returned by RETURNING clause.
+	var id int64
+	if column := pd.omittedAutoIncrement(schema, table, values); column != nil {
+		stmt = fmt.Sprintf("%s RETURNING %s;", stmt, quoteName(column.Name))
+		err = pd.executor().QueryRow(stmt, args...).Scan(&id)
+	} else {
+		stmt += ";"
+		_, err = pd.executor().Exec(stmt, args...)
+	}
+
+	if pd.verbose {
+		stmt = pd.genPlainSQL(stmt, args)
+		fmt.Println(stmt)
+	}
+
+	return id, errors.Trace(err)
+}
+
+// omittedAutoIncrement returns the auto increment column of table which is not in values,
+// nil if the table is not cached.
+func (pd *ImpPostgresDB) omittedAutoIncrement(schema, table string, values map[string]interface{}) *models.Column {
+	t, ok := pd.CachedTable(schema, table)
+	if !ok {
+		return nil
+	}
+	column := t.AutoIncrementColumn()
+	if column == nil {
+		return nil
+	}
+	if _, ok := values[column.Name]; ok {
+		return nil
+	}
+	return column
+}
+
+// Upsert implements `Upsert` of models.DB. PostgreSQL has no REPLACE, so replaces
+// and upserts are both `INSERT ... ON CONFLICT DO UPDATE` of key columns.
+func (pd *ImpPostgresDB) Upsert(_ context.Context, tp models.OpType, schema, table string, keys map[string]interface{}, values map[string]interface{}) error {
+	var (
+		names    = dbutil.FieldNames(values, pd.sortFields)
+		args     = make([]interface{}, 0, len(names))
+		tuple    = dbutil.GenValueTuples(dialect{}, names, []map[string]interface{}{values}, &args)[0]
+		conflict = dbutil.JoinNames(dialect{}, dbutil.FieldNames(keys, pd.sortFields))
+		stmt     = fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s) ON CONFLICT (%s)", TableName(schema, table), dbutil.JoinNames(dialect{}, names), tuple, conflict)
+	)
+	switch tp {
+	case models.Replace, models.Upsert:
+		assigns := make([]string, 0, len(names))
+		for _, name := range dbutil.UpdatedNames(names, keys) {
+			assigns = append(assigns, fmt.Sprintf("%s = EXCLUDED.%s", quoteName(name), quoteName(name)))
+		}
+		stmt = fmt.Sprintf("%s DO UPDATE SET %s;", stmt, strings.Join(assigns, ", "))
+	case models.InsertIgnore:
+		stmt += " DO NOTHING;"
+	default:
+		return errors.NotValidf("upsert OpType %s", tp)
+	}
+	_, err := pd.executor().Exec(stmt, args...)
+
+	if pd.verbose {
+		stmt = pd.genPlainSQL(stmt, args)
+		fmt.Println(stmt)
+	}
+
+	return errors.Trace(err)
+}
+
+// RangeUpdate implements `RangeUpdate` of models.DB
+func (pd *ImpPostgresDB) RangeUpdate(_ context.Context, schema, table string, rng *models.RangeParams, values map[string]interface{}) error {
+	args := make([]interface{}, 0, len(values)+2)
+	kvs := genSetFields(values, &args)
+	where := genRangeWhere(TableName(schema, table), rng, &args)
+	stmt := fmt.Sprintf("UPDATE %s SET %s WHERE %s;", TableName(schema, table), kvs, where)
+	_, err := pd.executor().Exec(stmt, args...)
+
+	if pd.verbose {
+		stmt = pd.genPlainSQL(stmt, args)
+		fmt.Println(stmt)
+	}
+
+	return errors.Trace(err)
+}
+
+// RangeDelete implements `RangeDelete` of models.DB
+func (pd *ImpPostgresDB) RangeDelete(_ context.Context, schema, table string, rng *models.RangeParams) error {
+	args := make([]interface{}, 0, 2)
+	where := genRangeWhere(TableName(schema, table), rng, &args)
+	stmt := fmt.Sprintf("DELETE FROM %s WHERE %s;", TableName(schema, table), where)
+	_, err := pd.executor().Exec(stmt, args...)
+
+	if pd.verbose {
+		stmt = pd.genPlainSQL(stmt, args)
+		fmt.Println(stmt)
+	}
+
+	return errors.Trace(err)
+}
+
+// genRangeWhere generates the condition of rng, such as `"id" BETWEEN $1 AND $2` or `"c" = $1`.
+// PostgreSQL has no LIMIT in UPDATE and DELETE, so limited rows are chosen by ctid in a subquery.
+func genRangeWhere(name string, rng *models.RangeParams, args *[]interface{}) string {
+	var where string
+	if rng.End == nil {
+		where = genWhere(map[string]interface{}{rng.Column: rng.Begin}, args)
+	} else {
+		*args = append(*args, rng.Begin, rng.End)
+		where = fmt.Sprintf("%s BETWEEN $%d AND $%d", quoteName(rng.Column), len(*args)-1, len(*args))
+	}
+	if rng.Limit <= 0 {
+		return where
+	}
+	return fmt.Sprintf("ctid IN (SELECT ctid FROM %s WHERE %s LIMIT %d)", name, where, rng.Limit)
+}
+
+// BatchInsert implements `BatchInsert` of models.DB
+func (pd *ImpPostgresDB) BatchInsert(_ context.Context, schema, table string, rows []map[string]interface{}) error {
+	if len(rows) == 0 {
+		return nil
+	}
+	var (
+		names  = dbutil.FieldNames(rows[0], pd.sortFields)
+		args   = make([]interface{}, 0, len(names)*len(rows))
+		tuples = dbutil.GenValueTuples(dialect{}, names, rows, &args)
+	)
+	for idx := range tuples {
+		tuples[idx] = "(" + tuples[idx] + ")"
+	}
+	stmt := fmt.Sprintf("INSERT INTO %s (%s) VALUES %s;",
+		TableName(schema, table), dbutil.JoinNames(dialect{}, names), strings.Join(tuples, ", "))
+	_, err := pd.executor().Exec(stmt, args...)
+
+	if pd.verbose {
+		stmt = pd.genPlainSQL(stmt, args)
+		fmt.Println(stmt)
+	}
+
+	return errors.Trace(err)
+}
+
+// BatchDelete implements `BatchDelete` of models.DB
+func (pd *ImpPostgresDB) BatchDelete(_ context.Context, schema, table string, keys []map[string]interface{}) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	var (
+		names  = dbutil.FieldNames(keys[0], pd.sortFields)
+		args   = make([]interface{}, 0, len(names)*len(keys))
+		tuples = dbutil.GenValueTuples(dialect{}, names, keys, &args)
+		target = dbutil.JoinNames(dialect{}, names)
+	)
+	// composite keys are compared as row values, such as `(a, b) IN ((?, ?), (?, ?))`
+	if len(names) > 1 {
+		target = "(" + target + ")"
+		for idx := range tuples {
+			tuples[idx] = "(" + tuples[idx] + ")"
+		}
+	}
+	stmt := fmt.Sprintf("DELETE FROM %s WHERE %s IN (%s);", TableName(schema, table), target, strings.Join(tuples, ", "))
+	_, err := pd.executor().Exec(stmt, args...)
+
+	if pd.verbose {
+		stmt = pd.genPlainSQL(stmt, args)
+		fmt.Println(stmt)
+	}
+
+	return errors.Trace(err)
+}
+
+// Update implements `Update` of models.DB
+func (pd *ImpPostgresDB) Update(_ context.Context, schema, table string, keys map[string]interface{}, values map[string]interface{}) error {
+	args := make([]interface{}, 0, len(keys)+len(values))
+	kvs := genSetFields(values, &args)
+	where := genWhere(keys, &args)
+	stmt := fmt.Sprintf("UPDATE %s SET %s WHERE %s;", TableName(schema, table), kvs, where)
+	_, err := pd.executor().Exec(stmt, args...)
+
+	if pd.verbose {
+		stmt = pd.genPlainSQL(stmt, args)
+		fmt.Println(stmt)
+	}
+
+	return errors.Trace(err)
+}
+
+// Delete implements `Delete` of models.DB
+func (pd *ImpPostgresDB) Delete(_ context.Context, schema, table string, keys map[string]interface{}) error {
+	args := make([]interface{}, 0, len(keys))
+	where := genWhere(keys, &args)
+	stmt := fmt.Sprintf("DELETE FROM %s WHERE %s;", TableName(schema, table), where)
+	_, err := pd.executor().Exec(stmt, args...)
+
+	if pd.verbose {
+		stmt = pd.genPlainSQL(stmt, args)
+		fmt.Println(stmt)
+	}
+
+	return errors.Trace(err)
+}
+
+// Exec implements `Exec` of models.DB
+func (pd *ImpPostgresDB) Exec(_ context.Context, stmt string) error {
+	_, err := pd.executor().Exec(stmt)
+
+	if pd.verbose {
+		fmt.Println(stmt)
+	}
+
+	return errors.Trace(err)
+}
+
+// Close implements `Close` of models.DB
+func (pd *ImpPostgresDB) Close() error {
+	if pd.db != nil {
+		err := pd.db.Close()
+		if err != nil {
+			return errors.Trace(err)
+		}
+	}
+	return nil
+}
+
+func init() {
+	models.RegisterDBCreator("postgres", postgresCreator{})
+}
@@ -0,0 +1,50 @@
+package postgres
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/amyangfei/data-dam/pkg/models"
+)
+
+func TestGenWhere(t *testing.T) {
+	args := []interface{}{"v"}
+	where := genWhere(map[string]interface{}{"id": 10}, &args)
+	assert.Equal(t, `"id" = $2`, where)
+	assert.Equal(t, []interface{}{"v", 10}, args)
+
+	args = args[:0]
+	where = genWhere(map[string]interface{}{"c": nil}, &args)
+	assert.Equal(t, `"c" IS NULL`, where)
+	assert.Len(t, args, 0)
+}
+
+func TestGenPlainSQL(t *testing.T) {
+	pd := &ImpPostgresDB{}
+	args := make([]interface{}, 0, 11)
+	for i := 0; i < 10; i++ {
+		args = append(args, i)
+	}
+	args = append(args, "it's")
+	stmt := pd.genPlainSQL("SELECT $1, $10, $11", args)
+	assert.Equal(t, "SELECT 0, 9, 'it''s'", stmt)
+
+	// values containing placeholders are never replaced again
+	args = []interface{}{"$2", 0.1, 1e-7, true, nil, []byte{0x1, 0xab}}
+	stmt = pd.genPlainSQL("INSERT INTO t VALUES ($1, $2, $3, $4, $5, $6, $7);", args)
+	assert.Equal(t, `INSERT INTO t VALUES ('$2', 0.1, 1e-07, TRUE, NULL, '\x01ab', $7);`, stmt)
+	assert.Equal(t, `"a""b"."t"`, TableName(`a"b`, "t"))
+}
+
+func TestGenRandomValue(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	value, err := genRandomValue(rnd, &models.Column{Name: "n", Tp: "numeric"})
+	require.NoError(t, err)
+	assert.IsType(t, "", value)
+
+	_, err = genRandomValue(rnd, &models.Column{Name: "p", Tp: "point"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,341 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pingcap/errors"
+
+	"github.com/amyangfei/data-dam/db/dbutil"
+	"github.com/amyangfei/data-dam/pkg/models"
+	"github.com/amyangfei/data-dam/pkg/utils"
+)
+
+var (
+	// defaultDDLTypes contains DDL types generated if `ddl-types` is not configured
+	defaultDDLTypes = []models.DDLType{
+		models.AddColumn,
+		models.DropColumn,
+		models.CreateIndex,
+		models.DropIndex,
+	}
+
+	// supportedDDLTypes contains all DDL types ImpPostgresDB can generate
+	supportedDDLTypes = []models.DDLType{
+		models.AddColumn,
+		models.DropColumn,
+		models.CreateIndex,
+		models.DropIndex,
+		models.CreateTable,
+		models.DropTable,
+		models.TruncateTable,
+		models.RenameTable,
+	}
+
+	// addColumnTypes contains column definitions used in ADD COLUMN, all of
+	// them must be supported by `genRandomValue`
+	addColumnTypes = []string{
+		"SMALLINT",
+		"INTEGER",
+		"BIGINT",
+		"DOUBLE PRECISION",
+		"NUMERIC(20,5)",
+		"BOOLEAN",
+		"TIMESTAMP",
+		"CHAR(16)",
+		"VARCHAR(64)",
+		"TEXT",
+	}
+)
+
+func isSupportedDDLType(tp models.DDLType) bool {
+	for _, supported := range supportedDDLTypes {
+		if tp == supported {
+			return true
+		}
+	}
+	return false
+}
+
+// GenerateDDL implements `GenerateDDL` of models.DB
+func (pd *ImpPostgresDB) GenerateDDL(_ context.Context) (*models.DDLParams, error) {
+	table, err := pd.RandomTable()
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	var params *models.DDLParams
+	switch pd.ddlTypes[pd.rnd.Intn(len(pd.ddlTypes))] {
+	case models.AddColumn:
+		params, err = pd.genAddColumnDDL(table)
+	case models.DropColumn:
+		params, err = pd.genDropColumnDDL(table)
+	case models.CreateIndex:
+		params, err = pd.genCreateIndexDDL(table)
+	case models.DropIndex:
+		params, err = pd.genDropIndexDDL(table)
+	case models.CreateTable:
+		params, err = pd.genCreateTableDDL(table.Schema)
+	case models.DropTable:
+		params, err = pd.genDropTableDDL(table)
+	case models.TruncateTable:
+		params, err = pd.genTruncateTableDDL(table)
+	case models.RenameTable:
+		params, err = pd.genRenameTableDDL(table)
+	}
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	// falls back to ADD COLUMN if the chosen DDL can't be applied to the table
+	if params == nil {
+		params, err = pd.genAddColumnDDL(table)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+	}
+	return params, nil
+}
+
+// ExecDDL implements `ExecDDL` of models.DB
+func (pd *ImpPostgresDB) ExecDDL(_ context.Context, ddl *models.DDLParams) error {
+	_, err := pd.db.Exec(ddl.SQL)
+
+	if pd.verbose {
+		fmt.Println(ddl.SQL)
+	}
+
+	return errors.Trace(err)
+}
+
+func (pd *ImpPostgresDB) genAddColumnDDL(table *models.Table) (*models.DDLParams, error) {
+	name := dbutil.GenColumnName(pd.rnd, table)
+	tp := addColumnTypes[pd.rnd.Intn(len(addColumnTypes))]
+	params := &models.DDLParams{
+		Type:   models.AddColumn,
+		Schema: table.Schema,
+		Table:  table.Name,
+		SQL:    fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s NULL;", TableName(table.Schema, table.Name), quoteName(name), tp),
+	}
+	return params, nil
+}
+
+// genDropColumnDDL returns nil if no column can be dropped safely
+func (pd *ImpPostgresDB) genDropColumnDDL(table *models.Table) (*models.DDLParams, error) {
+	candidates := make([]*models.Column, 0, len(table.Columns))
+	for _, column := range table.Columns {
+		if !table.IsKeyColumn(column) && column.Extra == "" && !isIndexedColumn(table, column) {
+			candidates = append(candidates, column)
+		}
+	}
+	// keep at least one non-key column, which is required by update generation
+	if len(candidates) < 2 {
+		return nil, nil
+	}
+	column := candidates[pd.rnd.Intn(len(candidates))]
+	params := &models.DDLParams{
+		Type:   models.DropColumn,
+		Schema: table.Schema,
+		Table:  table.Name,
+		SQL:    fmt.Sprintf("ALTER TABLE %s DROP COLUMN %s;", TableName(table.Schema, table.Name), quoteName(column.Name)),
+	}
+	return params, nil
+}
+
+// genCreateIndexDDL creates a secondary or unique index on one or two columns,
+// returns nil if no column can be indexed
+func (pd *ImpPostgresDB) genCreateIndexDDL(table *models.Table) (*models.DDLParams, error) {
+	unique := pd.rnd.Intn(2) == 0
+	candidates := make([]*models.Column, 0, len(table.Columns))
+	for _, column := range table.Columns {
+		if column.Key == "PRI" || !isIndexableColumn(column) {
+			continue
+		}
+		if unique && dbutil.IsLowCardinalityColumn(column) {
+			continue
+		}
+		candidates = append(candidates, column)
+	}
+	if len(candidates) == 0 {
+		return nil, nil
+	}
+
+	n := 1
+	if len(candidates) > 1 && pd.rnd.Intn(2) == 0 {
+		n = 2
+	}
+	columns := make([]*models.Column, 0, n)
+	for _, idx := range pd.rnd.Perm(len(candidates))[:n] {
+		columns = append(columns, candidates[idx])
+	}
+
+	// a unique index makes its columns not updatable, keep at least one updatable column
+	if unique {
+		remain := 0
+		for _, column := range table.UpdatableColumns() {
+			if dbutil.FindColumn(columns, column.Name) == nil {
+				remain++
+			}
+		}
+		if remain == 0 {
+			unique = false
+		}
+	}
+
+	var (
+		name   string
+		prefix = "idx_"
+		stmt   = "CREATE INDEX"
+	)
+	if unique {
+		prefix = "uk_"
+		stmt = "CREATE UNIQUE INDEX"
+	}
+	for {
+		name = prefix + strings.ToLower(utils.RandomString(pd.rnd, 8))
+		if !dbutil.HasIndex(table, name) {
+			break
+		}
+	}
+	names := make([]string, 0, len(columns))
+	for _, column := range columns {
+		names = append(names, quoteName(column.Name))
+	}
+
+	params := &models.DDLParams{
+		Type:   models.CreateIndex,
+		Schema: table.Schema,
+		Table:  table.Name,
+		SQL:    fmt.Sprintf("%s %s ON %s (%s);", stmt, quoteName(name), TableName(table.Schema, table.Name), strings.Join(names, ", ")),
+	}
+	return params, nil
+}
+
+// genDropIndexDDL returns nil if there is no index except the primary key
+func (pd *ImpPostgresDB) genDropIndexDDL(table *models.Table) (*models.DDLParams, error) {
+	names := make([]string, 0, len(table.IndexColumns)+len(table.NonUniqueIndexColumns))
+	for name := range table.IndexColumns {
+		if name != "primary" {
+			names = append(names, name)
+		}
+	}
+	for name := range table.NonUniqueIndexColumns {
+		names = append(names, name)
+	}
+	if len(names) == 0 {
+		return nil, nil
+	}
+	// sort to make the choice independent of map iteration order
+	sort.Strings(names)
+	name := names[pd.rnd.Intn(len(names))]
+	// indexes created by UNIQUE constraints can't be dropped by DROP INDEX
+	if _, ok := table.IndexColumns[name]; ok {
+		params := &models.DDLParams{
+			Type:   models.DropIndex,
+			Schema: table.Schema,
+			Table:  table.Name,
+			SQL: fmt.Sprintf("ALTER TABLE %s DROP CONSTRAINT IF EXISTS %s; DROP INDEX IF EXISTS %s;",
+				TableName(table.Schema, table.Name), quoteName(name), TableName(table.Schema, name)),
+		}
+		return params, nil
+	}
+	params := &models.DDLParams{
+		Type:   models.DropIndex,
+		Schema: table.Schema,
+		Table:  table.Name,
+		SQL:    fmt.Sprintf("DROP INDEX %s;", TableName(table.Schema, name)),
+	}
+	return params, nil
+}
+
+// genCreateTableDDL creates a table with `id` as primary key and some random columns
+func (pd *ImpPostgresDB) genCreateTableDDL(schema string) (*models.DDLParams, error) {
+	name := pd.genTableName(schema)
+	n := pd.rnd.Intn(5) + 2
+	columns := make([]string, 0, n+1)
+	columns = append(columns, `"id" BIGINT NOT NULL PRIMARY KEY`)
+	for i := 0; i < n; i++ {
+		tp := addColumnTypes[pd.rnd.Intn(len(addColumnTypes))]
+		columns = append(columns, fmt.Sprintf(`"c%d" %s NULL`, i, tp))
+	}
+	params := &models.DDLParams{
+		Type:   models.CreateTable,
+		Schema: schema,
+		Table:  name,
+		SQL:    fmt.Sprintf("CREATE TABLE %s (%s);", TableName(schema, name), strings.Join(columns, ", ")),
+	}
+	return params, nil
+}
+
+// genDropTableDDL returns nil if the table is the last cached table
+func (pd *ImpPostgresDB) genDropTableDDL(table *models.Table) (*models.DDLParams, error) {
+	if pd.TableCount() < 2 {
+		return nil, nil
+	}
+	params := &models.DDLParams{
+		Type:   models.DropTable,
+		Schema: table.Schema,
+		Table:  table.Name,
+		SQL:    fmt.Sprintf("DROP TABLE %s;", TableName(table.Schema, table.Name)),
+	}
+	return params, nil
+}
+
+func (pd *ImpPostgresDB) genTruncateTableDDL(table *models.Table) (*models.DDLParams, error) {
+	params := &models.DDLParams{
+		Type:   models.TruncateTable,
+		Schema: table.Schema,
+		Table:  table.Name,
+		SQL:    fmt.Sprintf("TRUNCATE TABLE %s;", TableName(table.Schema, table.Name)),
+	}
+	return params, nil
+}
+
+func (pd *ImpPostgresDB) genRenameTableDDL(table *models.Table) (*models.DDLParams, error) {
+	name := pd.genTableName(table.Schema)
+	params := &models.DDLParams{
+		Type:     models.RenameTable,
+		Schema:   table.Schema,
+		Table:    table.Name,
+		NewTable: name,
+		SQL:      fmt.Sprintf("ALTER TABLE %s RENAME TO %s;", TableName(table.Schema, table.Name), quoteName(name)),
+	}
+	return params, nil
+}
+
+// genTableName generates a table name which is not in table cache
+func (pd *ImpPostgresDB) genTableName(schema string) string {
+	for {
+		name := "t_" + strings.ToLower(utils.RandomString(pd.rnd, 8))
+		if _, ok := pd.CachedTable(schema, name); !ok {
+			return name
+		}
+	}
+}
+
+// isIndexedColumn checks whether a column is part of any index
+func isIndexedColumn(table *models.Table, column *models.Column) bool {
+	if column.Key != "" {
+		return true
+	}
+	for _, cols := range table.IndexColumns {
+		if dbutil.FindColumn(cols, column.Name) != nil {
+			return true
+		}
+	}
+	for _, cols := range table.NonUniqueIndexColumns {
+		if dbutil.FindColumn(cols, column.Name) != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// isIndexableColumn checks whether a column can be indexed by a btree index
+func isIndexableColumn(column *models.Column) bool {
+	switch strings.ToLower(column.Tp) {
+	case "text", "bytea", "json", "jsonb":
+		return false
+	}
+	return true
+}
@@ -0,0 +1,379 @@
+package postgres
+
+import (
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pingcap/errors"
+
+	"github.com/amyangfei/data-dam/db/dbutil"
+	"github.com/amyangfei/data-dam/pkg/models"
+	"github.com/amyangfei/data-dam/pkg/utils"
+)
+
+const (
+	queryMaxRetry = 3
+	smallIntMax   = 1 << 15
+)
+
+// TableName returns table name with schema
+func TableName(schema, name string) string {
+	return fmt.Sprintf("%s.%s", quoteName(schema), quoteName(name))
+}
+
+// quoteName quotes an identifier with double quotes
+func quoteName(name string) string {
+	return `"` + strings.Replace(name, `"`, `""`, -1) + `"`
+}
+
+// dialect implements dbutil.Dialect for PostgreSQL
+type dialect struct{}
+
+func (dialect) QuoteName(name string) string {
+	return quoteName(name)
+}
+
+func (dialect) TableName(schema, name string) string {
+	return TableName(schema, name)
+}
+
+func (dialect) Placeholder(n int) string {
+	return fmt.Sprintf("$%d", n)
+}
+
+func (dialect) IsIntegerColumn(column *models.Column) bool {
+	return isIntegerColumn(column)
+}
+
+func (dialect) IsBinaryColumn(column *models.Column) bool {
+	return isBinaryColumn(column)
+}
+
+func querySQL(db *sql.DB, query string, maxRetry int, args ...interface{}) (*sql.Rows, error) {
+	// TODO: add retry mechanism
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	return rows, nil
+}
+
+func getTableFromDB(db *sql.DB, schema string, name string) (*models.Table, error) {
+	table := &models.Table{}
+	table.Schema = schema
+	table.Name = name
+	table.IndexColumns = make(map[string][]*models.Column)
+	table.NonUniqueIndexColumns = make(map[string][]*models.Column)
+
+	err := getTableColumns(db, table, queryMaxRetry)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	err = getTableIndex(db, table, queryMaxRetry)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	if len(table.Columns) == 0 {
+		return nil, errors.Errorf("invalid table %s.%s", schema, name)
+	}
+
+	return table, nil
+}
+
+func getTableColumns(db *sql.DB, table *models.Table, maxRetry int) error {
+	if table.Schema == "" || table.Name == "" {
+		return errors.New("schema/table is empty")
+	}
+
+	query := `SELECT column_name, data_type, is_nullable, character_maximum_length,
+		numeric_precision, numeric_scale, column_default, is_identity
+		FROM information_schema.columns
+		WHERE table_schema = $1 AND table_name = $2
+		ORDER BY ordinal_position`
+	rows, err := querySQL(db, query, maxRetry, table.Schema, table.Name)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer rows.Close()
+
+	idx := 0
+	for rows.Next() {
+		var (
+			name, tp, nullable, identity string
+			maxLength, precision, scale  sql.NullInt64
+			defaultValue                 sql.NullString
+		)
+		err = rows.Scan(&name, &tp, &nullable, &maxLength, &precision, &scale, &defaultValue, &identity)
+		if err != nil {
+			return errors.Trace(err)
+		}
+
+		column := &models.Column{}
+		column.Idx = idx
+		column.Name = name
+		column.Tp = tp
+		switch {
+		case maxLength.Valid:
+			column.SubTp = strconv.FormatInt(maxLength.Int64, 10)
+		case tp == "numeric" && precision.Valid:
+			column.SubTp = fmt.Sprintf("%d,%d", precision.Int64, scale.Int64)
+		}
+		column.NotNull = strings.ToUpper(nullable) == "NO"
+		// serial and identity columns are treated as auto increment columns
+		if strings.ToUpper(identity) == "YES" ||
+			(defaultValue.Valid && strings.HasPrefix(defaultValue.String, "nextval(")) {
+			column.Extra = "auto_increment"
+		}
+
+		table.Columns = append(table.Columns, column)
+		idx++
+	}
+
+	if rows.Err() != nil {
+		return errors.Trace(rows.Err())
+	}
+
+	return nil
+}
+
+func getTableIndex(db *sql.DB, table *models.Table, maxRetry int) error {
+	if table.Schema == "" || table.Name == "" {
+		return errors.New("schema/table is empty")
+	}
+
+	query := `SELECT i.relname, ix.indisprimary, ix.indisunique, a.attname
+		FROM pg_catalog.pg_class t
+		JOIN pg_catalog.pg_namespace n ON n.oid = t.relnamespace
+		JOIN pg_catalog.pg_index ix ON ix.indrelid = t.oid
+		JOIN pg_catalog.pg_class i ON i.oid = ix.indexrelid
+		JOIN LATERAL unnest(ix.indkey) WITH ORDINALITY AS k(attnum, ord) ON true
+		JOIN pg_catalog.pg_attribute a ON a.attrelid = t.oid AND a.attnum = k.attnum
+		WHERE n.nspname = $1 AND t.relname = $2
+		ORDER BY i.relname, k.ord`
+	rows, err := querySQL(db, query, maxRetry, table.Schema, table.Name)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer rows.Close()
+
+	var (
+		columns          = make(map[string][]string)
+		nonUniqueColumns = make(map[string][]string)
+	)
+	for rows.Next() {
+		var (
+			keyName, column string
+			primary, unique bool
+		)
+		err = rows.Scan(&keyName, &primary, &unique, &column)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		switch {
+		case primary:
+			// keeps the same index name as MySQL
+			columns["primary"] = append(columns["primary"], column)
+		case unique:
+			columns[keyName] = append(columns[keyName], column)
+		default:
+			nonUniqueColumns[keyName] = append(nonUniqueColumns[keyName], column)
+		}
+	}
+	if rows.Err() != nil {
+		return errors.Trace(rows.Err())
+	}
+
+	table.IndexColumns = dbutil.FindColumns(table.Columns, columns)
+	table.NonUniqueIndexColumns = dbutil.FindColumns(table.Columns, nonUniqueColumns)
+	fillColumnKey(table)
+	return nil
+}
+
+// fillColumnKey fills `Key` of columns in the same way as `SHOW COLUMNS` in MySQL
+func fillColumnKey(table *models.Table) {
+	for keyName, cols := range table.IndexColumns {
+		if len(cols) == 0 {
+			continue
+		}
+		if keyName == "primary" {
+			for _, column := range cols {
+				column.Key = "PRI"
+			}
+		} else if len(cols) == 1 && cols[0].Key == "" {
+			cols[0].Key = "UNI"
+		} else if cols[0].Key == "" {
+			cols[0].Key = "MUL"
+		}
+	}
+	for _, cols := range table.NonUniqueIndexColumns {
+		if len(cols) > 0 && cols[0].Key == "" {
+			cols[0].Key = "MUL"
+		}
+	}
+}
+
+func findTables(db *sql.DB, schema string) ([]string, error) {
+	query := `SELECT table_name FROM information_schema.tables
+		WHERE table_schema = $1 AND table_type = 'BASE TABLE'`
+	rows, err := querySQL(db, query, queryMaxRetry, schema)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	defer rows.Close()
+
+	tables := make([]string, 0)
+	for rows.Next() {
+		var table string
+		err = rows.Scan(&table)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		tables = append(tables, table)
+	}
+
+	if rows.Err() != nil {
+		return nil, errors.Trace(rows.Err())
+	}
+
+	return tables, nil
+}
+
+// isIntegerColumn checks whether column is of an integer type
+func isIntegerColumn(column *models.Column) bool {
+	switch strings.ToLower(column.Tp) {
+	case "smallint", "integer", "bigint":
+		return true
+	}
+	return false
+}
+
+// isBinaryColumn checks whether values of column are binary strings
+func isBinaryColumn(column *models.Column) bool {
+	return strings.ToLower(column.Tp) == "bytea"
+}
+
+func getMaxID(db *sql.DB, schema, table, column string) (int64, error) {
+	stmt := fmt.Sprintf("SELECT COALESCE(MAX(%s), 0) FROM %s", quoteName(column), TableName(schema, table))
+	var id int64
+	err := db.QueryRow(stmt).Scan(&id)
+	return id, errors.Trace(err)
+}
+
+// getColumnValue returns the value of column in the row identified by keys, false if there is no such row
+func getColumnValue(db *sql.DB, table *models.Table, column *models.Column, keys map[string]interface{}) (interface{}, bool, error) {
+	args := make([]interface{}, 0, len(keys))
+	stmt := fmt.Sprintf("SELECT %s FROM %s WHERE %s LIMIT 1",
+		quoteName(column.Name), TableName(table.Schema, table.Name), genWhere(keys, &args))
+	var value interface{}
+	err := db.QueryRow(stmt, args...).Scan(&value)
+	if err == sql.ErrNoRows {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, errors.Trace(err)
+	}
+	return dbutil.KeyValue(dialect{}, column, value), true, nil
+}
+
+// genRandomValue generates a random value for the column, `Tp` of the column
+// is the `data_type` in information_schema.columns
+func genRandomValue(rnd *rand.Rand, column *models.Column) (interface{}, error) {
+	var value interface{}
+	switch strings.ToLower(column.Tp) {
+	case "smallint":
+		value = rnd.Intn(smallIntMax)
+	case "integer":
+		value = rnd.Int31()
+	case "bigint":
+		value = rnd.Int63()
+	case "real":
+		value = rnd.Float32()
+	case "double precision":
+		value = rnd.ExpFloat64()
+	case "numeric":
+		value = strconv.FormatFloat(rnd.ExpFloat64(), 'f', 5, 64)
+	case "boolean":
+		value = rnd.Intn(2) == 0
+	case "timestamp without time zone", "timestamp with time zone":
+		t := utils.RandomTime(rnd)
+		value = fmt.Sprintf("%.4d-%.2d-%.2d %.2d:%.2d:%.2d", t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second())
+	case "date":
+		t := utils.RandomTime(rnd)
+		value = fmt.Sprintf("%.4d-%.2d-%.2d", t.Year(), t.Month(), t.Day())
+	case "time without time zone", "time with time zone":
+		t := utils.RandomTime(rnd)
+		value = fmt.Sprintf("%.2d:%.2d:%.2d", t.Hour(), t.Minute(), t.Second())
+	case "character":
+		n, err := strconv.Atoi(column.SubTp)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		value = utils.RandomString(rnd, n)
+	case "character varying":
+		n := 64
+		// varchar without length modifier accepts strings of any size
+		if column.SubTp != "" {
+			var err error
+			n, err = strconv.Atoi(column.SubTp)
+			if err != nil {
+				return nil, errors.Trace(err)
+			}
+		}
+		value = utils.RandomString(rnd, rnd.Intn(n)+1)
+	case "text":
+		value = utils.RandomString(rnd, 20)
+	case "bytea":
+		b := make([]byte, 20)
+		rnd.Read(b)
+		value = b
+	case "uuid":
+		b := make([]byte, 16)
+		rnd.Read(b)
+		s := hex.EncodeToString(b)
+		value = fmt.Sprintf("%s-%s-%s-%s-%s", s[0:8], s[8:12], s[12:16], s[16:20], s[20:])
+	case "json", "jsonb":
+		value = fmt.Sprintf(`{"%s": %d}`, utils.RandomString(rnd, 8), rnd.Int31())
+	default:
+		return nil, errors.NotSupportedf("column %s of type %s", column.Name, column.Tp)
+	}
+	return value, nil
+}
+
+// formatValue formats a value as SQL literal, strings are quoted with standard conforming strings
+func formatValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "NULL"
+	case bool:
+		if v {
+			return "TRUE"
+		}
+		return "FALSE"
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return fmt.Sprintf("%d", v)
+	case float32:
+		return strconv.FormatFloat(float64(v), 'g', -1, 32)
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	case []byte:
+		return fmt.Sprintf(`'\x%x'`, v)
+	case time.Time:
+		return "'" + v.Format("2006-01-02 15:04:05.999999") + "'"
+	case string:
+		return quoteString(v)
+	default:
+		return quoteString(fmt.Sprintf("%v", v))
+	}
+}
+
+// quoteString quotes a string literal, single quotes are doubled
+func quoteString(s string) string {
+	return "'" + strings.Replace(s, "'", "''", -1) + "'"
+}
@@ -0,0 +1,421 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+
+	_ "github.com/mattn/go-sqlite3" // import sqlite driver
+	"github.com/pingcap/errors"
+
+	"github.com/amyangfei/data-dam/db/dbutil"
+	"github.com/amyangfei/data-dam/pkg/models"
+)
+
+const (
+	defaultBusyTimeout = 5000 // milliseconds
+)
+
+// ImpSQLiteDB implements models.DB
+type ImpSQLiteDB struct {
+	*models.Workload
+
+	db         *sql.DB
+	tx         *sql.Tx // transaction started by Begin, DMLs are executed in it if not nil
+	verbose    bool
+	sortFields bool
+	ddlTypes   []models.DDLType
+	rnd        *rand.Rand // random source of generated DDL, shared with Workload
+}
+
+type sqliteCreator struct {
+}
+
+func createDB(cfg models.SQLiteConfig) (*sql.DB, error) {
+	if cfg.Path == "" {
+		return nil, errors.New("path of sqlite database is empty")
+	}
+	// every worker has its own connection pool, WAL and busy timeout reduce `database is locked` errors,
+	// transactions take the write lock at BEGIN so that they wait for the busy timeout instead of failing.
+	dsn := fmt.Sprintf("file:%s?_busy_timeout=%d&_journal_mode=WAL&_txlock=immediate", cfg.Path, defaultBusyTimeout)
+	db, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	// SQLite serializes writes, besides a single connection makes sure the
+	// schema reloaded by `refreshSchema` is the one used in later queries.
+	db.SetMaxOpenConns(1)
+	return db, nil
+}
+
+// Create creates a models.DB
+func (c sqliteCreator) Create(cfg *models.DBConfig) (models.DB, error) {
+	sd := &ImpSQLiteDB{
+		sortFields: cfg.SortFields,
+		verbose:    cfg.Verbose,
+		ddlTypes:   defaultDDLTypes,
+		rnd:        rand.New(rand.NewSource(cfg.Seed)),
+	}
+	if cfg.SQLFile.Path != "" {
+		return nil, errors.NotSupportedf("sql-file output in SQLite")
+	}
+	if len(cfg.DDLTypes) > 0 {
+		ddlTypes, err := models.ParseDDLTypes(cfg.DDLTypes)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		for _, tp := range ddlTypes {
+			if !isSupportedDDLType(tp) {
+				return nil, errors.NotSupportedf("DDL type %s in SQLite", tp)
+			}
+		}
+		sd.ddlTypes = ddlTypes
+	}
+	db, err := createDB(cfg.SQLite)
+	if err != nil {
+		if db != nil {
+			db.Close()
+		}
+		return nil, errors.Trace(err)
+	}
+	sd.db = db
+	sd.Workload = models.NewWorkload(tableSource{db}, sd.rnd, cfg)
+	return sd, nil
+}
+
+func genSetFields(values map[string]interface{}, args *[]interface{}) string {
+	parts := make([]string, 0, len(values))
+	for k, v := range values {
+		parts = append(parts, fmt.Sprintf("%s = ?", quoteName(k)))
+		*args = append(*args, v)
+	}
+	return strings.Join(parts, ", ")
+}
+
+func genWhere(keys map[string]interface{}, args *[]interface{}) string {
+	parts := make([]string, 0, len(keys))
+	for k, v := range keys {
+		kvSplit := "="
+		if v == nil {
+			kvSplit = "IS"
+		}
+		parts = append(parts, fmt.Sprintf("%s %s ?", quoteName(k), kvSplit))
+		*args = append(*args, v)
+	}
+	return strings.Join(parts, " AND ")
+}
+
+// genPlainSQL replaces placeholders in statement with escaped literal values
+func (sd *ImpSQLiteDB) genPlainSQL(stmt string, args []interface{}) string {
+	var (
+		buf strings.Builder
+		idx = 0
+	)
+	buf.Grow(len(stmt))
+	for i := 0; i < len(stmt); i++ {
+		if stmt[i] != '?' || idx >= len(args) {
+			buf.WriteByte(stmt[i])
+			continue
+		}
+		buf.WriteString(formatValue(args[idx]))
+		idx++
+	}
+	return buf.String()
+}
+
+// executor executes statements in *sql.DB or *sql.Tx
+type executor interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+func (sd *ImpSQLiteDB) executor() executor {
+	if sd.tx != nil {
+		return sd.tx
+	}
+	return sd.db
+}
+
+// Begin implements `Begin` of models.DB
+func (sd *ImpSQLiteDB) Begin(_ context.Context) error {
+	if sd.tx != nil {
+		return errors.New("transaction is already started")
+	}
+	// jobs in progress are finished when dispatcher is canceled, so the transaction is not bound to ctx
+	tx, err := sd.db.Begin()
+	if err != nil {
+		return errors.Trace(err)
+	}
+	sd.tx = tx
+	return nil
+}
+
+// Commit implements `Commit` of models.DB
+func (sd *ImpSQLiteDB) Commit(_ context.Context) error {
+	if sd.tx == nil {
+		return errors.New("transaction is not started")
+	}
+	err := sd.tx.Commit()
+	sd.tx = nil
+	return errors.Trace(err)
+}
+
+// Rollback implements `Rollback` of models.DB
+func (sd *ImpSQLiteDB) Rollback(_ context.Context) error {
+	if sd.tx == nil {
+		return errors.New("transaction is not started")
+	}
+	err := sd.tx.Rollback()
+	sd.tx = nil
+	return errors.Trace(err)
+}
+
+// Insert implements `Insert` of models.DB
+func (sd *ImpSQLiteDB) Insert(_ context.Context, schema, table string, values map[string]interface{}) (int64, error) {
+	var (
+		args    = make([]interface{}, 0, len(values))
+		columns = make([]string, 0, len(values))
+		holders = make([]string, 0, len(values))
+		err     error
+	)
+
+	build := func(key string, value interface{}) {
+		columns = append(columns, quoteName(key))
+		holders = append(holders, "?")
+		args = append(args, value)
+	}
+
+	if sd.sortFields {
+		var keys []string
+		for k := range values {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			build(k, values[k])
+		}
+	} else {
+		for k, v := range values {
+			build(k, v)
+		}
+	}
+	stmt := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s);", TableName(schema, table), strings.Join(columns, ", "), strings.Join(holders, ", "))
+	if len(values) == 0 {
+		stmt = fmt.Sprintf("INSERT INTO %s DEFAULT VALUES;", TableName(schema, table))
+	}
+	var (
+		id  int64
+		res sql.Result
+	)
+	res, err = sd.executor().Exec(stmt, args...)
+	if err == nil {
+		id, err = res.LastInsertId()
+	}
+
+	if sd.verbose {
+		stmt = sd.genPlainSQL(stmt, args)
+		fmt.Println(stmt)
+	}
+
+	return id, errors.Trace(err)
+}
+
+// Upsert implements `Upsert` of models.DB, upserts and insert-ignores are
+// `INSERT ... ON CONFLICT` of key columns.
+func (sd *ImpSQLiteDB) Upsert(_ context.Context, tp models.OpType, schema, table string, keys map[string]interface{}, values map[string]interface{}) error {
+	var (
+		names  = dbutil.FieldNames(values, sd.sortFields)
+		args   = make([]interface{}, 0, len(names))
+		tuple  = dbutil.GenValueTuples(dialect{}, names, []map[string]interface{}{values}, &args)[0]
+		target = fmt.Sprintf("%s (%s) VALUES (%s)", TableName(schema, table), dbutil.JoinNames(dialect{}, names), tuple)
+		stmt   string
+	)
+	switch tp {
+	case models.Replace:
+		stmt = fmt.Sprintf("REPLACE INTO %s;", target)
+	case models.Upsert:
+		assigns := make([]string, 0, len(names))
+		for _, name := range dbutil.UpdatedNames(names, keys) {
+			assigns = append(assigns, fmt.Sprintf("%s = excluded.%s", quoteName(name), quoteName(name)))
+		}
+		stmt = fmt.Sprintf("INSERT INTO %s ON CONFLICT (%s) DO UPDATE SET %s;",
+			target, dbutil.JoinNames(dialect{}, dbutil.FieldNames(keys, sd.sortFields)), strings.Join(assigns, ", "))
+	case models.InsertIgnore:
+		stmt = fmt.Sprintf("INSERT OR IGNORE INTO %s;", target)
+	default:
+		return errors.NotValidf("upsert OpType %s", tp)
+	}
+	_, err := sd.executor().Exec(stmt, args...)
+
+	if sd.verbose {
+		stmt = sd.genPlainSQL(stmt, args)
+		fmt.Println(stmt)
+	}
+
+	return errors.Trace(err)
+}
+
+// RangeUpdate implements `RangeUpdate` of models.DB
+func (sd *ImpSQLiteDB) RangeUpdate(_ context.Context, schema, table string, rng *models.RangeParams, values map[string]interface{}) error {
+	args := make([]interface{}, 0, len(values)+2)
+	kvs := genSetFields(values, &args)
+	where := genRangeWhere(TableName(schema, table), rng, &args)
+	stmt := fmt.Sprintf("UPDATE %s SET %s WHERE %s;", TableName(schema, table), kvs, where)
+	_, err := sd.executor().Exec(stmt, args...)
+
+	if sd.verbose {
+		stmt = sd.genPlainSQL(stmt, args)
+		fmt.Println(stmt)
+	}
+
+	return errors.Trace(err)
+}
+
+// RangeDelete implements `RangeDelete` of models.DB
+func (sd *ImpSQLiteDB) RangeDelete(_ context.Context, schema, table string, rng *models.RangeParams) error {
+	args := make([]interface{}, 0, 2)
+	where := genRangeWhere(TableName(schema, table), rng, &args)
+	stmt := fmt.Sprintf("DELETE FROM %s WHERE %s;", TableName(schema, table), where)
+	_, err := sd.executor().Exec(stmt, args...)
+
+	if sd.verbose {
+		stmt = sd.genPlainSQL(stmt, args)
+		fmt.Println(stmt)
+	}
+
+	return errors.Trace(err)
+}
+
+// genRangeWhere generates the condition of rng, such as `"id" BETWEEN ? AND ?` or `"c" = ?`.
+// UPDATE and DELETE have no LIMIT in default builds of SQLite, so limited rows are
+// chosen by rowid in a subquery.
+func genRangeWhere(name string, rng *models.RangeParams, args *[]interface{}) string {
+	var where string
+	if rng.End == nil {
+		where = genWhere(map[string]interface{}{rng.Column: rng.Begin}, args)
+	} else {
+		*args = append(*args, rng.Begin, rng.End)
+		where = fmt.Sprintf("%s BETWEEN ? AND ?", quoteName(rng.Column))
+	}
+	if rng.Limit <= 0 {
+		return where
+	}
+	return fmt.Sprintf("rowid IN (SELECT rowid FROM %s WHERE %s LIMIT %d)", name, where, rng.Limit)
+}
+
+// BatchInsert implements `BatchInsert` of models.DB
+func (sd *ImpSQLiteDB) BatchInsert(_ context.Context, schema, table string, rows []map[string]interface{}) error {
+	if len(rows) == 0 {
+		return nil
+	}
+	var (
+		names  = dbutil.FieldNames(rows[0], sd.sortFields)
+		args   = make([]interface{}, 0, len(names)*len(rows))
+		tuples = dbutil.GenValueTuples(dialect{}, names, rows, &args)
+	)
+	for idx := range tuples {
+		tuples[idx] = "(" + tuples[idx] + ")"
+	}
+	stmt := fmt.Sprintf("INSERT INTO %s (%s) VALUES %s;",
+		TableName(schema, table), dbutil.JoinNames(dialect{}, names), strings.Join(tuples, ", "))
+	_, err := sd.executor().Exec(stmt, args...)
+
+	if sd.verbose {
+		stmt = sd.genPlainSQL(stmt, args)
+		fmt.Println(stmt)
+	}
+
+	return errors.Trace(err)
+}
+
+// BatchDelete implements `BatchDelete` of models.DB
+func (sd *ImpSQLiteDB) BatchDelete(_ context.Context, schema, table string, keys []map[string]interface{}) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	var (
+		names  = dbutil.FieldNames(keys[0], sd.sortFields)
+		args   = make([]interface{}, 0, len(names)*len(keys))
+		tuples = dbutil.GenValueTuples(dialect{}, names, keys, &args)
+		target = dbutil.JoinNames(dialect{}, names)
+	)
+	list := strings.Join(tuples, ", ")
+	// composite keys are compared as row values, SQLite requires a VALUES clause
+	// for a list of them, such as `(a, b) IN (VALUES (?, ?), (?, ?))`
+	if len(names) > 1 {
+		target = "(" + target + ")"
+		for idx := range tuples {
+			tuples[idx] = "(" + tuples[idx] + ")"
+		}
+		list = "VALUES " + strings.Join(tuples, ", ")
+	}
+	stmt := fmt.Sprintf("DELETE FROM %s WHERE %s IN (%s);", TableName(schema, table), target, list)
+	_, err := sd.executor().Exec(stmt, args...)
+
+	if sd.verbose {
+		stmt = sd.genPlainSQL(stmt, args)
+		fmt.Println(stmt)
+	}
+
+	return errors.Trace(err)
+}
+
+// Update implements `Update` of models.DB
+func (sd *ImpSQLiteDB) Update(_ context.Context, schema, table string, keys map[string]interface{}, values map[string]interface{}) error {
+	args := make([]interface{}, 0, len(keys)+len(values))
+	kvs := genSetFields(values, &args)
+	where := genWhere(keys, &args)
+	stmt := fmt.Sprintf("UPDATE %s SET %s WHERE %s;", TableName(schema, table), kvs, where)
+	_, err := sd.executor().Exec(stmt, args...)
+
+	if sd.verbose {
+		stmt = sd.genPlainSQL(stmt, args)
+		fmt.Println(stmt)
+	}
+
+	return errors.Trace(err)
+}
+
+// Delete implements `Delete` of models.DB
+func (sd *ImpSQLiteDB) Delete(_ context.Context, schema, table string, keys map[string]interface{}) error {
+	args := make([]interface{}, 0, len(keys))
+	where := genWhere(keys, &args)
+	stmt := fmt.Sprintf("DELETE FROM %s WHERE %s;", TableName(schema, table), where)
+	_, err := sd.executor().Exec(stmt, args...)
+
+	if sd.verbose {
+		stmt = sd.genPlainSQL(stmt, args)
+		fmt.Println(stmt)
+	}
+
+	return errors.Trace(err)
+}
+
+// Exec implements `Exec` of models.DB
+func (sd *ImpSQLiteDB) Exec(_ context.Context, stmt string) error {
+	_, err := sd.executor().Exec(stmt)
+
+	if sd.verbose {
+		fmt.Println(stmt)
+	}
+
+	return errors.Trace(err)
+}
+
+// Close implements `Close` of models.DB
+func (sd *ImpSQLiteDB) Close() error {
+	if sd.db != nil {
+		err := sd.db.Close()
+		if err != nil {
+			return errors.Trace(err)
+		}
+	}
+	return nil
+}
+
+func init() {
+	models.RegisterDBCreator("sqlite", sqliteCreator{})
+}
@@ -0,0 +1,470 @@
+package sqlite
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/amyangfei/data-dam/pkg/models"
+)
+
+// newTestDB creates a SQLite database in a temporary directory and executes stmts
+// in it. cleanup closes the database and removes the directory.
+func newTestDB(t *testing.T, cfg *models.DBConfig, stmts ...string) (*ImpSQLiteDB, func()) {
+	dir, err := ioutil.TempDir("", "data-dam")
+	require.NoError(t, err)
+	cfg.SQLite = models.SQLiteConfig{Path: filepath.Join(dir, "dam.db")}
+	db, err := sqliteCreator{}.Create(cfg)
+	if err != nil {
+		os.RemoveAll(dir)
+		require.NoError(t, err)
+	}
+	sd := db.(*ImpSQLiteDB)
+	cleanup := func() {
+		sd.Close()
+		os.RemoveAll(dir)
+	}
+	for _, stmt := range stmts {
+		if _, err = sd.db.Exec(stmt); err != nil {
+			cleanup()
+			require.NoError(t, err)
+		}
+	}
+	return sd, cleanup
+}
+
+// newTestDispatcher returns a dispatcher executing jobs in the database of cfg, tables
+// of main schema are prepared. It is not running yet.
+func newTestDispatcher(ctx context.Context, t *testing.T, cfg *models.DBConfig, batchSize int) *models.JobDispatcher {
+	dispatcher, err := models.NewJobDispatcher(ctx, 2, batchSize, cfg, sqliteCreator{})
+	require.NoError(t, err)
+	require.NoError(t, dispatcher.PrepareTables(ctx, "main"))
+	return dispatcher
+}
+
+// countRows returns the number of rows in table of main schema
+func countRows(t *testing.T, sd *ImpSQLiteDB, table string) int {
+	var count int
+	require.NoError(t, sd.db.QueryRow("SELECT COUNT(*) FROM "+TableName("main", table)).Scan(&count))
+	return count
+}
+
+func TestGenerateDML(t *testing.T) {
+	sd, cleanup := newTestDB(t, &models.DBConfig{}, "CREATE TABLE t (id INTEGER PRIMARY KEY, name VARCHAR(32), score INT, created DATETIME)")
+	defer cleanup()
+	ctx := context.Background()
+	_, _, err := sd.PrepareTables(ctx, "main")
+	require.NoError(t, err)
+
+	for i := 0; i < 10; i++ {
+		p, err := sd.GenerateDML(ctx, models.Insert)
+		require.NoError(t, err)
+		assert.Equal(t, models.Insert, p.Type)
+		assert.Equal(t, int64(i+1), p.Values["id"])
+		_, err = sd.Insert(ctx, p.Schema, p.Table, p.Values)
+		require.NoError(t, err)
+	}
+	assert.Equal(t, 10, countRows(t, sd, "t"))
+
+	p, err := sd.GenerateDML(ctx, models.Update)
+	require.NoError(t, err)
+	assert.Equal(t, models.Update, p.Type)
+	assert.NotContains(t, p.Values, "id")
+	require.NoError(t, sd.Update(ctx, p.Schema, p.Table, p.Keys, p.Values))
+
+	p, err = sd.GenerateDML(ctx, models.Delete)
+	require.NoError(t, err)
+	assert.Equal(t, models.Delete, p.Type)
+	require.NoError(t, sd.Delete(ctx, p.Schema, p.Table, p.Keys))
+	assert.Equal(t, 9, countRows(t, sd, "t"))
+}
+
+func TestGenerateDMLWithSeed(t *testing.T) {
+	generate := func(seed int64) []*models.DMLParams {
+		sd, cleanup := newTestDB(t, &models.DBConfig{Seed: seed},
+			"CREATE TABLE t (id INTEGER PRIMARY KEY, name VARCHAR(32), score INT, created DATETIME, data BLOB)")
+		defer cleanup()
+		ctx := context.Background()
+		_, _, err := sd.PrepareTables(ctx, "main")
+		require.NoError(t, err)
+
+		params := make([]*models.DMLParams, 0, 10)
+		for i := 0; i < 10; i++ {
+			p, err := sd.GenerateDML(ctx, models.Insert)
+			require.NoError(t, err)
+			params = append(params, p)
+		}
+		return params
+	}
+
+	assert.Equal(t, generate(42), generate(42))
+	assert.NotEqual(t, generate(42), generate(43))
+}
+
+func TestTableLifecycle(t *testing.T) {
+	cfg := &models.DBConfig{DDLTypes: []string{"create-table", "drop-table", "truncate-table", "rename-table"}}
+	sd, cleanup := newTestDB(t, cfg, "CREATE TABLE t (id INTEGER PRIMARY KEY, name VARCHAR(32))")
+	defer cleanup()
+	ctx := context.Background()
+	_, _, err := sd.PrepareTables(ctx, "main")
+	require.NoError(t, err)
+
+	// rows are inserted between DDLs, ids of renamed and truncated tables never conflict
+	for i := 0; i < 30; i++ {
+		ddl, err := sd.GenerateDDL(ctx)
+		require.NoError(t, err)
+		require.NoError(t, sd.ExecDDL(ctx, ddl))
+		require.NoError(t, sd.RefreshTableCache(ctx, ddl))
+		for j := 0; j < 3; j++ {
+			p, err := sd.GenerateDML(ctx, models.Insert)
+			require.NoError(t, err)
+			_, err = sd.Insert(ctx, p.Schema, p.Table, p.Values)
+			require.NoError(t, err)
+		}
+	}
+
+	// table cache follows created, dropped and renamed tables
+	names, err := findTables(sd.db, "main")
+	require.NoError(t, err)
+	assert.Equal(t, len(names), sd.TableCount())
+	for _, name := range names {
+		_, ok := sd.CachedTable("main", name)
+		assert.True(t, ok, name)
+	}
+}
+
+func TestGenerateDMLLiveKeys(t *testing.T) {
+	sd, cleanup := newTestDB(t, &models.DBConfig{},
+		"CREATE TABLE t (id INTEGER PRIMARY KEY, name VARCHAR(32))",
+		"INSERT INTO t VALUES (1, 'a'), (3, 'b'), (8, 'c')")
+	defer cleanup()
+	ctx := context.Background()
+	_, _, err := sd.PrepareTables(ctx, "main")
+	require.NoError(t, err)
+
+	// keys of updates are live rows, deleted keys are never chosen again
+	live := map[int64]bool{1: true, 3: true, 8: true}
+	for i := 0; i < 20; i++ {
+		p, err := sd.GenerateDML(ctx, models.Update)
+		require.NoError(t, err)
+		assert.True(t, live[p.Keys["id"].(int64)])
+	}
+	p, err := sd.GenerateDML(ctx, models.Insert)
+	require.NoError(t, err)
+	assert.Equal(t, int64(9), p.Keys["id"])
+	live[9] = true
+	for len(live) > 0 {
+		p, err = sd.GenerateDML(ctx, models.Delete)
+		require.NoError(t, err)
+		id := p.Keys["id"].(int64)
+		assert.True(t, live[id])
+		delete(live, id)
+	}
+	// a table without live rows only receives inserts
+	p, err = sd.GenerateDML(ctx, models.Delete)
+	require.NoError(t, err)
+	assert.Equal(t, models.Insert, p.Type)
+	assert.Equal(t, int64(10), p.Keys["id"])
+}
+
+func TestGenerateDMLTableKeys(t *testing.T) {
+	sd, cleanup := newTestDB(t, &models.DBConfig{},
+		"CREATE TABLE composite (region TEXT NOT NULL, seq INTEGER NOT NULL, name VARCHAR(32), PRIMARY KEY (region, seq))",
+		"INSERT INTO composite VALUES ('eu', 1, 'a'), ('us', 1, 'b')",
+		"CREATE TABLE code (code VARCHAR(16) PRIMARY KEY, name VARCHAR(32))",
+		"INSERT INTO code VALUES ('x', 'a')",
+		"CREATE TABLE uk (email VARCHAR(32) NOT NULL UNIQUE, name VARCHAR(32))",
+		"INSERT INTO uk VALUES ('a@b', 'a')",
+		"CREATE TABLE nokey (name VARCHAR(32))")
+	defer cleanup()
+	ctx := context.Background()
+	_, _, err := sd.PrepareTables(ctx, "main")
+	require.NoError(t, err)
+
+	keysOf := map[string][]string{
+		"composite": {"region", "seq"},
+		"code":      {"code"},
+		"uk":        {"email"},
+	}
+	rowOf := func(table string, keys map[string]interface{}) string {
+		row := table
+		for _, name := range keysOf[table] {
+			row += fmt.Sprintf(",%v", keys[name])
+		}
+		return row
+	}
+	// deletes only choose live rows, inserted rows become live
+	live := map[string]bool{"composite,eu,1": true, "composite,us,1": true, "code,x": true, "uk,a@b": true}
+	for i := 0; i < 200; i++ {
+		p, err := sd.GenerateDML(ctx, models.Delete)
+		require.NoError(t, err)
+		names, ok := keysOf[p.Table]
+		if !ok {
+			assert.Equal(t, "nokey", p.Table)
+			assert.Equal(t, models.Insert, p.Type)
+			assert.Empty(t, p.Keys)
+			continue
+		}
+		require.Len(t, p.Keys, len(names))
+		row := rowOf(p.Table, p.Keys)
+		if p.Type == models.Insert {
+			for _, name := range names {
+				assert.Equal(t, p.Keys[name], p.Values[name])
+			}
+			assert.False(t, live[row])
+			live[row] = true
+		} else {
+			assert.True(t, live[row], row)
+			delete(live, row)
+		}
+	}
+}
+
+func TestTransactions(t *testing.T) {
+	cfg := &models.DBConfig{}
+	sd, cleanup := newTestDB(t, cfg, "CREATE TABLE t (id INTEGER PRIMARY KEY, name VARCHAR(32))")
+	defer cleanup()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	_, _, err := sd.PrepareTables(ctx, "main")
+	require.NoError(t, err)
+
+	path := filepath.Join(filepath.Dir(cfg.SQLite.Path), "journal.json")
+	journal, err := models.NewJournal(path)
+	require.NoError(t, err)
+	dispatcher := newTestDispatcher(ctx, t, cfg, 3)
+	defer dispatcher.Close()
+	dispatcher.Journal = journal
+	dispatcher.Txn = models.TxnConfig{Size: 4, RollbackRatio: 0.5}
+	var (
+		mu         sync.Mutex
+		rolledBack []*models.DMLParams
+	)
+	dispatcher.SetRollbackHook(func(dml *models.DMLParams) {
+		mu.Lock()
+		defer mu.Unlock()
+		rolledBack = append(rolledBack, dml)
+	})
+	go dispatcher.Run(ctx)
+
+	for i := 0; i < 200; i++ {
+		p, err := sd.GenerateDML(ctx, models.Insert)
+		require.NoError(t, err)
+		dispatcher.AddDML(p)
+	}
+	dispatcher.Flush()
+	for _, dml := range rolledBack {
+		sd.UntrackDML(dml)
+	}
+	require.NoError(t, journal.Close())
+	stats := dispatcher.Stats.Snapshot()
+	assert.True(t, stats.Commits > 0)
+	assert.True(t, stats.Rollbacks > 0)
+	_, errCount := stats.Total()
+	assert.Equal(t, int64(0), errCount)
+
+	// only inserts of committed transactions are applied
+	data, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	assert.Len(t, lines, 200)
+	committed := 0
+	for _, line := range lines {
+		record := &models.JournalRecord{}
+		require.NoError(t, json.Unmarshal([]byte(line), record))
+		if !record.Rollback {
+			committed++
+		}
+	}
+	assert.Equal(t, committed, countRows(t, sd, "t"))
+	assert.Len(t, rolledBack, 200-committed)
+
+	// keys of rolled back inserts are never deleted
+	deletes := 0
+	for {
+		p, err := sd.GenerateDML(ctx, models.Delete)
+		require.NoError(t, err)
+		if p.Type != models.Delete {
+			break
+		}
+		deletes++
+	}
+	assert.Equal(t, committed, deletes)
+}
+
+func TestCoalesce(t *testing.T) {
+	cfg := &models.DBConfig{}
+	sd, cleanup := newTestDB(t, cfg, "CREATE TABLE t (region TEXT NOT NULL, seq INTEGER NOT NULL, name VARCHAR(32), PRIMARY KEY (region, seq))")
+	defer cleanup()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	_, _, err := sd.PrepareTables(ctx, "main")
+	require.NoError(t, err)
+
+	dispatcher := newTestDispatcher(ctx, t, cfg, 8)
+	defer dispatcher.Close()
+	dispatcher.Coalesce = true
+	go dispatcher.Run(ctx)
+
+	// every coalesced delete removes a row inserted before
+	counts := make(map[models.OpType]int)
+	for i := 0; i < 400; i++ {
+		op := models.Insert
+		if i%4 == 3 {
+			op = models.Delete
+		}
+		p, err := sd.GenerateDML(ctx, op)
+		require.NoError(t, err)
+		dispatcher.AddDML(p)
+		counts[p.Type]++
+	}
+	dispatcher.Flush()
+	_, errCount := dispatcher.Stats.Snapshot().Total()
+	assert.Equal(t, int64(0), errCount)
+	assert.True(t, counts[models.Delete] > 0)
+	assert.Equal(t, counts[models.Insert]-counts[models.Delete], countRows(t, sd, "t"))
+}
+
+func TestUpserts(t *testing.T) {
+	cfg := &models.DBConfig{}
+	sd, cleanup := newTestDB(t, cfg, "CREATE TABLE t (id INTEGER PRIMARY KEY, name VARCHAR(32))")
+	defer cleanup()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	_, _, err := sd.PrepareTables(ctx, "main")
+	require.NoError(t, err)
+
+	dispatcher := newTestDispatcher(ctx, t, cfg, 3)
+	defer dispatcher.Close()
+	go dispatcher.Run(ctx)
+
+	// statements hitting live keys never add rows
+	ops := []models.OpType{models.Insert, models.Replace, models.Upsert, models.InsertIgnore}
+	counts := make(map[models.OpType]int)
+	for i := 0; i < 400; i++ {
+		p, err := sd.GenerateDML(ctx, ops[i%len(ops)])
+		require.NoError(t, err)
+		dispatcher.AddDML(p)
+		counts[p.Type]++
+	}
+	dispatcher.Flush()
+	_, errCount := dispatcher.Stats.Snapshot().Total()
+	assert.Equal(t, int64(0), errCount)
+	for _, tp := range ops[1:] {
+		assert.True(t, counts[tp] > 0, tp)
+	}
+	count := countRows(t, sd, "t")
+	assert.True(t, count >= counts[models.Insert])
+	assert.True(t, count < 400)
+}
+
+func TestGenerateDMLRanges(t *testing.T) {
+	sd, cleanup := newTestDB(t, &models.DBConfig{MaxRows: 3},
+		"CREATE TABLE t (id INTEGER PRIMARY KEY, name VARCHAR(32))",
+		"INSERT INTO t VALUES (1, 'a'), (2, 'b'), (3, 'c'), (4, 'd')")
+	defer cleanup()
+	ctx := context.Background()
+	_, _, err := sd.PrepareTables(ctx, "main")
+	require.NoError(t, err)
+
+	// ranges of integer keys start from a live key, keys in deleted ranges are never chosen again
+	var (
+		deleted = make(map[int64]bool)
+		maxID   = int64(4)
+	)
+	for i := 0; i < 10; i++ {
+		p, err := sd.GenerateDML(ctx, models.RangeDelete)
+		require.NoError(t, err)
+		if p.Type == models.Insert {
+			maxID = p.Keys["id"].(int64)
+			continue
+		}
+		require.Equal(t, models.RangeDelete, p.Type)
+		begin, end := p.Range.Begin.(int64), p.Range.End.(int64)
+		assert.False(t, deleted[begin])
+		assert.True(t, end-begin < 3)
+		// ranges never cover ids of later inserts
+		assert.True(t, end <= maxID)
+		assert.Equal(t, 0, p.Range.Limit)
+		for id := begin; id <= end; id++ {
+			deleted[id] = true
+		}
+	}
+
+	// other keys change rows of the same value of an indexed column
+	sd, cleanup = newTestDB(t, &models.DBConfig{MaxRows: 3},
+		"CREATE TABLE u (code VARCHAR(8) PRIMARY KEY, grp INTEGER)",
+		"CREATE INDEX idx_grp ON u (grp)",
+		"INSERT INTO u VALUES ('a', 1), ('b', 1), ('c', 2)")
+	defer cleanup()
+	_, _, err = sd.PrepareTables(ctx, "main")
+	require.NoError(t, err)
+	p, err := sd.GenerateDML(ctx, models.RangeUpdate)
+	require.NoError(t, err)
+	require.Equal(t, models.RangeUpdate, p.Type)
+	assert.Equal(t, "grp", p.Range.Column)
+	assert.Nil(t, p.Range.End)
+	assert.True(t, p.Range.Limit >= 1 && p.Range.Limit <= 3)
+	assert.Contains(t, []interface{}{int64(1), int64(2)}, p.Range.Begin)
+	assert.Contains(t, p.Values, "grp")
+}
+
+func TestRanges(t *testing.T) {
+	cfg := &models.DBConfig{MaxRows: 5}
+	sd, cleanup := newTestDB(t, cfg,
+		"CREATE TABLE t (id INTEGER PRIMARY KEY, name VARCHAR(32))",
+		"CREATE TABLE u (code VARCHAR(8) PRIMARY KEY, grp INTEGER)",
+		"CREATE INDEX idx_grp ON u (grp)")
+	defer cleanup()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	_, _, err := sd.PrepareTables(ctx, "main")
+	require.NoError(t, err)
+
+	dispatcher := newTestDispatcher(ctx, t, cfg, 3)
+	defer dispatcher.Close()
+	go dispatcher.Run(ctx)
+
+	ops := []models.OpType{models.Insert, models.Insert, models.Insert, models.Insert, models.RangeUpdate, models.RangeDelete}
+	counts := make(map[models.OpType]int)
+	for i := 0; i < 300; i++ {
+		p, err := sd.GenerateDML(ctx, ops[i%len(ops)])
+		require.NoError(t, err)
+		dispatcher.AddDML(p)
+		counts[p.Type]++
+	}
+	dispatcher.Flush()
+	_, errCount := dispatcher.Stats.Snapshot().Total()
+	assert.Equal(t, int64(0), errCount)
+	assert.True(t, counts[models.RangeUpdate] > 0)
+	assert.True(t, counts[models.RangeDelete] > 0)
+}
+
+func TestGenRandomValue(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	for _, tp := range []string{"DECIMAL", "NUMERIC"} {
+		value, err := genRandomValue(rnd, &models.Column{Name: "n", Tp: tp})
+		require.NoError(t, err)
+		assert.IsType(t, "", value)
+	}
+
+	_, err := genRandomValue(rnd, &models.Column{Name: "t", Tp: "TIME"})
+	assert.Error(t, err)
+}
+
+func TestGenPlainSQL(t *testing.T) {
+	sd := &ImpSQLiteDB{}
+	args := []interface{}{"a?'b", nil, 10, 0.1, 1e-7, []byte{0x1, 0xab}, true}
+	stmt := sd.genPlainSQL("INSERT INTO t VALUES (?, ?, ?, ?, ?, ?, ?, ?);", args)
+	assert.Equal(t, "INSERT INTO t VALUES ('a?''b', NULL, 10, 0.1, 1e-07, X'01AB', 1, ?);", stmt)
+}
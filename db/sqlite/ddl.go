@@ -0,0 +1,307 @@
+package sqlite
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pingcap/errors"
+
+	"github.com/amyangfei/data-dam/db/dbutil"
+	"github.com/amyangfei/data-dam/pkg/models"
+	"github.com/amyangfei/data-dam/pkg/utils"
+)
+
+var (
+	// defaultDDLTypes contains DDL types generated if `ddl-types` is not configured
+	defaultDDLTypes = []models.DDLType{
+		models.AddColumn,
+		models.CreateIndex,
+		models.DropIndex,
+	}
+
+	// supportedDDLTypes contains all DDL types ImpSQLiteDB can generate,
+	// DROP COLUMN and MODIFY COLUMN are not supported by SQLite.
+	supportedDDLTypes = []models.DDLType{
+		models.AddColumn,
+		models.CreateIndex,
+		models.DropIndex,
+		models.CreateTable,
+		models.DropTable,
+		models.TruncateTable,
+		models.RenameTable,
+		models.ChangeColumn,
+	}
+
+	// addColumnTypes contains column definitions used in ADD COLUMN, all of
+	// them must be supported by `genRandomValue`
+	addColumnTypes = []string{
+		"SMALLINT",
+		"INT",
+		"BIGINT",
+		"DOUBLE",
+		"DECIMAL(20,5)",
+		"DATETIME",
+		"CHAR(16)",
+		"VARCHAR(64)",
+		"TEXT",
+		"BLOB",
+	}
+)
+
+func isSupportedDDLType(tp models.DDLType) bool {
+	for _, supported := range supportedDDLTypes {
+		if tp == supported {
+			return true
+		}
+	}
+	return false
+}
+
+// GenerateDDL implements `GenerateDDL` of models.DB
+func (sd *ImpSQLiteDB) GenerateDDL(_ context.Context) (*models.DDLParams, error) {
+	table, err := sd.RandomTable()
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	var params *models.DDLParams
+	switch sd.ddlTypes[sd.rnd.Intn(len(sd.ddlTypes))] {
+	case models.AddColumn:
+		params, err = sd.genAddColumnDDL(table)
+	case models.CreateIndex:
+		params, err = sd.genCreateIndexDDL(table)
+	case models.DropIndex:
+		params, err = sd.genDropIndexDDL(table)
+	case models.CreateTable:
+		params, err = sd.genCreateTableDDL(table.Schema)
+	case models.DropTable:
+		params, err = sd.genDropTableDDL(table)
+	case models.TruncateTable:
+		params, err = sd.genTruncateTableDDL(table)
+	case models.RenameTable:
+		params, err = sd.genRenameTableDDL(table)
+	case models.ChangeColumn:
+		params, err = sd.genChangeColumnDDL(table)
+	}
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	// falls back to ADD COLUMN if the chosen DDL can't be applied to the table
+	if params == nil {
+		params, err = sd.genAddColumnDDL(table)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+	}
+	return params, nil
+}
+
+// ExecDDL implements `ExecDDL` of models.DB
+func (sd *ImpSQLiteDB) ExecDDL(_ context.Context, ddl *models.DDLParams) error {
+	_, err := sd.db.Exec(ddl.SQL)
+
+	if sd.verbose {
+		fmt.Println(ddl.SQL)
+	}
+
+	return errors.Trace(err)
+}
+
+func (sd *ImpSQLiteDB) genAddColumnDDL(table *models.Table) (*models.DDLParams, error) {
+	name := dbutil.GenColumnName(sd.rnd, table)
+	tp := addColumnTypes[sd.rnd.Intn(len(addColumnTypes))]
+	params := &models.DDLParams{
+		Type:   models.AddColumn,
+		Schema: table.Schema,
+		Table:  table.Name,
+		SQL:    fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s NULL;", TableName(table.Schema, table.Name), quoteName(name), tp),
+	}
+	return params, nil
+}
+
+// genChangeColumnDDL renames a column, returns nil if no column can be renamed
+func (sd *ImpSQLiteDB) genChangeColumnDDL(table *models.Table) (*models.DDLParams, error) {
+	candidates := make([]*models.Column, 0, len(table.Columns))
+	for _, column := range table.Columns {
+		// key columns are required by DML generation
+		if !table.IsKeyColumn(column) {
+			candidates = append(candidates, column)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil, nil
+	}
+	column := candidates[sd.rnd.Intn(len(candidates))]
+	params := &models.DDLParams{
+		Type:   models.ChangeColumn,
+		Schema: table.Schema,
+		Table:  table.Name,
+		SQL: fmt.Sprintf("ALTER TABLE %s RENAME COLUMN %s TO %s;",
+			TableName(table.Schema, table.Name), quoteName(column.Name), quoteName(dbutil.GenColumnName(sd.rnd, table))),
+	}
+	return params, nil
+}
+
+// genCreateIndexDDL creates a secondary or unique index on one or two columns,
+// returns nil if no column can be indexed
+func (sd *ImpSQLiteDB) genCreateIndexDDL(table *models.Table) (*models.DDLParams, error) {
+	unique := sd.rnd.Intn(2) == 0
+	candidates := make([]*models.Column, 0, len(table.Columns))
+	for _, column := range table.Columns {
+		if column.Key == "PRI" {
+			continue
+		}
+		if unique && dbutil.IsLowCardinalityColumn(column) {
+			continue
+		}
+		candidates = append(candidates, column)
+	}
+	if len(candidates) == 0 {
+		return nil, nil
+	}
+
+	n := 1
+	if len(candidates) > 1 && sd.rnd.Intn(2) == 0 {
+		n = 2
+	}
+	columns := make([]*models.Column, 0, n)
+	for _, idx := range sd.rnd.Perm(len(candidates))[:n] {
+		columns = append(columns, candidates[idx])
+	}
+
+	// a unique index makes its columns not updatable, keep at least one updatable column
+	if unique {
+		remain := 0
+		for _, column := range table.UpdatableColumns() {
+			if dbutil.FindColumn(columns, column.Name) == nil {
+				remain++
+			}
+		}
+		if remain == 0 {
+			unique = false
+		}
+	}
+
+	var (
+		name   string
+		prefix = "idx_"
+		stmt   = "CREATE INDEX"
+	)
+	if unique {
+		prefix = "uk_"
+		stmt = "CREATE UNIQUE INDEX"
+	}
+	for {
+		name = prefix + strings.ToLower(utils.RandomString(sd.rnd, 8))
+		if !dbutil.HasIndex(table, name) {
+			break
+		}
+	}
+	names := make([]string, 0, len(columns))
+	for _, column := range columns {
+		names = append(names, quoteName(column.Name))
+	}
+
+	// the schema of index is specified in the index name, table name must be unqualified
+	params := &models.DDLParams{
+		Type:   models.CreateIndex,
+		Schema: table.Schema,
+		Table:  table.Name,
+		SQL:    fmt.Sprintf("%s %s ON %s (%s);", stmt, TableName(table.Schema, name), quoteName(table.Name), strings.Join(names, ", ")),
+	}
+	return params, nil
+}
+
+// genDropIndexDDL returns nil if there is no index created by CREATE INDEX
+func (sd *ImpSQLiteDB) genDropIndexDDL(table *models.Table) (*models.DDLParams, error) {
+	names := make([]string, 0, len(table.IndexColumns)+len(table.NonUniqueIndexColumns))
+	for name := range table.IndexColumns {
+		// indexes created by PRIMARY KEY and UNIQUE constraints can't be dropped
+		if name != "primary" && !strings.HasPrefix(name, "sqlite_autoindex_") {
+			names = append(names, name)
+		}
+	}
+	for name := range table.NonUniqueIndexColumns {
+		names = append(names, name)
+	}
+	if len(names) == 0 {
+		return nil, nil
+	}
+	// sort to make the choice independent of map iteration order
+	sort.Strings(names)
+	name := names[sd.rnd.Intn(len(names))]
+	params := &models.DDLParams{
+		Type:   models.DropIndex,
+		Schema: table.Schema,
+		Table:  table.Name,
+		SQL:    fmt.Sprintf("DROP INDEX %s;", TableName(table.Schema, name)),
+	}
+	return params, nil
+}
+
+// genCreateTableDDL creates a table with `id` as primary key and some random columns
+func (sd *ImpSQLiteDB) genCreateTableDDL(schema string) (*models.DDLParams, error) {
+	name := sd.genTableName(schema)
+	n := sd.rnd.Intn(5) + 2
+	columns := make([]string, 0, n+1)
+	columns = append(columns, `"id" INTEGER NOT NULL PRIMARY KEY`)
+	for i := 0; i < n; i++ {
+		tp := addColumnTypes[sd.rnd.Intn(len(addColumnTypes))]
+		columns = append(columns, fmt.Sprintf(`"c%d" %s NULL`, i, tp))
+	}
+	params := &models.DDLParams{
+		Type:   models.CreateTable,
+		Schema: schema,
+		Table:  name,
+		SQL:    fmt.Sprintf("CREATE TABLE %s (%s);", TableName(schema, name), strings.Join(columns, ", ")),
+	}
+	return params, nil
+}
+
+// genDropTableDDL returns nil if the table is the last cached table
+func (sd *ImpSQLiteDB) genDropTableDDL(table *models.Table) (*models.DDLParams, error) {
+	if sd.TableCount() < 2 {
+		return nil, nil
+	}
+	params := &models.DDLParams{
+		Type:   models.DropTable,
+		Schema: table.Schema,
+		Table:  table.Name,
+		SQL:    fmt.Sprintf("DROP TABLE %s;", TableName(table.Schema, table.Name)),
+	}
+	return params, nil
+}
+
+// genTruncateTableDDL uses DELETE without WHERE, which is optimized to truncate in SQLite
+func (sd *ImpSQLiteDB) genTruncateTableDDL(table *models.Table) (*models.DDLParams, error) {
+	params := &models.DDLParams{
+		Type:   models.TruncateTable,
+		Schema: table.Schema,
+		Table:  table.Name,
+		SQL:    fmt.Sprintf("DELETE FROM %s;", TableName(table.Schema, table.Name)),
+	}
+	return params, nil
+}
+
+func (sd *ImpSQLiteDB) genRenameTableDDL(table *models.Table) (*models.DDLParams, error) {
+	name := sd.genTableName(table.Schema)
+	params := &models.DDLParams{
+		Type:     models.RenameTable,
+		Schema:   table.Schema,
+		Table:    table.Name,
+		NewTable: name,
+		SQL:      fmt.Sprintf("ALTER TABLE %s RENAME TO %s;", TableName(table.Schema, table.Name), quoteName(name)),
+	}
+	return params, nil
+}
+
+// genTableName generates a table name which is not in table cache
+func (sd *ImpSQLiteDB) genTableName(schema string) string {
+	for {
+		name := "t_" + strings.ToLower(utils.RandomString(sd.rnd, 8))
+		if _, ok := sd.CachedTable(schema, name); !ok {
+			return name
+		}
+	}
+}
@@ -0,0 +1,439 @@
+package sqlite
+
+import (
+	"database/sql"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pingcap/errors"
+
+	"github.com/amyangfei/data-dam/db/dbutil"
+	"github.com/amyangfei/data-dam/pkg/models"
+	"github.com/amyangfei/data-dam/pkg/utils"
+)
+
+const (
+	queryMaxRetry = 3
+)
+
+// TableName returns table name with schema, schema is `main` or the name of an attached database
+func TableName(schema, name string) string {
+	return fmt.Sprintf("%s.%s", quoteName(schema), quoteName(name))
+}
+
+// quoteName quotes an identifier with double quotes
+func quoteName(name string) string {
+	return `"` + strings.Replace(name, `"`, `""`, -1) + `"`
+}
+
+// dialect implements dbutil.Dialect for SQLite
+type dialect struct{}
+
+func (dialect) QuoteName(name string) string {
+	return quoteName(name)
+}
+
+func (dialect) TableName(schema, name string) string {
+	return TableName(schema, name)
+}
+
+func (dialect) Placeholder(n int) string {
+	return "?"
+}
+
+func (dialect) IsIntegerColumn(column *models.Column) bool {
+	return isIntegerColumn(column)
+}
+
+func (dialect) IsBinaryColumn(column *models.Column) bool {
+	return isBinaryColumn(column)
+}
+
+func querySQL(db *sql.DB, query string, maxRetry int, args ...interface{}) (*sql.Rows, error) {
+	// TODO: add retry mechanism
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	return rows, nil
+}
+
+func getTableFromDB(db *sql.DB, schema string, name string) (*models.Table, error) {
+	table := &models.Table{}
+	table.Schema = schema
+	table.Name = name
+	table.IndexColumns = make(map[string][]*models.Column)
+	table.NonUniqueIndexColumns = make(map[string][]*models.Column)
+
+	err := refreshSchema(db, schema)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	err = getTableColumns(db, table, queryMaxRetry)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	err = getTableIndex(db, table, queryMaxRetry)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	if len(table.Columns) == 0 {
+		return nil, errors.Errorf("invalid table %s.%s", schema, name)
+	}
+
+	return table, nil
+}
+
+// refreshSchema makes the connection reload schema if it is changed by other
+// connections, PRAGMA statements don't check the schema version by themselves.
+func refreshSchema(db *sql.DB, schema string) error {
+	var count int
+	query := fmt.Sprintf("SELECT COUNT(*) FROM %s.sqlite_master", quoteName(schema))
+	return errors.Trace(db.QueryRow(query).Scan(&count))
+}
+
+func getTableColumns(db *sql.DB, table *models.Table, maxRetry int) error {
+	if table.Schema == "" || table.Name == "" {
+		return errors.New("schema/table is empty")
+	}
+
+	query := fmt.Sprintf("PRAGMA %s.table_info(%s)", quoteName(table.Schema), quoteName(table.Name))
+	rows, err := querySQL(db, query, maxRetry)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer rows.Close()
+
+	// Show an example.
+	/*
+	   sqlite> PRAGMA main.table_info(t);
+	   cid|name|type       |notnull|dflt_value|pk
+	   0  |id  |INTEGER    |0      |          |1
+	   1  |name|VARCHAR(32)|1      |          |0
+	   2  |c   |DECIMAL(10,2)|0    |          |0
+	*/
+
+	var (
+		idx        = 0
+		pkColumns  = make(map[int]string)
+		integerPKs = 0
+	)
+	for rows.Next() {
+		var (
+			cid, notNull, pk int
+			name, tp         string
+			defaultValue     sql.NullString
+		)
+		err = rows.Scan(&cid, &name, &tp, &notNull, &defaultValue, &pk)
+		if err != nil {
+			return errors.Trace(err)
+		}
+
+		column := &models.Column{}
+		column.Idx = idx
+		column.Name = name
+		column.Tp = strings.TrimSpace(tp)
+		bracketIdx := strings.Index(column.Tp, "(")
+		if bracketIdx > 0 {
+			column.SubTp = strings.Replace(column.Tp[bracketIdx+1:strings.LastIndex(column.Tp, ")")], " ", "", -1)
+			column.Tp = strings.TrimSpace(column.Tp[:bracketIdx])
+		}
+		if strings.Contains(strings.ToUpper(column.Tp), "UNSIGNED") {
+			column.Unsigned = true
+		}
+		column.NotNull = notNull == 1
+		if pk > 0 {
+			column.Key = "PRI"
+			pkColumns[pk] = name
+			if strings.ToUpper(column.Tp) == "INTEGER" {
+				integerPKs++
+			}
+		}
+
+		table.Columns = append(table.Columns, column)
+		idx++
+	}
+
+	if rows.Err() != nil {
+		return errors.Trace(rows.Err())
+	}
+
+	if len(pkColumns) > 0 {
+		pks := make([]int, 0, len(pkColumns))
+		for pk := range pkColumns {
+			pks = append(pks, pk)
+		}
+		sort.Ints(pks)
+		cols := make([]*models.Column, 0, len(pks))
+		for _, pk := range pks {
+			cols = append(cols, dbutil.FindColumn(table.Columns, pkColumns[pk]))
+		}
+		table.IndexColumns["primary"] = cols
+		// `INTEGER PRIMARY KEY` is an alias of rowid, which is assigned automatically
+		if len(cols) == 1 && integerPKs == 1 {
+			cols[0].Extra = "auto_increment"
+		}
+	}
+
+	return nil
+}
+
+func getTableIndex(db *sql.DB, table *models.Table, maxRetry int) error {
+	if table.Schema == "" || table.Name == "" {
+		return errors.New("schema/table is empty")
+	}
+
+	query := fmt.Sprintf("PRAGMA %s.index_list(%s)", quoteName(table.Schema), quoteName(table.Name))
+	rows, err := querySQL(db, query, maxRetry)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer rows.Close()
+
+	rowColumns, err := rows.Columns()
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	// Show an example, primary key is collected from table_info.
+	/*
+	   sqlite> PRAGMA main.index_list(t);
+	   seq|name                 |unique|origin|partial
+	   0  |idx_c                |0     |c     |0
+	   1  |sqlite_autoindex_t_1 |1     |u     |0
+	*/
+	type index struct {
+		name   string
+		unique bool
+	}
+	indexes := make([]index, 0)
+	for rows.Next() {
+		data := make([]sql.RawBytes, len(rowColumns))
+		values := make([]interface{}, len(rowColumns))
+		for i := range values {
+			values[i] = &data[i]
+		}
+		err = rows.Scan(values...)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		if len(data) > 3 && string(data[3]) == "pk" {
+			continue
+		}
+		indexes = append(indexes, index{name: string(data[1]), unique: string(data[2]) == "1"})
+	}
+	if rows.Err() != nil {
+		return errors.Trace(rows.Err())
+	}
+	rows.Close()
+
+	var (
+		columns          = make(map[string][]string)
+		nonUniqueColumns = make(map[string][]string)
+	)
+	for _, idx := range indexes {
+		names, err := getIndexColumns(db, table.Schema, idx.name, maxRetry)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		if idx.unique {
+			columns[idx.name] = names
+		} else {
+			nonUniqueColumns[idx.name] = names
+		}
+	}
+
+	for keyName, cols := range dbutil.FindColumns(table.Columns, columns) {
+		table.IndexColumns[keyName] = cols
+		if len(cols) == 1 && cols[0].Key == "" {
+			cols[0].Key = "UNI"
+		} else if len(cols) > 0 && cols[0].Key == "" {
+			cols[0].Key = "MUL"
+		}
+	}
+	table.NonUniqueIndexColumns = dbutil.FindColumns(table.Columns, nonUniqueColumns)
+	for _, cols := range table.NonUniqueIndexColumns {
+		if len(cols) > 0 && cols[0].Key == "" {
+			cols[0].Key = "MUL"
+		}
+	}
+	return nil
+}
+
+func getIndexColumns(db *sql.DB, schema, index string, maxRetry int) ([]string, error) {
+	query := fmt.Sprintf("PRAGMA %s.index_info(%s)", quoteName(schema), quoteName(index))
+	rows, err := querySQL(db, query, maxRetry)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	defer rows.Close()
+
+	names := make([]string, 0)
+	for rows.Next() {
+		var (
+			seqNo, cid int
+			name       sql.NullString
+		)
+		err = rows.Scan(&seqNo, &cid, &name)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		// name is NULL for expressions in index
+		if name.Valid {
+			names = append(names, name.String)
+		}
+	}
+	if rows.Err() != nil {
+		return nil, errors.Trace(rows.Err())
+	}
+	return names, nil
+}
+
+func findTables(db *sql.DB, schema string) ([]string, error) {
+	err := refreshSchema(db, schema)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	query := fmt.Sprintf("SELECT name FROM %s.sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%%'", quoteName(schema))
+	rows, err := querySQL(db, query, queryMaxRetry)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	defer rows.Close()
+
+	tables := make([]string, 0)
+	for rows.Next() {
+		var table string
+		err = rows.Scan(&table)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		tables = append(tables, table)
+	}
+
+	if rows.Err() != nil {
+		return nil, errors.Trace(rows.Err())
+	}
+
+	return tables, nil
+}
+
+// isIntegerColumn checks whether column has INTEGER type affinity
+func isIntegerColumn(column *models.Column) bool {
+	return strings.Contains(strings.ToUpper(column.Tp), "INT")
+}
+
+// isBinaryColumn checks whether column has BLOB type affinity
+func isBinaryColumn(column *models.Column) bool {
+	upper := strings.ToUpper(column.Tp)
+	return upper == "" || strings.Contains(upper, "BLOB")
+}
+
+func getMaxID(db *sql.DB, schema, table, column string) (int64, error) {
+	stmt := fmt.Sprintf("SELECT IFNULL(MAX(%s), 0) FROM %s", quoteName(column), TableName(schema, table))
+	var id int64
+	err := db.QueryRow(stmt).Scan(&id)
+	return id, errors.Trace(err)
+}
+
+// getColumnValue returns the value of column in the row identified by keys, false if there is no such row
+func getColumnValue(db *sql.DB, table *models.Table, column *models.Column, keys map[string]interface{}) (interface{}, bool, error) {
+	args := make([]interface{}, 0, len(keys))
+	stmt := fmt.Sprintf("SELECT %s FROM %s WHERE %s LIMIT 1",
+		quoteName(column.Name), TableName(table.Schema, table.Name), genWhere(keys, &args))
+	var value interface{}
+	err := db.QueryRow(stmt, args...).Scan(&value)
+	if err == sql.ErrNoRows {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, errors.Trace(err)
+	}
+	return dbutil.KeyValue(dialect{}, column, value), true, nil
+}
+
+// genRandomValue generates a random value for the column based on the type
+// affinity of its declared type, see https://www.sqlite.org/datatype3.html
+func genRandomValue(rnd *rand.Rand, column *models.Column) (interface{}, error) {
+	upper := strings.ToUpper(column.Tp)
+	var value interface{}
+	switch {
+	case upper == "BOOLEAN" || upper == "BOOL":
+		value = rnd.Intn(2)
+	case upper == "TINYINT":
+		value = rnd.Intn(1 << 7)
+	case upper == "SMALLINT":
+		value = rnd.Intn(1 << 15)
+	case strings.Contains(upper, "BIGINT"):
+		value = rnd.Int63()
+	case strings.Contains(upper, "INT"):
+		value = rnd.Int31()
+	case strings.Contains(upper, "CHAR"), strings.Contains(upper, "CLOB"), strings.Contains(upper, "TEXT"):
+		n := 20
+		if column.SubTp != "" {
+			var err error
+			n, err = strconv.Atoi(column.SubTp)
+			if err != nil {
+				return nil, errors.Trace(err)
+			}
+		}
+		value = utils.RandomString(rnd, rnd.Intn(n)+1)
+	case upper == "" || strings.Contains(upper, "BLOB"):
+		b := make([]byte, 20)
+		rnd.Read(b)
+		value = b
+	case strings.Contains(upper, "REAL"), strings.Contains(upper, "FLOA"), strings.Contains(upper, "DOUB"):
+		value = rnd.ExpFloat64()
+	case upper == "DATE":
+		t := utils.RandomTime(rnd)
+		value = fmt.Sprintf("%.4d-%.2d-%.2d", t.Year(), t.Month(), t.Day())
+	case upper == "DATETIME" || upper == "TIMESTAMP":
+		t := utils.RandomTime(rnd)
+		value = fmt.Sprintf("%.4d-%.2d-%.2d %.2d:%.2d:%.2d", t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second())
+	case strings.Contains(upper, "NUM"), strings.Contains(upper, "DEC"):
+		// NUMERIC affinity of exact numbers, such as DECIMAL(10,5)
+		value = strconv.FormatFloat(rnd.ExpFloat64(), 'f', 5, 64)
+	default:
+		return nil, errors.NotSupportedf("column %s of type %s", column.Name, column.Tp)
+	}
+	return value, nil
+}
+
+// formatValue formats a value as SQL literal, booleans are integers in SQLite
+func formatValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "NULL"
+	case bool:
+		if v {
+			return "1"
+		}
+		return "0"
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return fmt.Sprintf("%d", v)
+	case float32:
+		return strconv.FormatFloat(float64(v), 'g', -1, 32)
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	case []byte:
+		return fmt.Sprintf("X'%X'", v)
+	case time.Time:
+		return "'" + v.Format("2006-01-02 15:04:05.999999") + "'"
+	case string:
+		return quoteString(v)
+	default:
+		return quoteString(fmt.Sprintf("%v", v))
+	}
+}
+
+// quoteString quotes a string literal, single quotes are doubled
+func quoteString(s string) string {
+	return "'" + strings.Replace(s, "'", "''", -1) + "'"
+}
@@ -0,0 +1,187 @@
+package models
+
+import (
+	"math"
+	"math/rand"
+
+	"github.com/pingcap/errors"
+)
+
+// distributions of keys chosen by update and delete
+const (
+	KeyUniform = "uniform"
+	KeyZipfian = "zipfian"
+	KeyHotspot = "hotspot"
+	KeyLatest  = "latest"
+
+	defaultZipfianConstant   = 0.99
+	defaultHotspotFraction   = 0.2
+	defaultHotspotOpFraction = 0.8
+)
+
+// KeyDistributionConfig is the config of choosing keys of update and delete, like YCSB
+//
+//	uniform: every key has the same chance
+//	zipfian: earlier inserted keys are more popular, with skew of `zipfian-constant`
+//	hotspot: `hotspot-op-fraction` of operations access the earliest `hotspot-fraction` of keys
+//	latest:  zipfian distribution where the latest inserted keys are the most popular
+type KeyDistributionConfig struct {
+	Type              string  `toml:"type" json:"type"`
+	ZipfianConstant   float64 `toml:"zipfian-constant" json:"zipfian-constant"`
+	HotspotFraction   float64 `toml:"hotspot-fraction" json:"hotspot-fraction"`
+	HotspotOpFraction float64 `toml:"hotspot-op-fraction" json:"hotspot-op-fraction"`
+}
+
+func (c *KeyDistributionConfig) fillDefault() {
+	if c.Type == "" {
+		c.Type = KeyUniform
+	}
+	if c.ZipfianConstant == 0 {
+		c.ZipfianConstant = defaultZipfianConstant
+	}
+	if c.HotspotFraction == 0 {
+		c.HotspotFraction = defaultHotspotFraction
+	}
+	if c.HotspotOpFraction == 0 {
+		c.HotspotOpFraction = defaultHotspotOpFraction
+	}
+}
+
+func (c *KeyDistributionConfig) adjust() error {
+	c.fillDefault()
+	switch c.Type {
+	case KeyUniform, KeyZipfian, KeyHotspot, KeyLatest:
+	default:
+		return errors.NotValidf("key distribution %s", c.Type)
+	}
+	if c.ZipfianConstant <= 0 || c.ZipfianConstant >= 1 {
+		return errors.NotValidf("zipfian-constant %f, which should be in (0, 1)", c.ZipfianConstant)
+	}
+	if c.HotspotFraction < 0 || c.HotspotFraction > 1 {
+		return errors.NotValidf("hotspot-fraction %f", c.HotspotFraction)
+	}
+	if c.HotspotOpFraction < 0 || c.HotspotOpFraction > 1 {
+		return errors.NotValidf("hotspot-op-fraction %f", c.HotspotOpFraction)
+	}
+	return nil
+}
+
+// KeyChooser chooses a key among n keys ordered by insertion time, the returned
+// index is in [0, n), and n-1 is the latest inserted key.
+type KeyChooser interface {
+	Choose(n int64) int64
+}
+
+// NewKeyChooser creates a KeyChooser of the distribution with random source rnd.
+// Choosers of zipfian and latest keep states of n, so every table should use its own chooser.
+func NewKeyChooser(cfg KeyDistributionConfig, rnd *rand.Rand) KeyChooser {
+	cfg.fillDefault()
+	switch cfg.Type {
+	case KeyZipfian:
+		return newZipfianChooser(rnd, cfg.ZipfianConstant)
+	case KeyHotspot:
+		return &hotspotChooser{rnd: rnd, fraction: cfg.HotspotFraction, opFraction: cfg.HotspotOpFraction}
+	case KeyLatest:
+		return &latestChooser{zipfian: newZipfianChooser(rnd, cfg.ZipfianConstant)}
+	default:
+		return &uniformChooser{rnd: rnd}
+	}
+}
+
+type uniformChooser struct {
+	rnd *rand.Rand
+}
+
+func (c *uniformChooser) Choose(n int64) int64 {
+	if n <= 1 {
+		return 0
+	}
+	return c.rnd.Int63n(n)
+}
+
+type hotspotChooser struct {
+	rnd        *rand.Rand
+	fraction   float64
+	opFraction float64
+}
+
+func (c *hotspotChooser) Choose(n int64) int64 {
+	if n <= 1 {
+		return 0
+	}
+	hot := int64(float64(n) * c.fraction)
+	if hot < 1 {
+		hot = 1
+	}
+	if hot >= n || c.rnd.Float64() < c.opFraction {
+		return c.rnd.Int63n(hot)
+	}
+	return hot + c.rnd.Int63n(n-hot)
+}
+
+// zipfianChooser generates zipfian distribution by the algorithm of
+// "Quickly Generating Billion-Record Synthetic Databases", Jim Gray et al, SIGMOD 1994,
+// which is also used by YCSB. zeta(n) is updated incrementally when n changes.
+type zipfianChooser struct {
+	rnd   *rand.Rand
+	theta float64
+	alpha float64
+	zeta2 float64
+
+	n     int64   // number of keys zetan is computed for
+	zetan float64 // zeta(n) = sum(1 / i^theta) for i in [1, n]
+	eta   float64
+}
+
+func newZipfianChooser(rnd *rand.Rand, theta float64) *zipfianChooser {
+	c := &zipfianChooser{
+		rnd:   rnd,
+		theta: theta,
+		alpha: 1 / (1 - theta),
+	}
+	c.zeta2 = 1 + math.Pow(0.5, theta)
+	return c
+}
+
+func (c *zipfianChooser) resize(n int64) {
+	for ; c.n < n; c.n++ {
+		c.zetan += 1 / math.Pow(float64(c.n+1), c.theta)
+	}
+	for ; c.n > n; c.n-- {
+		c.zetan -= 1 / math.Pow(float64(c.n), c.theta)
+	}
+	c.eta = (1 - math.Pow(2/float64(n), 1-c.theta)) / (1 - c.zeta2/c.zetan)
+}
+
+func (c *zipfianChooser) Choose(n int64) int64 {
+	if n <= 1 {
+		return 0
+	}
+	if n != c.n {
+		c.resize(n)
+	}
+	u := c.rnd.Float64()
+	uz := u * c.zetan
+	if uz < 1 {
+		return 0
+	}
+	if uz < c.zeta2 {
+		return 1
+	}
+	idx := int64(float64(n) * math.Pow(c.eta*u-c.eta+1, c.alpha))
+	if idx >= n {
+		idx = n - 1
+	}
+	return idx
+}
+
+type latestChooser struct {
+	zipfian *zipfianChooser
+}
+
+func (c *latestChooser) Choose(n int64) int64 {
+	if n <= 1 {
+		return 0
+	}
+	return n - 1 - c.zipfian.Choose(n)
+}
@@ -0,0 +1,86 @@
+package models
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func chooseCounts(t *testing.T, chooser KeyChooser, n int64, times int) []int {
+	counts := make([]int, n)
+	for i := 0; i < times; i++ {
+		idx := chooser.Choose(n)
+		require.True(t, idx >= 0 && idx < n, "index %d of %d keys", idx, n)
+		counts[idx]++
+	}
+	return counts
+}
+
+func TestKeyChooser(t *testing.T) {
+	const (
+		n     = 100
+		times = 100000
+	)
+	newChooser := func(tp string) KeyChooser {
+		cfg := KeyDistributionConfig{Type: tp}
+		require.NoError(t, cfg.adjust())
+		return NewKeyChooser(cfg, rand.New(rand.NewSource(1)))
+	}
+
+	for _, tp := range []string{KeyUniform, KeyZipfian, KeyHotspot, KeyLatest} {
+		chooser := newChooser(tp)
+		assert.Equal(t, int64(0), chooser.Choose(0), tp)
+		assert.Equal(t, int64(0), chooser.Choose(1), tp)
+	}
+
+	counts := chooseCounts(t, newChooser(KeyUniform), n, times)
+	for _, c := range counts {
+		assert.InDelta(t, times/n, c, times/n*0.3)
+	}
+
+	counts = chooseCounts(t, newChooser(KeyZipfian), n, times)
+	assert.True(t, counts[0] > counts[1] && counts[1] > counts[10] && counts[10] > counts[n-1])
+
+	counts = chooseCounts(t, newChooser(KeyLatest), n, times)
+	assert.True(t, counts[n-1] > counts[n-2] && counts[n-2] > counts[n-11] && counts[n-11] > counts[0])
+
+	counts = chooseCounts(t, newChooser(KeyHotspot), n, times)
+	hot := 0
+	for _, c := range counts[:n/5] {
+		hot += c
+	}
+	assert.InDelta(t, 0.8, float64(hot)/times, 0.02)
+}
+
+func TestZipfianResize(t *testing.T) {
+	c := newZipfianChooser(rand.New(rand.NewSource(1)), defaultZipfianConstant)
+	zeta := func(n int) float64 {
+		sum := 0.0
+		for i := 1; i <= n; i++ {
+			sum += 1 / math.Pow(float64(i), defaultZipfianConstant)
+		}
+		return sum
+	}
+	for _, n := range []int64{10, 1000, 500, 501, 2} {
+		c.Choose(n)
+		assert.InDelta(t, zeta(int(n)), c.zetan, 1e-9)
+	}
+}
+
+func TestKeyDistributionConfig(t *testing.T) {
+	cfg := KeyDistributionConfig{}
+	require.NoError(t, cfg.adjust())
+	assert.Equal(t, KeyUniform, cfg.Type)
+
+	for _, cfg := range []KeyDistributionConfig{
+		{Type: "gaussian"},
+		{Type: KeyZipfian, ZipfianConstant: 1},
+		{Type: KeyHotspot, HotspotFraction: 1.5},
+		{Type: KeyHotspot, HotspotOpFraction: -0.5},
+	} {
+		assert.Error(t, cfg.adjust())
+	}
+}
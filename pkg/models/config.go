@@ -1,10 +1,33 @@
 package models
 
+import (
+	"strings"
+	"time"
+
+	"github.com/pingcap/errors"
+)
+
+const (
+	defaultDBType         = "mysql"
+	defaultUpsertHitRatio = 0.5
+	defaultMaxRows        = 100
+)
+
 // DBConfig is the full database set configuration
 type DBConfig struct {
-	Verbose    bool        `toml:"verbose" json:"verbose"`         // verbose logging
-	SortFields bool        `toml:"sort-fields" json:"sort-fields"` // whether to sort k-v fields in SQL
-	MySQL      MySQLConfig `toml:"mysql" json:"mysql"`             // mysql config
+	Type            string                `toml:"db-type" json:"db-type"`                   // registered name of DBCreator
+	Seed            int64                 `toml:"seed" json:"seed"`                         // seed of random source, 0 means a time based seed
+	Verbose         bool                  `toml:"verbose" json:"verbose"`                   // verbose logging
+	SortFields      bool                  `toml:"sort-fields" json:"sort-fields"`           // whether to sort k-v fields in SQL
+	DDLTypes        []string              `toml:"ddl-types" json:"ddl-types"`               // DDL types to generate, empty means column and index changes
+	KeyDistribution KeyDistributionConfig `toml:"key-distribution" json:"key-distribution"` // distribution of keys chosen by update and delete
+	AutoIncrement   bool                  `toml:"auto-increment" json:"auto-increment"`     // omit auto increment columns in inserts and track ids assigned by database
+	UpsertHitRatio  *float64              `toml:"upsert-hit-ratio" json:"upsert-hit-ratio"` // fraction of replaces, upserts and insert-ignores hitting live keys, not set means 0.5
+	MaxRows         int                   `toml:"max-rows" json:"max-rows"`                 // maximum rows changed by a range update or delete, 0 means 100
+	MySQL           MySQLConfig           `toml:"mysql" json:"mysql"`                       // mysql config
+	Postgres        PostgresConfig        `toml:"postgres" json:"postgres"`                 // postgres config
+	SQLite          SQLiteConfig          `toml:"sqlite" json:"sqlite"`                     // sqlite config
+	SQLFile         SQLFileConfig         `toml:"sql-file" json:"sql-file"`                 // write DML to sql files instead of executing
 }
 
 // MySQLConfig stores mysql config
@@ -13,5 +36,107 @@ type MySQLConfig struct {
 	Port     int    `toml:"port" json:"port"`
 	User     string `toml:"user" json:"user"`
 	Password string `toml:"password" json:"password"`
-	Enabled  bool   `toml:"enabled" json:"enabled"`
+	Enabled  bool   `toml:"enabled" json:"enabled"` // deprecated, used only when db-type is not set
+}
+
+// PostgresConfig stores postgres config
+type PostgresConfig struct {
+	Host     string `toml:"host" json:"host"`
+	Port     int    `toml:"port" json:"port"`
+	User     string `toml:"user" json:"user"`
+	Password string `toml:"password" json:"password"`
+	Database string `toml:"database" json:"database"`
+	SSLMode  string `toml:"sslmode" json:"sslmode"`
+	Enabled  bool   `toml:"enabled" json:"enabled"` // deprecated, used only when db-type is not set
+}
+
+// SQLiteConfig stores sqlite config
+type SQLiteConfig struct {
+	Path    string `toml:"path" json:"path"`       // path of the database file
+	Enabled bool   `toml:"enabled" json:"enabled"` // deprecated, used only when db-type is not set
+}
+
+// SQLFileConfig stores config of writing generated SQL to rotating files
+type SQLFileConfig struct {
+	Path       string `toml:"path" json:"path"`               // path of the sql file, empty means executing DML in database
+	MaxSize    int    `toml:"max-size" json:"max-size"`       // maximum size in megabytes before the file is rotated, 0 means 100
+	MaxBackups int    `toml:"max-backups" json:"max-backups"` // maximum number of rotated files to retain, 0 means retaining all
+	TxnSize    int    `toml:"txn-size" json:"txn-size"`       // number of statements grouped in a transaction per worker, 0 means no grouping
+	Timestamp  bool   `toml:"timestamp" json:"timestamp"`     // whether to write the generated time as comment
+}
+
+// TxnConfig stores config of grouping DMLs into transactions
+type TxnConfig struct {
+	Size          int     `toml:"size" json:"size"`                     // number of DMLs grouped in a transaction per worker, 0 means autocommit
+	RollbackRatio float64 `toml:"rollback-ratio" json:"rollback-ratio"` // fraction of transactions rolled back intentionally
+}
+
+// Adjust checks the transaction config
+func (c *TxnConfig) Adjust() error {
+	if c.Size < 0 {
+		return errors.NotValidf("txn size %d", c.Size)
+	}
+	if c.RollbackRatio < 0 || c.RollbackRatio > 1 {
+		return errors.NotValidf("txn rollback-ratio %v", c.RollbackRatio)
+	}
+	return nil
+}
+
+// sectionEnabled returns the `enabled` flag of each per-backend section, keyed by db-type
+func (c *DBConfig) sectionEnabled() map[string]bool {
+	return map[string]bool{
+		"mysql":    c.MySQL.Enabled,
+		"postgres": c.Postgres.Enabled,
+		"sqlite":   c.SQLite.Enabled,
+	}
+}
+
+// Adjust fills db-type from the enabled section if it is not set, and checks
+// a DBCreator has been registered for it.
+func (c *DBConfig) Adjust() error {
+	if c.Type == "" {
+		enabled := make([]string, 0, 1)
+		for tp, ok := range c.sectionEnabled() {
+			if ok {
+				enabled = append(enabled, tp)
+			}
+		}
+		switch len(enabled) {
+		case 0:
+			c.Type = defaultDBType
+		case 1:
+			c.Type = enabled[0]
+		default:
+			return errors.Errorf("more than one database section is enabled, please set db-type instead")
+		}
+	}
+	c.Type = strings.ToLower(c.Type)
+
+	if c.Seed == 0 {
+		c.Seed = time.Now().UnixNano()
+	}
+
+	if c.UpsertHitRatio == nil {
+		ratio := defaultUpsertHitRatio
+		c.UpsertHitRatio = &ratio
+	}
+	if *c.UpsertHitRatio < 0 || *c.UpsertHitRatio > 1 {
+		return errors.NotValidf("upsert-hit-ratio %v", *c.UpsertHitRatio)
+	}
+
+	if c.MaxRows == 0 {
+		c.MaxRows = defaultMaxRows
+	}
+	if c.MaxRows < 0 {
+		return errors.NotValidf("max-rows %d", c.MaxRows)
+	}
+
+	if err := c.KeyDistribution.adjust(); err != nil {
+		return errors.Trace(err)
+	}
+
+	if GetDBCreator(c.Type) == nil {
+		return errors.Errorf("db-type %s is not registered, available types: %s", c.Type, strings.Join(RegisteredDBTypes(), ", "))
+	}
+	return nil
 }
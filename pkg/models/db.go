@@ -3,6 +3,9 @@ package models
 import (
 	"context"
 	"fmt"
+	"sort"
+
+	"github.com/pingcap/errors"
 )
 
 // Column stores column information
@@ -23,16 +26,121 @@ type Table struct {
 	Name   string
 
 	Columns      []*Column
-	IndexColumns map[string][]*Column
+	IndexColumns map[string][]*Column // unique indexes (including primary key): index name -> columns
+
+	NonUniqueIndexColumns map[string][]*Column // non-unique indexes: index name -> columns
 }
 
 // DMLParams stores a DML information
 type DMLParams struct {
-	Type   OpType
-	Schema string
-	Table  string
-	Keys   map[string]interface{}
-	Values map[string]interface{}
+	Type   OpType                 `json:"type"`
+	Schema string                 `json:"schema"`
+	Table  string                 `json:"table"`
+	Keys   map[string]interface{} `json:"keys,omitempty"`
+	Values map[string]interface{} `json:"values,omitempty"`
+	Range  *RangeParams           `json:"range,omitempty"` // rows changed by RangeUpdate and RangeDelete
+	SQL    string                 `json:"sql,omitempty"`   // raw statement, Keys and Values are ignored if it is set
+
+	added   []Key // live keys added by Workload when the DML is generated
+	removed []Key // live keys removed by Workload when the DML is generated
+}
+
+// RangeParams is the condition of a DML changing multiple rows, which are rows whose Column
+// is between Begin and End, or equals Begin if End is nil. At most Limit rows are changed
+// if Limit is positive.
+type RangeParams struct {
+	Column string      `json:"column"`
+	Begin  interface{} `json:"begin"`
+	End    interface{} `json:"end,omitempty"`
+	Limit  int         `json:"limit,omitempty"`
+}
+
+// DDLType is the kind of a generated DDL statement
+type DDLType byte
+
+const (
+	// AddColumn adds a column to an existing table
+	AddColumn DDLType = iota
+
+	// DropColumn drops a column from an existing table
+	DropColumn
+
+	// CreateIndex creates a secondary or unique index
+	CreateIndex
+
+	// DropIndex drops a non-primary index
+	DropIndex
+
+	// CreateTable creates a new table
+	CreateTable
+
+	// DropTable drops an existing table
+	DropTable
+
+	// TruncateTable truncates an existing table
+	TruncateTable
+
+	// RenameTable renames an existing table
+	RenameTable
+
+	// ModifyColumn widens the type of a column
+	ModifyColumn
+
+	// ChangeColumn renames a column
+	ChangeColumn
+)
+
+var ddlTypeNames = map[DDLType]string{
+	AddColumn:     "add-column",
+	DropColumn:    "drop-column",
+	CreateIndex:   "create-index",
+	DropIndex:     "drop-index",
+	CreateTable:   "create-table",
+	DropTable:     "drop-table",
+	TruncateTable: "truncate-table",
+	RenameTable:   "rename-table",
+	ModifyColumn:  "modify-column",
+	ChangeColumn:  "change-column",
+}
+
+// String implements fmt.Stringer
+func (tp DDLType) String() string {
+	if name, ok := ddlTypeNames[tp]; ok {
+		return name
+	}
+	return fmt.Sprintf("unknown-ddl(%d)", tp)
+}
+
+// ParseDDLType parses DDLType from its name
+func ParseDDLType(name string) (DDLType, error) {
+	for tp, tpName := range ddlTypeNames {
+		if tpName == name {
+			return tp, nil
+		}
+	}
+	return 0, errors.NotValidf("DDL type %s", name)
+}
+
+// ParseDDLTypes parses a list of DDL type names
+func ParseDDLTypes(names []string) ([]DDLType, error) {
+	tps := make([]DDLType, 0, len(names))
+	for _, name := range names {
+		tp, err := ParseDDLType(name)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		tps = append(tps, tp)
+	}
+	return tps, nil
+}
+
+// DDLParams stores a DDL information
+type DDLParams struct {
+	Type     DDLType
+	Schema   string
+	Table    string
+	NewTable string // new table name of RenameTable
+	SQL      string
 }
 
 // DBCreator creates a database layer
@@ -57,13 +165,61 @@ type DB interface {
 	Update(ctx context.Context, schema, table string, keys map[string]interface{}, values map[string]interface{}) error
 
 	// Insert inserts a record in the database.
-	Insert(ctx context.Context, schema, table string, values map[string]interface{}) error
+	// returns the id assigned by the database to the auto increment column, 0 if it is unknown.
+	Insert(ctx context.Context, schema, table string, values map[string]interface{}) (int64, error)
 
 	// Delete deletes a record from the database.
 	Delete(ctx context.Context, schema, table string, keys map[string]interface{}) error
 
+	// Upsert executes a replace, upsert or insert-ignore of a full row, whose existing
+	// row is identified by keys.
+	Upsert(ctx context.Context, tp OpType, schema, table string, keys map[string]interface{}, values map[string]interface{}) error
+
+	// RangeUpdate updates records in the range with the same values.
+	RangeUpdate(ctx context.Context, schema, table string, rng *RangeParams, values map[string]interface{}) error
+
+	// RangeDelete deletes records in the range.
+	RangeDelete(ctx context.Context, schema, table string, rng *RangeParams) error
+
+	// BatchInsert inserts records with the same columns in one statement.
+	BatchInsert(ctx context.Context, schema, table string, rows []map[string]interface{}) error
+
+	// BatchDelete deletes records identified by keys with the same columns in one statement.
+	BatchDelete(ctx context.Context, schema, table string, keys []map[string]interface{}) error
+
+	// Begin starts a transaction, DMLs are executed in it until Commit or Rollback is called.
+	Begin(ctx context.Context) error
+
+	// Commit commits the transaction started by Begin.
+	Commit(ctx context.Context) error
+
+	// Rollback rolls back the transaction started by Begin.
+	Rollback(ctx context.Context) error
+
+	// Exec executes a raw DML statement in the database.
+	Exec(ctx context.Context, stmt string) error
+
+	// TrackInsertID adds the key of a row inserted without its auto increment column,
+	// whose id is assigned by the database, to live keys used by update and delete.
+	TrackInsertID(schema, table string, id int64)
+
+	// UntrackDML restores live keys changed by a generated DML, which is rolled back.
+	UntrackDML(dml *DMLParams)
+
+	// SetSchemas restricts generated DMLs and DDLs to cached tables in schemas, empty means all cached tables.
+	SetSchemas(schemas []string)
+
 	// GenerateDML generates a DML record.
 	GenerateDML(ctx context.Context, opType OpType) (*DMLParams, error)
+
+	// GenerateDDL generates a DDL record based on the table cache.
+	GenerateDDL(ctx context.Context) (*DDLParams, error)
+
+	// ExecDDL executes a DDL statement in the database.
+	ExecDDL(ctx context.Context, ddl *DDLParams) error
+
+	// RefreshTableCache reloads the cached table information affected by a DDL.
+	RefreshTableCache(ctx context.Context, ddl *DDLParams) error
 }
 
 var dbCreators = map[string]DBCreator{}
@@ -81,3 +237,13 @@ func RegisterDBCreator(name string, creator DBCreator) {
 func GetDBCreator(name string) DBCreator {
 	return dbCreators[name]
 }
+
+// RegisteredDBTypes returns the sorted names of all registered DBCreators
+func RegisteredDBTypes() []string {
+	names := make([]string, 0, len(dbCreators))
+	for name := range dbCreators {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
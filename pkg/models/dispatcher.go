@@ -2,7 +2,12 @@ package models
 
 import (
 	"context"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	_ "github.com/go-sql-driver/mysql" // import mysql driver
@@ -17,7 +22,7 @@ var (
 	flushInterval = 1 * time.Minute
 
 	// DefaultOpWeiht is default weight for SQL operations
-	DefaultOpWeiht = []int{5, 4, 1, 0}
+	DefaultOpWeiht = []int{5, 4, 1, 0, 0, 0, 0, 0, 0}
 )
 
 // OpType is database operation type
@@ -36,6 +41,21 @@ const (
 	// Ddl stmt
 	Ddl
 
+	// Replace stmt, `REPLACE INTO` of a full row
+	Replace
+
+	// Upsert stmt, `INSERT ... ON DUPLICATE KEY UPDATE` of a full row
+	Upsert
+
+	// InsertIgnore stmt, `INSERT IGNORE` of a full row
+	InsertIgnore
+
+	// RangeUpdate stmt, updates multiple rows in a range
+	RangeUpdate
+
+	// RangeDelete stmt, deletes multiple rows in a range
+	RangeDelete
+
 	// Flush is internal command
 	Flush
 )
@@ -46,6 +66,48 @@ var RealOpType = []OpType{
 	Update,
 	Delete,
 	Ddl,
+	Replace,
+	Upsert,
+	InsertIgnore,
+	RangeUpdate,
+	RangeDelete,
+}
+
+var opTypeNames = map[OpType]string{
+	Insert:       "insert",
+	Update:       "update",
+	Delete:       "delete",
+	Ddl:          "ddl",
+	Replace:      "replace",
+	Upsert:       "upsert",
+	InsertIgnore: "insert-ignore",
+	RangeUpdate:  "range-update",
+	RangeDelete:  "range-delete",
+	Flush:        "flush",
+}
+
+// String implements fmt.Stringer
+func (tp OpType) String() string {
+	if name, ok := opTypeNames[tp]; ok {
+		return name
+	}
+	return fmt.Sprintf("unknown-op(%d)", tp)
+}
+
+// MarshalText implements encoding.TextMarshaler
+func (tp OpType) MarshalText() ([]byte, error) {
+	return []byte(tp.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler
+func (tp *OpType) UnmarshalText(text []byte) error {
+	for t, name := range opTypeNames {
+		if name == string(text) {
+			*tp = t
+			return nil
+		}
+	}
+	return errors.NotValidf("OpType %s", text)
 }
 
 type sqlJob struct {
@@ -55,9 +117,19 @@ type sqlJob struct {
 	key    string
 	keys   map[string]interface{}
 	values map[string]interface{}
-	ddl    string
+	rng    *RangeParams
+	sql    string // raw DML statement
+	ddl    *DDLParams
+	dml    *DMLParams // the DML which the job is created from
+	err    error      // execution error of DDL job, excluding table cache refresh error
 }
 
+// InsertHook receives the id assigned by database to a row inserted without keys
+type InsertHook func(schema, table string, id int64)
+
+// RollbackHook receives a DML which is rolled back or dropped in a transaction
+type RollbackHook func(dml *DMLParams)
+
 // JobDispatcher manages and dispatches statements to databases
 type JobDispatcher struct {
 	sync.Mutex
@@ -68,23 +140,38 @@ type JobDispatcher struct {
 	DBs         []DB
 	BatchSize   int
 	WorkerCount int
+	Journal     *Journal  // records executed jobs if not nil
+	Stats       *Stats    // statistics of executed jobs
+	Txn         TxnConfig // DML workers group jobs into transactions if Txn.Size > 0
+	Coalesce    bool      // coalesces consecutive inserts and deletes of the same table into one statement
 
 	jobs         []chan *sqlJob
 	jobsChanLock sync.Mutex
 	jobsClosed   sync2.AtomicBool
 
 	jobWg sync.WaitGroup
+
+	insertHook   InsertHook   // protected by Mutex
+	rollbackHook RollbackHook // protected by Mutex
+	nextBucket   uint32       // round robin bucket of jobs without keys
+	rnds         []*rand.Rand // random source of rolling back transactions of each worker
 }
 
 // NewJobDispatcher returns a new JobDispatcher
 func NewJobDispatcher(ctx context.Context, workerCount, batchSize int, cfg *DBConfig, creator DBCreator) (*JobDispatcher, error) {
 	var err error
 	d := &JobDispatcher{
+		ctx:         ctx,
 		WorkerCount: workerCount,
 		BatchSize:   batchSize,
+		Stats:       NewStats(),
 	}
 	d.jobsClosed.Set(true)
 	d.createJobChans()
+	d.rnds = make([]*rand.Rand, 0, workerCount+1)
+	for i := 0; i < workerCount+1; i++ {
+		d.rnds = append(d.rnds, rand.New(rand.NewSource(cfg.Seed+int64(i))))
+	}
 	err = d.createDBs(creator, cfg)
 	if err != nil {
 		return nil, errors.Trace(err)
@@ -139,6 +226,49 @@ func (d *JobDispatcher) createDBs(creator DBCreator, cfg *DBConfig) error {
 	return nil
 }
 
+// Close closes all DBs, it should be called after Run returns
+func (d *JobDispatcher) Close() error {
+	return errors.Trace(d.closeDBs())
+}
+
+// PrepareTables prepares table cache of the schema for all DBs
+func (d *JobDispatcher) PrepareTables(ctx context.Context, schema string) error {
+	for _, inst := range d.DBs {
+		_, _, err := inst.PrepareTables(ctx, schema)
+		if err != nil {
+			return errors.Trace(err)
+		}
+	}
+	return nil
+}
+
+// SetInsertHook sets the hook called after a job inserting a row without keys is executed
+func (d *JobDispatcher) SetInsertHook(hook InsertHook) {
+	d.Lock()
+	defer d.Unlock()
+	d.insertHook = hook
+}
+
+func (d *JobDispatcher) getInsertHook() InsertHook {
+	d.Lock()
+	defer d.Unlock()
+	return d.insertHook
+}
+
+// SetRollbackHook sets the hook called after a transaction is rolled back, for every
+// job in it and every job dropped after a failed one
+func (d *JobDispatcher) SetRollbackHook(hook RollbackHook) {
+	d.Lock()
+	defer d.Unlock()
+	d.rollbackHook = hook
+}
+
+func (d *JobDispatcher) getRollbackHook() RollbackHook {
+	d.Lock()
+	defer d.Unlock()
+	return d.rollbackHook
+}
+
 // AddDML adds a DML job from DMLParams
 func (d *JobDispatcher) AddDML(dml *DMLParams) {
 	job := &sqlJob{
@@ -147,13 +277,63 @@ func (d *JobDispatcher) AddDML(dml *DMLParams) {
 		table:  dml.Table,
 		keys:   dml.Keys,
 		values: dml.Values,
+		rng:    dml.Range,
+		sql:    dml.SQL,
+		key:    rowKey(dml),
+		dml:    dml,
+	}
+	d.addJob(job)
+}
+
+// rowKey returns the identity of the row changed by dml, so that jobs of the
+// same row are executed in order by the same worker.
+func rowKey(dml *DMLParams) string {
+	if len(dml.Keys) == 0 {
+		return ""
+	}
+	names := make([]string, 0, len(dml.Keys))
+	for name := range dml.Keys {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s.%s", dml.Schema, dml.Table)
+	for _, name := range names {
+		fmt.Fprintf(&b, ",%s=%v", name, dml.Keys[name])
 	}
-	// TODO: keys causality tuning
-	for k := range dml.Keys {
-		job.key = k
-		break
+	return b.String()
+}
+
+// AddDDL adds a DDL job. It flushes all pending DML jobs first and blocks
+// until the DDL is executed and the table cache of every DB is refreshed.
+// returns the execution error of the DDL.
+func (d *JobDispatcher) AddDDL(ddl *DDLParams) error {
+	d.addJob(&sqlJob{tp: Flush})
+	job := &sqlJob{
+		tp:     Ddl,
+		schema: ddl.Schema,
+		table:  ddl.Table,
+		ddl:    ddl,
 	}
 	d.addJob(job)
+	if err := d.ctx.Err(); err != nil {
+		return errors.Trace(err)
+	}
+	return errors.Trace(job.err)
+}
+
+// Backlog returns the number of jobs waiting in job channels
+func (d *JobDispatcher) Backlog() int {
+	backlog := 0
+	for _, ch := range d.jobs {
+		backlog += len(ch)
+	}
+	return backlog
+}
+
+// Flush blocks until all added DML jobs are executed
+func (d *JobDispatcher) Flush() {
+	d.addJob(&sqlJob{tp: Flush})
 }
 
 func (d *JobDispatcher) addJob(job *sqlJob) {
@@ -161,21 +341,53 @@ func (d *JobDispatcher) addJob(job *sqlJob) {
 	case Flush:
 		d.jobWg.Add(d.WorkerCount)
 		for i := 0; i < d.WorkerCount; i++ {
-			d.jobs[i] <- job
+			d.sendJob(i, job)
 		}
-		d.jobWg.Wait()
+		d.waitJobs()
 	case Ddl:
-		d.jobWg.Wait()
+		d.waitJobs()
 		d.jobWg.Add(1)
-		d.jobs[d.WorkerCount] <- job
-	case Insert, Update, Delete:
+		d.sendJob(d.WorkerCount, job)
+	case RangeUpdate, RangeDelete:
+		// rows in a range may be changed by jobs in any worker, so the range job
+		// is executed after all added jobs and before any later job.
+		d.Flush()
+		d.jobWg.Add(1)
+		d.sendJob(0, job)
+		d.Flush()
+	case Insert, Update, Delete, Replace, Upsert, InsertIgnore:
 		d.jobWg.Add(1)
 		bucket := int(utils.GenHashKey(job.key)) % d.WorkerCount
-		d.jobs[bucket] <- job
+		// generated rows without keys have no order to keep, raw statements keep their order
+		if job.key == "" && job.sql == "" {
+			bucket = int(atomic.AddUint32(&d.nextBucket, 1) % uint32(d.WorkerCount))
+		}
+		d.sendJob(bucket, job)
 	}
 
 	if job.tp == Ddl {
+		d.waitJobs()
+	}
+}
+
+// sendJob sends job to the idx-th worker, gives up if the dispatcher is canceled
+func (d *JobDispatcher) sendJob(idx int, job *sqlJob) {
+	select {
+	case d.jobs[idx] <- job:
+	case <-d.ctx.Done():
+	}
+}
+
+// waitJobs waits for all sent jobs being processed, gives up if the dispatcher is canceled
+func (d *JobDispatcher) waitJobs() {
+	done := make(chan struct{})
+	go func() {
 		d.jobWg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-d.ctx.Done():
 	}
 }
 
@@ -185,26 +397,37 @@ func (d *JobDispatcher) Run(ctx context.Context) {
 		d.wg.Add(1)
 		go func(idx int) {
 			defer d.wg.Done()
-			d.dispatch(ctx, d.DBs[idx], d.jobs[idx])
+			d.dispatch(ctx, idx, d.DBs[idx], d.jobs[idx])
 		}(i)
 	}
 	d.wg.Wait()
 }
 
-func (d *JobDispatcher) processJobs(ctx context.Context, db DB, jobs []*sqlJob) error {
+func (d *JobDispatcher) processJobs(ctx context.Context, idx int, db DB, jobs []*sqlJob) error {
 	if len(jobs) == 0 {
 		return nil
 	}
+	if d.Txn.Size > 0 && idx < d.WorkerCount {
+		return errors.Trace(d.processTxn(ctx, idx, db, jobs))
+	}
 
-	var err error
-	for _, job := range jobs {
-		switch job.tp {
-		case Insert:
-			err = db.Insert(ctx, job.schema, job.table, job.values)
-		case Update:
-			err = db.Update(ctx, job.schema, job.table, job.keys, job.values)
-		case Delete:
-			err = db.Delete(ctx, job.schema, job.table, job.keys)
+	for len(jobs) > 0 {
+		group := jobs[:d.coalesceCount(jobs)]
+		jobs = jobs[len(group):]
+		start := time.Now()
+		id, err := d.execJobs(ctx, db, group)
+		end := time.Now()
+		for _, job := range group {
+			d.recordJob(job, start, err)
+			if d.Journal != nil {
+				d.writeJournal(idx, job, start, end, err, false)
+			}
+		}
+		if err == nil {
+			d.callInsertHook(group[0], id)
+		}
+		if err == nil && group[0].tp == Ddl {
+			err = d.refreshTableCache(ctx, group[0].ddl)
 		}
 		if err != nil {
 			return errors.Trace(err)
@@ -213,16 +436,224 @@ func (d *JobDispatcher) processJobs(ctx context.Context, db DB, jobs []*sqlJob)
 	return nil
 }
 
-func (d *JobDispatcher) dispatch(ctx context.Context, db DB, jobChan <-chan *sqlJob) {
+// processTxn executes DML jobs in a transaction, which is rolled back by
+// Txn.RollbackRatio or if any job fails. Jobs after the failed one are dropped.
+func (d *JobDispatcher) processTxn(ctx context.Context, idx int, db DB, jobs []*sqlJob) error {
+	if err := db.Begin(ctx); err != nil {
+		for _, job := range jobs {
+			d.callRollbackHook(job)
+		}
+		return errors.Trace(err)
+	}
+	type executedJob struct {
+		job        *sqlJob
+		id         int64
+		start, end time.Time
+		err        error
+	}
 	var (
-		count = d.BatchSize
-		jobs  = make([]*sqlJob, 0, count)
+		executed = make([]executedJob, 0, len(jobs))
+		err      error
 	)
+	for len(jobs) > 0 && err == nil {
+		group := jobs[:d.coalesceCount(jobs)]
+		jobs = jobs[len(group):]
+		start := time.Now()
+		var id int64
+		id, err = d.execJobs(ctx, db, group)
+		end := time.Now()
+		for _, job := range group {
+			d.recordJob(job, start, err)
+			executed = append(executed, executedJob{job: job, id: id, start: start, end: end, err: err})
+		}
+	}
+
+	var (
+		rollback = d.rnds[idx].Float64() < d.Txn.RollbackRatio || err != nil
+		endErr   error
+	)
+	if rollback {
+		endErr = db.Rollback(ctx)
+	} else {
+		endErr = db.Commit(ctx)
+		rollback = endErr != nil
+	}
+	d.Stats.recordTxn(!rollback)
+	if rollback {
+		txnCounter.WithLabelValues("rollback").Inc()
+	} else {
+		txnCounter.WithLabelValues("commit").Inc()
+	}
+	for _, e := range executed {
+		if d.Journal != nil {
+			d.writeJournal(idx, e.job, e.start, e.end, e.err, rollback)
+		}
+		// ids of rolled back rows are never tracked
+		if !rollback {
+			d.callInsertHook(e.job, e.id)
+		} else {
+			d.callRollbackHook(e.job)
+		}
+	}
+	for _, job := range jobs {
+		d.callRollbackHook(job)
+	}
+	if err != nil {
+		return errors.Trace(err)
+	}
+	return errors.Trace(endErr)
+}
+
+// coalesceCount returns the number of leading jobs executed in one statement. Consecutive
+// inserts and deletes of the same table and columns are coalesced if Coalesce is set.
+func (d *JobDispatcher) coalesceCount(jobs []*sqlJob) int {
+	first := jobs[0]
+	if !d.Coalesce || first.sql != "" {
+		return 1
+	}
+	// ids assigned by database to rows inserted without keys are tracked one by one
+	hook := d.getInsertHook()
+	switch {
+	case first.tp == Insert && len(first.values) > 0 && (hook == nil || len(first.keys) > 0):
+	case first.tp == Delete && len(first.keys) > 0:
+	default:
+		return 1
+	}
+	n := 1
+	for ; n < len(jobs); n++ {
+		job := jobs[n]
+		if job.tp != first.tp || job.sql != "" || job.schema != first.schema || job.table != first.table {
+			break
+		}
+		if job.tp == Delete && !sameFields(first.keys, job.keys) {
+			break
+		}
+		if job.tp == Insert && (!sameFields(first.values, job.values) || (hook != nil && len(job.keys) == 0)) {
+			break
+		}
+	}
+	return n
+}
+
+func sameFields(a, b map[string]interface{}) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for name := range b {
+		if _, ok := a[name]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// execJobs executes jobs coalesced by coalesceCount in one statement,
+// returns the id assigned by database if the only job is an insert
+func (d *JobDispatcher) execJobs(ctx context.Context, db DB, jobs []*sqlJob) (int64, error) {
+	if len(jobs) == 1 {
+		return d.execJob(ctx, db, jobs[0])
+	}
+	first := jobs[0]
+	fields := make([]map[string]interface{}, 0, len(jobs))
+	if first.tp == Insert {
+		for _, job := range jobs {
+			fields = append(fields, job.values)
+		}
+		return 0, errors.Trace(db.BatchInsert(ctx, first.schema, first.table, fields))
+	}
+	for _, job := range jobs {
+		fields = append(fields, job.keys)
+	}
+	return 0, errors.Trace(db.BatchDelete(ctx, first.schema, first.table, fields))
+}
+
+// execJob executes a job, returns the id assigned by database if the job is an insert
+func (d *JobDispatcher) execJob(ctx context.Context, db DB, job *sqlJob) (int64, error) {
+	var (
+		id  int64
+		err error
+	)
+	switch {
+	case job.sql != "" && job.tp != Ddl:
+		err = db.Exec(ctx, job.sql)
+	case job.tp == Insert:
+		id, err = db.Insert(ctx, job.schema, job.table, job.values)
+	case job.tp == Update:
+		err = db.Update(ctx, job.schema, job.table, job.keys, job.values)
+	case job.tp == Delete:
+		err = db.Delete(ctx, job.schema, job.table, job.keys)
+	case job.tp == Replace || job.tp == Upsert || job.tp == InsertIgnore:
+		err = db.Upsert(ctx, job.tp, job.schema, job.table, job.keys, job.values)
+	case job.tp == RangeUpdate:
+		err = db.RangeUpdate(ctx, job.schema, job.table, job.rng, job.values)
+	case job.tp == RangeDelete:
+		err = db.RangeDelete(ctx, job.schema, job.table, job.rng)
+	case job.tp == Ddl:
+		err = db.ExecDDL(ctx, job.ddl)
+		job.err = err
+	}
+	return id, errors.Trace(err)
+}
+
+// callInsertHook passes the id assigned by database of a row inserted without keys to the insert hook
+func (d *JobDispatcher) callInsertHook(job *sqlJob, id int64) {
+	if job.tp != Insert || job.sql != "" || id <= 0 || len(job.keys) > 0 {
+		return
+	}
+	if hook := d.getInsertHook(); hook != nil {
+		hook(job.schema, job.table, id)
+	}
+}
+
+// callRollbackHook passes the DML of a job which is rolled back or dropped to the rollback hook
+func (d *JobDispatcher) callRollbackHook(job *sqlJob) {
+	if job.dml == nil {
+		return
+	}
+	if hook := d.getRollbackHook(); hook != nil {
+		hook(job.dml)
+	}
+}
+
+// recordJob records statistics and metrics of an executed job
+func (d *JobDispatcher) recordJob(job *sqlJob, start time.Time, err error) {
+	latency := time.Since(start)
+	d.Stats.record(job.tp, job.schema, job.table, latency, err)
+	tp := job.tp.String()
+	jobLatencyHistogram.WithLabelValues(tp).Observe(latency.Seconds())
+	executedJobsCounter.WithLabelValues(tp, job.schema, job.table).Inc()
+	if err != nil {
+		jobErrorsCounter.WithLabelValues(tp, job.schema, job.table).Inc()
+	}
+}
+
+// refreshTableCache refreshes table cache of all DBs after a DDL is executed.
+// It is called from the DDL worker while all the other workers are idle.
+func (d *JobDispatcher) refreshTableCache(ctx context.Context, ddl *DDLParams) error {
+	for _, inst := range d.DBs {
+		err := inst.RefreshTableCache(ctx, ddl)
+		if err != nil {
+			return errors.Trace(err)
+		}
+	}
+	return nil
+}
+
+func (d *JobDispatcher) dispatch(ctx context.Context, idx int, db DB, jobChan <-chan *sqlJob) {
+	// a DML worker executes a transaction as soon as it has enough jobs
+	count := d.BatchSize
+	if d.Txn.Size > 0 && idx < d.WorkerCount {
+		count = d.Txn.Size
+	}
+	jobs := make([]*sqlJob, 0, count)
 
 	clearJobs := func(err error) {
 		if err != nil {
 			log.Errorf("process jobs error: %v", errors.ErrorStack(err))
 		}
+		for range jobs {
+			d.jobWg.Done()
+		}
 		jobs = jobs[:0]
 	}
 
@@ -230,23 +661,27 @@ func (d *JobDispatcher) dispatch(ctx context.Context, db DB, jobChan <-chan *sql
 	for {
 		select {
 		case <-ctx.Done():
-			err = d.processJobs(ctx, db, jobs)
+			err = d.processJobs(ctx, idx, db, jobs)
 			clearJobs(err)
 			return
 		case <-time.After(flushInterval):
-			err = d.processJobs(ctx, db, jobs)
+			err = d.processJobs(ctx, idx, db, jobs)
 			clearJobs(err)
 		case job, ok := <-jobChan:
 			if !ok {
 				return
 			}
+			queueSizeGauge.WithLabelValues(workerLabel(idx)).Set(float64(len(jobChan)))
 			if job.tp != Flush {
 				jobs = append(jobs, job)
 			}
-			if len(jobs) >= count || job.tp == Flush {
-				err = d.processJobs(ctx, db, jobs)
+			if len(jobs) >= count || job.tp == Flush || job.tp == Ddl {
+				err = d.processJobs(ctx, idx, db, jobs)
 				clearJobs(err)
 			}
+			if job.tp == Flush {
+				d.jobWg.Done()
+			}
 		}
 	}
 }
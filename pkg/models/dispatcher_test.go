@@ -0,0 +1,92 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCoalesceCount(t *testing.T) {
+	insert := func(table string, id interface{}) *sqlJob {
+		job := &sqlJob{tp: Insert, schema: "s", table: table, values: map[string]interface{}{"id": id, "name": "a"}}
+		if id != nil {
+			job.keys = map[string]interface{}{"id": id}
+		} else {
+			delete(job.values, "id")
+		}
+		return job
+	}
+	del := func(table string, id int) *sqlJob {
+		return &sqlJob{tp: Delete, schema: "s", table: table, keys: map[string]interface{}{"id": id}}
+	}
+	update := &sqlJob{tp: Update, schema: "s", table: "t", keys: map[string]interface{}{"id": 1}}
+
+	d := &JobDispatcher{}
+	jobs := []*sqlJob{insert("t", 1), insert("t", 2), insert("t", 3)}
+	assert.Equal(t, 1, d.coalesceCount(jobs))
+
+	d.Coalesce = true
+	assert.Equal(t, 3, d.coalesceCount(jobs))
+	assert.Equal(t, 2, d.coalesceCount([]*sqlJob{insert("t", 1), insert("t", 2), insert("u", 3)}))
+	assert.Equal(t, 1, d.coalesceCount([]*sqlJob{insert("t", 1), insert("t", nil)}))
+	assert.Equal(t, 2, d.coalesceCount([]*sqlJob{del("t", 1), del("t", 2), update, del("t", 3)}))
+	assert.Equal(t, 1, d.coalesceCount([]*sqlJob{update, update}))
+	assert.Equal(t, 1, d.coalesceCount([]*sqlJob{{tp: Insert, sql: "INSERT"}, {tp: Insert, sql: "INSERT"}}))
+
+	// rows inserted without keys are executed one by one if their ids are tracked
+	assert.Equal(t, 2, d.coalesceCount([]*sqlJob{insert("t", nil), insert("t", nil)}))
+	d.SetInsertHook(func(string, string, int64) {})
+	assert.Equal(t, 1, d.coalesceCount([]*sqlJob{insert("t", nil), insert("t", nil)}))
+	assert.Equal(t, 2, d.coalesceCount([]*sqlJob{insert("t", 1), insert("t", 2), insert("t", nil)}))
+}
+
+// orderDB records executed inserts and range deletes, other methods are not implemented
+type orderDB struct {
+	DB
+	sync.Mutex
+	ops []string
+}
+
+func (db *orderDB) Insert(_ context.Context, _, _ string, values map[string]interface{}) (int64, error) {
+	db.Lock()
+	defer db.Unlock()
+	db.ops = append(db.ops, fmt.Sprintf("insert %v", values["id"]))
+	return 0, nil
+}
+
+func (db *orderDB) RangeDelete(_ context.Context, _, _ string, rng *RangeParams) error {
+	db.Lock()
+	defer db.Unlock()
+	db.ops = append(db.ops, fmt.Sprintf("range-delete %v-%v", rng.Begin, rng.End))
+	return nil
+}
+
+func TestRangeJobOrder(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	db := &orderDB{}
+	d := &JobDispatcher{ctx: ctx, WorkerCount: 2, BatchSize: 10, Stats: NewStats(), DBs: []DB{db, db, db}}
+	d.createJobChans()
+	go d.Run(ctx)
+
+	insert := func(id int) *DMLParams {
+		values := map[string]interface{}{"id": id}
+		return &DMLParams{Type: Insert, Schema: "s", Table: "t", Keys: values, Values: values}
+	}
+	for id := 1; id <= 4; id++ {
+		d.AddDML(insert(id))
+	}
+	d.AddDML(&DMLParams{Type: RangeDelete, Schema: "s", Table: "t", Range: &RangeParams{Column: "id", Begin: 1, End: 5}})
+	d.AddDML(insert(5))
+	d.Flush()
+
+	// batched inserts of all workers are executed before the range delete, and later ones after it
+	db.Lock()
+	defer db.Unlock()
+	assert.Len(t, db.ops, 6)
+	assert.ElementsMatch(t, []string{"insert 1", "insert 2", "insert 3", "insert 4"}, db.ops[:4])
+	assert.Equal(t, []string{"range-delete 1-5", "insert 5"}, db.ops[4:])
+}
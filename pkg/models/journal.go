@@ -0,0 +1,147 @@
+package models
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pingcap/errors"
+
+	"github.com/amyangfei/data-dam/pkg/log"
+)
+
+// JournalRecord is a job executed by the dispatcher, it can be replayed as DMLParams
+type JournalRecord struct {
+	DMLParams
+	BinaryColumns []string  `json:"binary-columns,omitempty"` // columns of []byte values, which are base64 strings in JSON
+	Worker        int       `json:"worker"`
+	StartTime     time.Time `json:"start-time"`
+	EndTime       time.Time `json:"end-time"`
+	Error         string    `json:"error,omitempty"`
+	Rollback      bool      `json:"rollback,omitempty"` // the job is executed in a transaction which is rolled back
+}
+
+// Journal appends executed jobs to a file in JSON lines
+type Journal struct {
+	sync.Mutex
+	file    *os.File
+	encoder *json.Encoder
+}
+
+// NewJournal opens the journal file for appending
+func NewJournal(path string) (*Journal, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	return &Journal{
+		file:    file,
+		encoder: json.NewEncoder(file),
+	}, nil
+}
+
+// Write appends a record in a line
+func (j *Journal) Write(record *JournalRecord) error {
+	j.Lock()
+	defer j.Unlock()
+	return errors.Trace(j.encoder.Encode(record))
+}
+
+// Close closes the journal file
+func (j *Journal) Close() error {
+	j.Lock()
+	defer j.Unlock()
+	return errors.Trace(j.file.Close())
+}
+
+func (d *JobDispatcher) writeJournal(idx int, job *sqlJob, start, end time.Time, err error, rollback bool) {
+	record := &JournalRecord{
+		DMLParams: DMLParams{
+			Type:   job.tp,
+			Schema: job.schema,
+			Table:  job.table,
+			Keys:   job.keys,
+			Values: job.values,
+			Range:  job.rng,
+			SQL:    job.sql,
+		},
+		Worker:    idx,
+		StartTime: start,
+		EndTime:   end,
+		Rollback:  rollback,
+	}
+	record.BinaryColumns = binaryColumns(&record.DMLParams)
+	if job.ddl != nil {
+		record.SQL = job.ddl.SQL
+	}
+	if err != nil {
+		record.Error = err.Error()
+	}
+	if err = d.Journal.Write(record); err != nil {
+		log.Errorf("write journal error: %v", err)
+	}
+}
+
+// binaryColumns returns sorted names of columns whose values in params are []byte
+func binaryColumns(params *DMLParams) []string {
+	binary := make(map[string]bool)
+	for _, m := range []map[string]interface{}{params.Keys, params.Values} {
+		for name, value := range m {
+			if _, ok := value.([]byte); ok {
+				binary[name] = true
+			}
+		}
+	}
+	if rng := params.Range; rng != nil {
+		if _, ok := rng.Begin.([]byte); ok {
+			binary[rng.Column] = true
+		}
+	}
+	if len(binary) == 0 {
+		return nil
+	}
+	names := make([]string, 0, len(binary))
+	for name := range binary {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// DecodeBinaryValues decodes values of binary columns in params decoded from JSON,
+// which are base64 strings, to []byte.
+func DecodeBinaryValues(params *DMLParams, columns []string) error {
+	decode := func(value interface{}) (interface{}, error) {
+		s, ok := value.(string)
+		if !ok {
+			return value, nil
+		}
+		b, err := base64.StdEncoding.DecodeString(s)
+		return b, errors.Annotatef(err, "decode binary value %q", s)
+	}
+	var err error
+	for _, name := range columns {
+		for _, m := range []map[string]interface{}{params.Keys, params.Values} {
+			if value, ok := m[name]; ok {
+				m[name], err = decode(value)
+				if err != nil {
+					return errors.Trace(err)
+				}
+			}
+		}
+		if rng := params.Range; rng != nil && rng.Column == name {
+			rng.Begin, err = decode(rng.Begin)
+			if err != nil {
+				return errors.Trace(err)
+			}
+			rng.End, err = decode(rng.End)
+			if err != nil {
+				return errors.Trace(err)
+			}
+		}
+	}
+	return nil
+}
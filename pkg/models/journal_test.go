@@ -0,0 +1,108 @@
+package models
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pingcap/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// journalDB executes inserts and updates, deletes fail, other methods are not implemented
+type journalDB struct {
+	DB
+}
+
+func (db journalDB) Insert(_ context.Context, _, _ string, _ map[string]interface{}) (int64, error) {
+	return 0, nil
+}
+
+func (db journalDB) Update(_ context.Context, _, _ string, _, _ map[string]interface{}) error {
+	return nil
+}
+
+func (db journalDB) Delete(_ context.Context, _, _ string, _ map[string]interface{}) error {
+	return errors.New("delete fails")
+}
+
+func TestDispatcherJournal(t *testing.T) {
+	dir, err := ioutil.TempDir("", "data-dam")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "journal.json")
+	journal, err := NewJournal(path)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	db := journalDB{}
+	d := &JobDispatcher{ctx: ctx, WorkerCount: 2, BatchSize: 10, DBs: []DB{db, db, db}, Journal: journal, Stats: NewStats()}
+	d.createJobChans()
+	go d.Run(ctx)
+
+	row := func(tp OpType, id int) *DMLParams {
+		keys := map[string]interface{}{"id": id}
+		return &DMLParams{Type: tp, Schema: "s", Table: "t", Keys: keys, Values: map[string]interface{}{"name": "a"}}
+	}
+	for id := 1; id <= 4; id++ {
+		d.AddDML(row(Insert, id))
+	}
+	d.AddDML(row(Update, 1))
+	d.Flush()
+	d.AddDML(row(Delete, 2))
+	d.Flush()
+	require.NoError(t, journal.Close())
+
+	// every executed job is recorded with its error
+	file, err := os.Open(path)
+	require.NoError(t, err)
+	defer file.Close()
+	counts := make(map[OpType]int)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		record := &JournalRecord{}
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), record))
+		counts[record.Type]++
+		assert.Equal(t, "s", record.Schema)
+		assert.Equal(t, "t", record.Table)
+		assert.Contains(t, []float64{1, 2, 3, 4}, record.Keys["id"])
+		assert.True(t, record.Worker >= 0 && record.Worker < d.WorkerCount)
+		assert.False(t, record.EndTime.Before(record.StartTime))
+		if record.Type == Delete {
+			assert.Equal(t, "delete fails", record.Error)
+		} else {
+			assert.Empty(t, record.Error)
+			assert.Equal(t, "a", record.Values["name"])
+		}
+	}
+	require.NoError(t, scanner.Err())
+	assert.Equal(t, map[OpType]int{Insert: 4, Update: 1, Delete: 1}, counts)
+}
+
+func TestBinaryValues(t *testing.T) {
+	params := &DMLParams{
+		Keys:   map[string]interface{}{"k": []byte("k")},
+		Values: map[string]interface{}{"k": []byte("k"), "b": []byte{0xff}, "s": "s"},
+		Range:  &RangeParams{Column: "r", Begin: []byte("r")},
+	}
+	columns := binaryColumns(params)
+	assert.Equal(t, []string{"b", "k", "r"}, columns)
+	assert.Nil(t, binaryColumns(&DMLParams{Values: map[string]interface{}{"s": "s"}}))
+
+	// values decoded from JSON are base64 strings
+	decoded := &DMLParams{
+		Keys:   map[string]interface{}{"k": "aw=="},
+		Values: map[string]interface{}{"k": "aw==", "b": "/w==", "s": "s"},
+		Range:  &RangeParams{Column: "r", Begin: "cg=="},
+	}
+	require.NoError(t, DecodeBinaryValues(decoded, columns))
+	assert.Equal(t, params, decoded)
+
+	assert.Error(t, DecodeBinaryValues(&DMLParams{Values: map[string]interface{}{"b": "?"}}, []string{"b"}))
+}
@@ -0,0 +1,236 @@
+package models
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MaxKeyRetry is the maximum times of regenerating a random key conflicting with live keys
+const MaxKeyRetry = 10
+
+// Key is the comparable encoding of values of key columns, which is stored in KeySet.
+// Every value is encoded as `tag length:data`, so values keep their types after decoding.
+type Key string
+
+// tags of encoded key values
+const (
+	keyTagNil    = 'n'
+	keyTagInt    = 'i'
+	keyTagUint   = 'u'
+	keyTagFloat  = 'f'
+	keyTagBool   = 't'
+	keyTagString = 's'
+	keyTagBytes  = 'b'
+)
+
+// EncodeKey encodes values of key columns. Integers are encoded as int64 (uint64
+// if it overflows int64), floats as float64, times and unknown types as strings.
+func EncodeKey(values []interface{}) Key {
+	var b strings.Builder
+	for _, v := range values {
+		var (
+			tag  byte
+			data string
+		)
+		switch val := v.(type) {
+		case nil:
+			tag = keyTagNil
+		case int:
+			tag, data = keyTagInt, strconv.FormatInt(int64(val), 10)
+		case int8:
+			tag, data = keyTagInt, strconv.FormatInt(int64(val), 10)
+		case int16:
+			tag, data = keyTagInt, strconv.FormatInt(int64(val), 10)
+		case int32:
+			tag, data = keyTagInt, strconv.FormatInt(int64(val), 10)
+		case int64:
+			tag, data = keyTagInt, strconv.FormatInt(val, 10)
+		case uint:
+			tag, data = encodeUint(uint64(val))
+		case uint8:
+			tag, data = encodeUint(uint64(val))
+		case uint16:
+			tag, data = encodeUint(uint64(val))
+		case uint32:
+			tag, data = encodeUint(uint64(val))
+		case uint64:
+			tag, data = encodeUint(val)
+		case float32:
+			tag, data = keyTagFloat, strconv.FormatFloat(float64(val), 'g', -1, 32)
+		case float64:
+			tag, data = keyTagFloat, strconv.FormatFloat(val, 'g', -1, 64)
+		case bool:
+			tag, data = keyTagBool, strconv.FormatBool(val)
+		case string:
+			tag, data = keyTagString, val
+		case []byte:
+			tag, data = keyTagBytes, string(val)
+		case time.Time:
+			tag, data = keyTagString, val.Format("2006-01-02 15:04:05.999999")
+		default:
+			tag, data = keyTagString, fmt.Sprint(val)
+		}
+		b.WriteByte(tag)
+		b.WriteString(strconv.Itoa(len(data)))
+		b.WriteByte(':')
+		b.WriteString(data)
+	}
+	return Key(b.String())
+}
+
+func encodeUint(v uint64) (byte, string) {
+	if v <= math.MaxInt64 {
+		return keyTagInt, strconv.FormatInt(int64(v), 10)
+	}
+	return keyTagUint, strconv.FormatUint(v, 10)
+}
+
+// Values decodes values of key columns
+func (k Key) Values() []interface{} {
+	values := make([]interface{}, 0, 1)
+	s := string(k)
+	for len(s) > 0 {
+		tag := s[0]
+		sep := strings.IndexByte(s, ':')
+		n, err := strconv.Atoi(s[1:sep])
+		if err != nil {
+			panic(fmt.Sprintf("invalid key %q", string(k)))
+		}
+		data := s[sep+1 : sep+1+n]
+		s = s[sep+1+n:]
+
+		var v interface{}
+		switch tag {
+		case keyTagInt:
+			v, _ = strconv.ParseInt(data, 10, 64)
+		case keyTagUint:
+			v, _ = strconv.ParseUint(data, 10, 64)
+		case keyTagFloat:
+			v, _ = strconv.ParseFloat(data, 64)
+		case keyTagBool:
+			v, _ = strconv.ParseBool(data)
+		case keyTagString:
+			v = data
+		case keyTagBytes:
+			v = []byte(data)
+		}
+		values = append(values, v)
+	}
+	return values
+}
+
+// KeyColumns returns columns identifying a row, which are columns of the primary key,
+// or a unique key if there is no primary key, unique keys of NOT NULL columns are preferred.
+// nil is returned if there is neither primary key nor unique key.
+func (t *Table) KeyColumns() []*Column {
+	if cols := t.IndexColumns["primary"]; len(cols) > 0 {
+		return cols
+	}
+	names := make([]string, 0, len(t.IndexColumns))
+	for name, cols := range t.IndexColumns {
+		if len(cols) > 0 {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		notNull := true
+		for _, column := range t.IndexColumns[name] {
+			notNull = notNull && column.NotNull
+		}
+		if notNull {
+			return t.IndexColumns[name]
+		}
+	}
+	if len(names) > 0 {
+		return t.IndexColumns[names[0]]
+	}
+	return nil
+}
+
+// IsKeyColumn checks whether column is one of KeyColumns
+func (t *Table) IsKeyColumn(column *Column) bool {
+	for _, col := range t.KeyColumns() {
+		if col.Name == column.Name {
+			return true
+		}
+	}
+	return false
+}
+
+// IndexedColumn returns the first column of the first non-unique index by name, nil if there is none
+func (t *Table) IndexedColumn() *Column {
+	names := make([]string, 0, len(t.NonUniqueIndexColumns))
+	for name, cols := range t.NonUniqueIndexColumns {
+		if len(cols) > 0 {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return nil
+	}
+	sort.Strings(names)
+	return t.NonUniqueIndexColumns[names[0]][0]
+}
+
+// UpdatableColumns returns columns which are neither the primary key nor part of a unique index
+func (t *Table) UpdatableColumns() []*Column {
+	columns := make([]*Column, 0, len(t.Columns))
+	for _, column := range t.Columns {
+		if column.Key == "PRI" || column.Key == "UNI" {
+			continue
+		}
+		unique := false
+		for _, cols := range t.IndexColumns {
+			for _, col := range cols {
+				if col.Name == column.Name {
+					unique = true
+				}
+			}
+		}
+		if !unique {
+			columns = append(columns, column)
+		}
+	}
+	return columns
+}
+
+// AutoIncrementColumn returns the auto increment column of table, nil if there is none
+func (t *Table) AutoIncrementColumn() *Column {
+	for _, column := range t.Columns {
+		if strings.Contains(strings.ToLower(column.Extra), "auto_increment") {
+			return column
+		}
+	}
+	return nil
+}
+
+// KeyValues returns values of key columns in a map of column name -> value
+func KeyValues(columns []*Column, key Key) map[string]interface{} {
+	values := key.Values()
+	keys := make(map[string]interface{}, len(columns))
+	for idx, column := range columns {
+		if idx < len(values) {
+			keys[column.Name] = values[idx]
+		}
+	}
+	return keys
+}
+
+// SameKeyColumns checks whether two tables are identified by the same key columns
+func SameKeyColumns(a, b *Table) bool {
+	colsA, colsB := a.KeyColumns(), b.KeyColumns()
+	if len(colsA) != len(colsB) {
+		return false
+	}
+	for idx := range colsA {
+		if colsA[idx].Name != colsB[idx].Name || colsA[idx].Tp != colsB[idx].Tp {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,77 @@
+package models
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncodeKey(t *testing.T) {
+	values := []interface{}{nil, int64(-3), uint64(math.MaxUint64), 1.5, true, "a:b1:", []byte{0, ':'}}
+	assert.Equal(t, values, EncodeKey(values).Values())
+
+	// values of the same number are the same key whatever the types are
+	assert.Equal(t, EncodeKey([]interface{}{int64(7)}), EncodeKey([]interface{}{7}))
+	assert.Equal(t, EncodeKey([]interface{}{int64(7)}), EncodeKey([]interface{}{uint8(7)}))
+	assert.NotEqual(t, EncodeKey([]interface{}{"7"}), EncodeKey([]interface{}{7}))
+	assert.NotEqual(t, EncodeKey([]interface{}{"a", "bc"}), EncodeKey([]interface{}{"ab", "c"}))
+
+	ts := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	assert.Equal(t, []interface{}{"2020-01-02 03:04:05"}, EncodeKey([]interface{}{ts}).Values())
+
+	columns := []*Column{{Name: "a"}, {Name: "b"}}
+	assert.Equal(t, map[string]interface{}{"a": "x", "b": int64(1)}, KeyValues(columns, EncodeKey([]interface{}{"x", 1})))
+}
+
+func TestKeyColumns(t *testing.T) {
+	var (
+		id    = &Column{Name: "id", NotNull: true}
+		email = &Column{Name: "email", NotNull: true}
+		name  = &Column{Name: "name"}
+	)
+	table := &Table{
+		Columns: []*Column{id, email, name},
+		IndexColumns: map[string][]*Column{
+			"primary": {id},
+			"a_name":  {name},
+			"b_email": {email},
+		},
+	}
+	assert.Equal(t, []*Column{id}, table.KeyColumns())
+	assert.True(t, table.IsKeyColumn(id))
+	assert.False(t, table.IsKeyColumn(email))
+
+	// unique keys of NOT NULL columns are preferred
+	delete(table.IndexColumns, "primary")
+	assert.Equal(t, []*Column{email}, table.KeyColumns())
+	delete(table.IndexColumns, "b_email")
+	assert.Equal(t, []*Column{name}, table.KeyColumns())
+	delete(table.IndexColumns, "a_name")
+	assert.Nil(t, table.KeyColumns())
+}
+
+func TestUpdatableColumns(t *testing.T) {
+	var (
+		id    = &Column{Name: "id", Key: "PRI"}
+		code  = &Column{Name: "code", Key: "UNI"}
+		email = &Column{Name: "email", Key: "MUL"}
+		phone = &Column{Name: "phone"}
+		name  = &Column{Name: "name", Key: "MUL"}
+	)
+	table := &Table{
+		Columns: []*Column{id, code, email, phone, name},
+		IndexColumns: map[string][]*Column{
+			"primary":        {id},
+			"code":           {code},
+			"uk_email_phone": {email, phone},
+		},
+		NonUniqueIndexColumns: map[string][]*Column{"idx_name": {name}},
+	}
+	// all columns of a composite unique index are not updatable, whose Key is MUL or empty
+	assert.Equal(t, []*Column{name}, table.UpdatableColumns())
+
+	delete(table.IndexColumns, "uk_email_phone")
+	assert.Equal(t, []*Column{email, phone, name}, table.UpdatableColumns())
+}
@@ -0,0 +1,110 @@
+package models
+
+// KeySet is a set of live keys of a table ordered by insertion, keys must be comparable.
+// Removed keys are left as holes, and a fenwick tree counting live keys finds
+// the i-th live key in O(log n). Holes are compacted when they outnumber live keys.
+type KeySet struct {
+	keys  []interface{}       // keys in insertion order, nil for removed keys
+	index map[interface{}]int // live key -> position in keys
+	tree  []int               // 1-based fenwick tree of live flags of keys
+}
+
+// NewKeySet creates a KeySet with keys in insertion order
+func NewKeySet(keys []interface{}) *KeySet {
+	s := &KeySet{}
+	s.rebuild(keys)
+	return s
+}
+
+func (s *KeySet) rebuild(keys []interface{}) {
+	s.keys = make([]interface{}, 0, len(keys))
+	s.index = make(map[interface{}]int, len(keys))
+	for _, key := range keys {
+		if key == nil {
+			continue
+		}
+		if _, ok := s.index[key]; ok {
+			continue
+		}
+		s.index[key] = len(s.keys)
+		s.keys = append(s.keys, key)
+	}
+	// every node of a full tree is the length of the range it covers
+	s.tree = make([]int, len(s.keys)+1)
+	for i := 1; i < len(s.tree); i++ {
+		s.tree[i] = i & -i
+	}
+}
+
+// Len returns the number of live keys
+func (s *KeySet) Len() int {
+	return len(s.index)
+}
+
+// Contains returns whether key is live
+func (s *KeySet) Contains(key interface{}) bool {
+	_, ok := s.index[key]
+	return ok
+}
+
+// Add appends key as the latest key, nothing happens if the key is live
+func (s *KeySet) Add(key interface{}) {
+	if _, ok := s.index[key]; ok {
+		return
+	}
+	s.index[key] = len(s.keys)
+	s.keys = append(s.keys, key)
+	// the new node covers (pos - lowbit(pos), pos], all keys in it except itself
+	// are counted by nodes of its lower bits.
+	pos := len(s.keys)
+	count := 1
+	for i := pos - 1; i > pos-(pos&-pos); i -= i & -i {
+		count += s.tree[i]
+	}
+	s.tree = append(s.tree, count)
+}
+
+// Remove removes key, and returns whether the key is live before
+func (s *KeySet) Remove(key interface{}) bool {
+	pos, ok := s.index[key]
+	if !ok {
+		return false
+	}
+	delete(s.index, key)
+	s.keys[pos] = nil
+	for i := pos + 1; i < len(s.tree); i += i & -i {
+		s.tree[i]--
+	}
+	if len(s.keys) > 64 && len(s.keys) > 2*len(s.index) {
+		s.rebuild(s.keys)
+	}
+	return true
+}
+
+// Get returns the i-th live key in insertion order, i is in [0, Len())
+func (s *KeySet) Get(i int) interface{} {
+	if i < 0 || i >= len(s.index) {
+		return nil
+	}
+	// finds the largest position whose prefix count is not more than i
+	pos, remain := 0, i
+	step := 1
+	for step*2 < len(s.tree) {
+		step *= 2
+	}
+	for ; step > 0; step /= 2 {
+		if next := pos + step; next < len(s.tree) && s.tree[next] <= remain {
+			pos = next
+			remain -= s.tree[next]
+		}
+	}
+	return s.keys[pos]
+}
+
+// Choose returns a live key chosen by chooser, nil if the set is empty
+func (s *KeySet) Choose(chooser KeyChooser) interface{} {
+	if len(s.index) == 0 {
+		return nil
+	}
+	return s.Get(int(chooser.Choose(int64(len(s.index)))))
+}
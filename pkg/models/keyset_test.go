@@ -0,0 +1,57 @@
+package models
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeySet(t *testing.T) {
+	s := NewKeySet([]interface{}{int64(1), int64(2), int64(2), int64(3)})
+	assert.Equal(t, 3, s.Len())
+	assert.Equal(t, int64(2), s.Get(1))
+	assert.Nil(t, s.Get(3))
+
+	assert.True(t, s.Remove(int64(2)))
+	assert.False(t, s.Remove(int64(2)))
+	assert.False(t, s.Contains(int64(2)))
+	assert.Equal(t, int64(3), s.Get(1))
+
+	// a removed key is appended as the latest key
+	s.Add(int64(2))
+	s.Add(int64(3))
+	assert.Equal(t, []interface{}{int64(1), int64(3), int64(2)}, []interface{}{s.Get(0), s.Get(1), s.Get(2)})
+
+	empty := NewKeySet(nil)
+	assert.Nil(t, empty.Choose(&uniformChooser{rnd: rand.New(rand.NewSource(1))}))
+}
+
+func TestKeySetRandom(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	s := NewKeySet(nil)
+	expected := make([]interface{}, 0)
+	next := 0
+	for i := 0; i < 20000; i++ {
+		if len(expected) > 0 && rnd.Intn(5) < 2 {
+			idx := rnd.Intn(len(expected))
+			require.True(t, s.Remove(expected[idx]))
+			expected = append(expected[:idx], expected[idx+1:]...)
+		} else {
+			key := fmt.Sprintf("key-%d", next)
+			next++
+			s.Add(key)
+			expected = append(expected, key)
+		}
+		require.Equal(t, len(expected), s.Len())
+		if len(expected) > 0 {
+			idx := rnd.Intn(len(expected))
+			require.Equal(t, expected[idx], s.Get(idx))
+		}
+	}
+	for idx, key := range expected {
+		require.Equal(t, key, s.Get(idx))
+	}
+}
@@ -0,0 +1,63 @@
+package models
+
+import (
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	executedJobsCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "data_dam",
+			Subsystem: "dispatcher",
+			Name:      "executed_jobs_total",
+			Help:      "total number of jobs executed by dispatcher",
+		}, []string{"type", "schema", "table"})
+
+	jobErrorsCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "data_dam",
+			Subsystem: "dispatcher",
+			Name:      "job_errors_total",
+			Help:      "total number of jobs failed to execute",
+		}, []string{"type", "schema", "table"})
+
+	jobLatencyHistogram = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: "data_dam",
+			Subsystem: "dispatcher",
+			Name:      "job_duration_seconds",
+			Help:      "bucketed histogram of statement execution time (s) of jobs",
+			Buckets:   prometheus.ExponentialBuckets(0.0005, 2, 18),
+		}, []string{"type"})
+
+	txnCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "data_dam",
+			Subsystem: "dispatcher",
+			Name:      "transactions_total",
+			Help:      "total number of transactions finished by dispatcher",
+		}, []string{"result"})
+
+	queueSizeGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "data_dam",
+			Subsystem: "dispatcher",
+			Name:      "queue_size",
+			Help:      "number of jobs waiting in the job channel of worker",
+		}, []string{"worker"})
+)
+
+// RegisterMetrics registers metrics of dispatcher
+func RegisterMetrics(registry *prometheus.Registry) {
+	registry.MustRegister(executedJobsCounter)
+	registry.MustRegister(jobErrorsCounter)
+	registry.MustRegister(jobLatencyHistogram)
+	registry.MustRegister(txnCounter)
+	registry.MustRegister(queueSizeGauge)
+}
+
+func workerLabel(idx int) string {
+	return strconv.Itoa(idx)
+}
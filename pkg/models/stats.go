@@ -0,0 +1,209 @@
+package models
+
+import (
+	"fmt"
+	"math"
+	"math/bits"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/pingcap/errors"
+)
+
+const (
+	// latencies are recorded in microseconds, every power of two is divided
+	// into 2^subBucketBits buckets, so the relative error is about 3%.
+	subBucketBits  = 5
+	subBucketCount = 1 << subBucketBits
+)
+
+// latencyHistogram is a log-linear histogram of latencies
+type latencyHistogram struct {
+	counts []int64
+	total  int64
+	max    time.Duration
+}
+
+func bucketIndex(us int64) int {
+	if us < subBucketCount {
+		return int(us)
+	}
+	exp := bits.Len64(uint64(us)) - 1
+	shift := uint(exp - subBucketBits)
+	return subBucketCount + int(shift)*subBucketCount + int(us>>shift) - subBucketCount
+}
+
+// bucketValue returns the upper bound of bucket in microseconds
+func bucketValue(idx int) int64 {
+	if idx < subBucketCount {
+		return int64(idx)
+	}
+	shift := uint((idx - subBucketCount) / subBucketCount)
+	sub := int64((idx-subBucketCount)%subBucketCount) + subBucketCount
+	return (sub+1)<<shift - 1
+}
+
+func (h *latencyHistogram) record(d time.Duration) {
+	idx := bucketIndex(int64(d / time.Microsecond))
+	if idx >= len(h.counts) {
+		counts := make([]int64, idx+1)
+		copy(counts, h.counts)
+		h.counts = counts
+	}
+	h.counts[idx]++
+	h.total++
+	if d > h.max {
+		h.max = d
+	}
+}
+
+// quantile returns the latency at quantile q, which is in [0, 1]
+func (h *latencyHistogram) quantile(q float64) time.Duration {
+	if h.total == 0 {
+		return 0
+	}
+	target := int64(math.Ceil(q * float64(h.total)))
+	if target < 1 {
+		target = 1
+	}
+	var count int64
+	for idx, c := range h.counts {
+		count += c
+		if count >= target {
+			d := time.Duration(bucketValue(idx)) * time.Microsecond
+			if d > h.max {
+				d = h.max
+			}
+			return d
+		}
+	}
+	return h.max
+}
+
+type opStats struct {
+	count   int64
+	errors  int64
+	latency latencyHistogram
+}
+
+// Stats collects statistics of executed jobs
+type Stats struct {
+	sync.Mutex
+	ops        map[OpType]*opStats
+	tables     map[string]int64 // `schema`.`table` -> number of executed jobs
+	errorCodes map[string]int64 // error code -> number of errors
+	commits    int64
+	rollbacks  int64 // transactions rolled back intentionally or by errors
+}
+
+// NewStats creates a new Stats
+func NewStats() *Stats {
+	return &Stats{
+		ops:        make(map[OpType]*opStats),
+		tables:     make(map[string]int64),
+		errorCodes: make(map[string]int64),
+	}
+}
+
+func (s *Stats) record(tp OpType, schema, table string, latency time.Duration, err error) {
+	s.Lock()
+	defer s.Unlock()
+	op, ok := s.ops[tp]
+	if !ok {
+		op = &opStats{}
+		s.ops[tp] = op
+	}
+	op.count++
+	op.latency.record(latency)
+	s.tables[fmt.Sprintf("%s.%s", schema, table)]++
+	if err != nil {
+		op.errors++
+		s.errorCodes[ErrorCode(err)]++
+	}
+}
+
+func (s *Stats) recordTxn(committed bool) {
+	s.Lock()
+	defer s.Unlock()
+	if committed {
+		s.commits++
+	} else {
+		s.rollbacks++
+	}
+}
+
+// OpStats is the statistics of an OpType, latencies are in milliseconds
+type OpStats struct {
+	Type   OpType  `json:"type"`
+	Count  int64   `json:"count"`
+	Errors int64   `json:"errors"`
+	P50    float64 `json:"p50-ms"`
+	P95    float64 `json:"p95-ms"`
+	P99    float64 `json:"p99-ms"`
+	Max    float64 `json:"max-ms"`
+}
+
+// StatsSnapshot is a copy of Stats at some time
+type StatsSnapshot struct {
+	Ops        []OpStats        `json:"ops"`
+	Tables     map[string]int64 `json:"tables"`
+	ErrorCodes map[string]int64 `json:"error-codes"`
+	Commits    int64            `json:"commits,omitempty"`
+	Rollbacks  int64            `json:"rollbacks,omitempty"`
+}
+
+// Total returns the number of executed jobs and errors
+func (s *StatsSnapshot) Total() (count, errors int64) {
+	for _, op := range s.Ops {
+		count += op.Count
+		errors += op.Errors
+	}
+	return
+}
+
+// Snapshot returns the current statistics, OpTypes are sorted
+func (s *Stats) Snapshot() *StatsSnapshot {
+	s.Lock()
+	defer s.Unlock()
+	snap := &StatsSnapshot{
+		Ops:        make([]OpStats, 0, len(s.ops)),
+		Tables:     make(map[string]int64, len(s.tables)),
+		ErrorCodes: make(map[string]int64, len(s.errorCodes)),
+		Commits:    s.commits,
+		Rollbacks:  s.rollbacks,
+	}
+	for tp, op := range s.ops {
+		snap.Ops = append(snap.Ops, OpStats{
+			Type:   tp,
+			Count:  op.count,
+			Errors: op.errors,
+			P50:    toMillisecond(op.latency.quantile(0.50)),
+			P95:    toMillisecond(op.latency.quantile(0.95)),
+			P99:    toMillisecond(op.latency.quantile(0.99)),
+			Max:    toMillisecond(op.latency.max),
+		})
+	}
+	sort.Slice(snap.Ops, func(i, j int) bool { return snap.Ops[i].Type < snap.Ops[j].Type })
+	for k, v := range s.tables {
+		snap.Tables[k] = v
+	}
+	for k, v := range s.errorCodes {
+		snap.ErrorCodes[k] = v
+	}
+	return snap
+}
+
+func toMillisecond(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// ErrorCode returns the MySQL error number of err, or `unknown` for other errors
+func ErrorCode(err error) string {
+	if e, ok := errors.Cause(err).(*mysql.MySQLError); ok {
+		return strconv.Itoa(int(e.Number))
+	}
+	return "unknown"
+}
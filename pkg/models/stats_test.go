@@ -0,0 +1,47 @@
+package models
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLatencyHistogram(t *testing.T) {
+	h := &latencyHistogram{}
+	assert.Equal(t, time.Duration(0), h.quantile(0.5))
+	for i := 1; i <= 1000; i++ {
+		h.record(time.Duration(i) * time.Millisecond)
+	}
+	for _, q := range []float64{0.5, 0.95, 0.99} {
+		expected := float64(q*1000) * float64(time.Millisecond)
+		actual := float64(h.quantile(q))
+		assert.InEpsilon(t, expected, actual, 0.04, "quantile %f", q)
+	}
+	assert.Equal(t, time.Second, h.quantile(1))
+	assert.Equal(t, time.Second, h.max)
+
+	for us := int64(0); us < 1<<20; us += 7 {
+		assert.True(t, bucketValue(bucketIndex(us)) >= us)
+	}
+}
+
+func TestStatsSnapshot(t *testing.T) {
+	s := NewStats()
+	s.record(Insert, "db", "t1", time.Millisecond, nil)
+	s.record(Insert, "db", "t1", time.Millisecond, &mysql.MySQLError{Number: 1062})
+	s.record(Delete, "db", "t2", time.Millisecond, errors.New("unknown"))
+
+	snap := s.Snapshot()
+	assert.Len(t, snap.Ops, 2)
+	assert.Equal(t, Insert, snap.Ops[0].Type)
+	assert.Equal(t, int64(2), snap.Ops[0].Count)
+	assert.Equal(t, int64(1), snap.Ops[0].Errors)
+	assert.Equal(t, map[string]int64{"db.t1": 2, "db.t2": 1}, snap.Tables)
+	assert.Equal(t, map[string]int64{"1062": 1, "unknown": 1}, snap.ErrorCodes)
+	count, errs := snap.Total()
+	assert.Equal(t, int64(3), count)
+	assert.Equal(t, int64(2), errs)
+}
@@ -0,0 +1,645 @@
+package models
+
+import (
+	"context"
+	"math/rand"
+
+	"github.com/pingcap/errors"
+)
+
+// TableSource is the database specific part of Workload, which discovers tables
+// and generates column values of the database.
+type TableSource interface {
+	// FindTables returns names of all tables in schema.
+	FindTables(schema string) ([]string, error)
+
+	// LoadTable loads the structure of a table from database.
+	LoadTable(schema, table string) (*Table, error)
+
+	// MaxID returns the maximum value of an integer column, 0 if the table is empty.
+	MaxID(schema, table, column string) (int64, error)
+
+	// Keys returns keys of all rows in table, rows with NULL in key columns are skipped.
+	Keys(table *Table) ([]interface{}, error)
+
+	// ColumnValue returns the value of column in the row identified by keys, false if there is no such row.
+	ColumnValue(table *Table, column *Column, keys map[string]interface{}) (interface{}, bool, error)
+
+	// IsIntegerColumn checks whether column is of an integer type.
+	IsIntegerColumn(column *Column) bool
+
+	// GenValue generates a random value of column.
+	GenValue(rnd *rand.Rand, column *Column) (interface{}, error)
+}
+
+// tableID identifies a cached table
+type tableID struct {
+	schema string
+	name   string
+}
+
+// Workload generates DMLs of cached tables, and tracks the next id and live keys of
+// every table so that updates and deletes hit existing rows. It implements the table
+// cache part of DB, which is shared by all databases.
+type Workload struct {
+	source         TableSource
+	rnd            *rand.Rand            // random source of generated workload
+	keyDist        KeyDistributionConfig // distribution of keys chosen by update and delete
+	autoIncrement  bool                  // omit auto increment columns in inserts, ids are assigned by database
+	upsertHitRatio float64               // fraction of replaces, upserts and insert-ignores hitting live keys
+	maxRows        int                   // maximum rows changed by a range update or delete
+	schemas        map[string]bool       // schemas of generated workload, empty means all schemas
+
+	entries      []tableID              // table name cache
+	tables       map[tableID]*Table     // table cache
+	cacheColumns map[tableID][]string   // table columns cache: table -> column names list
+	nextIDs      map[tableID]int64      // table next id cache: table -> next primary id
+	choosers     map[tableID]KeyChooser // table key chooser cache: table -> chooser of update and delete keys
+	keySets      map[tableID]*KeySet    // table live key cache: table -> keys of live rows
+}
+
+// NewWorkload creates a Workload of tables in source, rnd is shared with the caller
+// to generate DDLs from the same random sequence.
+func NewWorkload(source TableSource, rnd *rand.Rand, cfg *DBConfig) *Workload {
+	upsertHitRatio := defaultUpsertHitRatio
+	if cfg.UpsertHitRatio != nil {
+		upsertHitRatio = *cfg.UpsertHitRatio
+	}
+	return &Workload{
+		source:         source,
+		rnd:            rnd,
+		keyDist:        cfg.KeyDistribution,
+		autoIncrement:  cfg.AutoIncrement,
+		upsertHitRatio: upsertHitRatio,
+		maxRows:        cfg.MaxRows,
+		entries:        make([]tableID, 0),
+		tables:         make(map[tableID]*Table),
+		cacheColumns:   make(map[tableID][]string),
+		nextIDs:        make(map[tableID]int64),
+		choosers:       make(map[tableID]KeyChooser),
+		keySets:        make(map[tableID]*KeySet),
+	}
+}
+
+// SetSchemas implements `SetSchemas` of DB
+func (w *Workload) SetSchemas(schemas []string) {
+	w.schemas = make(map[string]bool, len(schemas))
+	for _, schema := range schemas {
+		w.schemas[schema] = true
+	}
+}
+
+// activeEntries returns cached tables in schemas of workload
+func (w *Workload) activeEntries() []tableID {
+	if len(w.schemas) == 0 {
+		return w.entries
+	}
+	entries := make([]tableID, 0, len(w.entries))
+	for _, id := range w.entries {
+		if w.schemas[id.schema] {
+			entries = append(entries, id)
+		}
+	}
+	return entries
+}
+
+// TableCount returns the number of cached tables in schemas of workload
+func (w *Workload) TableCount() int {
+	return len(w.activeEntries())
+}
+
+// CachedTable returns the cached table, false if it is not cached
+func (w *Workload) CachedTable(schema, table string) (*Table, bool) {
+	t, ok := w.tables[tableID{schema, table}]
+	return t, ok
+}
+
+// RandomTable chooses a cached table in schemas of workload randomly
+func (w *Workload) RandomTable() (*Table, error) {
+	entries := w.activeEntries()
+	if len(entries) == 0 {
+		return nil, errors.New("no table in table cache")
+	}
+	id := entries[w.rnd.Intn(len(entries))]
+	table, ok := w.tables[id]
+	if !ok {
+		return nil, errors.Errorf("%s.%s not in table cache", id.schema, id.name)
+	}
+	return table, nil
+}
+
+func (w *Workload) clearTableCache(schema, table string) {
+	id := tableID{schema, table}
+	for i := range w.entries {
+		if w.entries[i] == id {
+			w.entries = append(w.entries[:i], w.entries[i+1:]...)
+			break
+		}
+	}
+	delete(w.tables, id)
+	delete(w.cacheColumns, id)
+	delete(w.nextIDs, id)
+	delete(w.choosers, id)
+	delete(w.keySets, id)
+}
+
+func (w *Workload) getNextID(schema, table string) int64 {
+	id := tableID{schema, table}
+	nextID := w.nextIDs[id]
+	w.nextIDs[id] = nextID + 1
+	return nextID
+}
+
+// isCounterKey checks whether key columns are a single integer column, whose
+// values of new rows are assigned from the next id of table
+func (w *Workload) isCounterKey(columns []*Column) bool {
+	return len(columns) == 1 && w.source.IsIntegerColumn(columns[0])
+}
+
+// keySet returns live keys of table, which are loaded from database at the first
+// use, so that DBs only executing jobs never load them.
+func (w *Workload) keySet(table *Table) (*KeySet, error) {
+	id := tableID{table.Schema, table.Name}
+	keys, ok := w.keySets[id]
+	if ok {
+		return keys, nil
+	}
+	values, err := w.source.Keys(table)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	keys = NewKeySet(values)
+	w.keySets[id] = keys
+	return keys, nil
+}
+
+// chooseKey chooses a live key of table by the key distribution, false is returned
+// if there is no live row or the table has no key columns.
+func (w *Workload) chooseKey(table *Table) (Key, bool, error) {
+	keys, err := w.keySet(table)
+	if err != nil {
+		return "", false, errors.Trace(err)
+	}
+	if keys.Len() == 0 {
+		return "", false, nil
+	}
+	id := tableID{table.Schema, table.Name}
+	chooser, ok := w.choosers[id]
+	if !ok {
+		chooser = NewKeyChooser(w.keyDist, w.rnd)
+		w.choosers[id] = chooser
+	}
+	return keys.Choose(chooser).(Key), true, nil
+}
+
+// omittedColumn returns the auto increment column omitted in inserts, nil if columns
+// are not omitted. A column in composite key is never omitted because the key of
+// inserted row is unknown without it.
+func (w *Workload) omittedColumn(table *Table) *Column {
+	if !w.autoIncrement {
+		return nil
+	}
+	column := table.AutoIncrementColumn()
+	if column != nil && table.IsKeyColumn(column) && len(table.KeyColumns()) > 1 {
+		return nil
+	}
+	return column
+}
+
+// TrackInsertID implements `TrackInsertID` of DB
+func (w *Workload) TrackInsertID(schema, table string, id int64) {
+	tid := tableID{schema, table}
+	t, ok := w.tables[tid]
+	if !ok {
+		return
+	}
+	columns := t.KeyColumns()
+	if len(columns) != 1 || columns[0] != t.AutoIncrementColumn() {
+		return
+	}
+	// live keys loaded later contain the row
+	if keys, ok := w.keySets[tid]; ok {
+		keys.Add(EncodeKey([]interface{}{id}))
+	}
+}
+
+// UntrackDML implements `UntrackDML` of DB
+func (w *Workload) UntrackDML(dml *DMLParams) {
+	// ids of rolled back inserts are skipped like ids assigned by database
+	keys, ok := w.keySets[tableID{dml.Schema, dml.Table}]
+	if !ok {
+		return
+	}
+	for _, key := range dml.added {
+		keys.Remove(key)
+	}
+	for _, key := range dml.removed {
+		keys.Add(key)
+	}
+}
+
+// genKey generates values of key columns of a new row and adds the key to live keys.
+// A single integer key column is assigned by the next id of table, other keys are
+// random values, which are regenerated if they conflict with live keys.
+func (w *Workload) genKey(table *Table, columns []*Column) (Key, error) {
+	keys, err := w.keySet(table)
+	if err != nil {
+		return "", errors.Trace(err)
+	}
+	if w.isCounterKey(columns) {
+		key := EncodeKey([]interface{}{w.getNextID(table.Schema, table.Name)})
+		keys.Add(key)
+		return key, nil
+	}
+	var (
+		key    Key
+		values = make([]interface{}, len(columns))
+	)
+	for i := 0; i < MaxKeyRetry; i++ {
+		for idx, column := range columns {
+			values[idx], err = w.source.GenValue(w.rnd, column)
+			if err != nil {
+				return "", errors.Trace(err)
+			}
+		}
+		key = EncodeKey(values)
+		if !keys.Contains(key) {
+			break
+		}
+	}
+	keys.Add(key)
+	return key, nil
+}
+
+// PrepareTables implements `PrepareTables` of DB
+func (w *Workload) PrepareTables(ctx context.Context, schema string) ([]*Table, [][]string, error) {
+	names, err := w.source.FindTables(schema)
+	if err != nil {
+		return nil, nil, errors.Trace(err)
+	}
+	var (
+		tables      = make([]*Table, 0, len(names))
+		columnNames = make([][]string, 0, len(names))
+	)
+	for _, name := range names {
+		t, columnName, err := w.GetTable(ctx, schema, name)
+		if err != nil {
+			return nil, nil, errors.Trace(err)
+		}
+		tables = append(tables, t)
+		columnNames = append(columnNames, columnName)
+	}
+	return tables, columnNames, nil
+}
+
+// GetTable implements `GetTable` of DB
+func (w *Workload) GetTable(_ context.Context, schema, table string) (*Table, []string, error) {
+	id := tableID{schema, table}
+
+	value, ok := w.tables[id]
+	if ok {
+		return value, w.cacheColumns[id], nil
+	}
+
+	t, err := w.source.LoadTable(schema, table)
+	if err != nil {
+		return nil, nil, errors.Trace(err)
+	}
+
+	// compute cache column list for column mapping
+	columns := make([]string, 0, len(t.Columns))
+	for _, c := range t.Columns {
+		columns = append(columns, c.Name)
+	}
+
+	nextID := int64(1)
+	if keyColumns := t.KeyColumns(); w.isCounterKey(keyColumns) {
+		maxID, err := w.source.MaxID(schema, table, keyColumns[0].Name)
+		if err != nil {
+			return nil, nil, errors.Trace(err)
+		}
+		nextID = maxID + 1
+	}
+
+	w.entries = append(w.entries, id)
+	w.tables[id] = t
+	w.cacheColumns[id] = columns
+	w.nextIDs[id] = nextID
+	return t, columns, nil
+}
+
+// RefreshTableCache implements `RefreshTableCache` of DB
+func (w *Workload) RefreshTableCache(ctx context.Context, ddl *DDLParams) error {
+	switch ddl.Type {
+	case AddColumn, DropColumn, CreateIndex, DropIndex, ModifyColumn, ChangeColumn:
+		return errors.Trace(w.reloadTable(ctx, ddl.Schema, ddl.Table))
+	case CreateTable:
+		_, _, err := w.GetTable(ctx, ddl.Schema, ddl.Table)
+		return errors.Trace(err)
+	case DropTable:
+		w.clearTableCache(ddl.Schema, ddl.Table)
+	case TruncateTable:
+		// next id restarts from 1 after the table is reloaded
+		w.clearTableCache(ddl.Schema, ddl.Table)
+		_, _, err := w.GetTable(ctx, ddl.Schema, ddl.Table)
+		return errors.Trace(err)
+	case RenameTable:
+		oldID := tableID{ddl.Schema, ddl.Table}
+		nextID, keys := w.nextIDs[oldID], w.keySets[oldID]
+		w.clearTableCache(ddl.Schema, ddl.Table)
+		_, _, err := w.GetTable(ctx, ddl.Schema, ddl.NewTable)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		id := tableID{ddl.Schema, ddl.NewTable}
+		if w.nextIDs[id] < nextID {
+			w.nextIDs[id] = nextID
+		}
+		if keys != nil {
+			w.keySets[id] = keys
+		}
+	}
+	return nil
+}
+
+// reloadTable reloads table structure from database if the table is cached,
+// the next id and live keys are kept because some generated inserts and
+// deletes may not be executed yet.
+func (w *Workload) reloadTable(ctx context.Context, schema, table string) error {
+	id := tableID{schema, table}
+	old, ok := w.tables[id]
+	if !ok {
+		return nil
+	}
+	nextID, keys := w.nextIDs[id], w.keySets[id]
+	w.clearTableCache(schema, table)
+	t, _, err := w.GetTable(ctx, schema, table)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if w.nextIDs[id] < nextID {
+		w.nextIDs[id] = nextID
+	}
+	// live keys are reloaded if the table is identified by other columns now
+	if keys != nil && SameKeyColumns(old, t) {
+		w.keySets[id] = keys
+	}
+	return nil
+}
+
+// GenerateDML implements `GenerateDML` of DB
+func (w *Workload) GenerateDML(_ context.Context, opType OpType) (*DMLParams, error) {
+	table, err := w.RandomTable()
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	var params *DMLParams
+	switch opType {
+	case Insert:
+		params, err = w.genInsertSQL(table)
+	case Update:
+		params, err = w.genUpdateSQL(table)
+	case Delete:
+		params, err = w.genDeleteSQL(table)
+	case Replace, Upsert, InsertIgnore:
+		params, err = w.genUpsertSQL(table, opType)
+	case RangeUpdate, RangeDelete:
+		params, err = w.genRangeSQL(table, opType)
+	default:
+		return nil, errors.NotValidf("DML OpType: %d", opType)
+	}
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	return params, nil
+}
+
+func (w *Workload) genInsertSQL(table *Table) (*DMLParams, error) {
+	var (
+		keys    map[string]interface{}
+		added   []Key
+		columns = table.KeyColumns()
+		omitted = w.omittedColumn(table)
+	)
+	// rows of tables without key columns are not tracked, keys of rows whose
+	// auto increment key is omitted are tracked after they are inserted.
+	if len(columns) > 0 && (omitted == nil || !table.IsKeyColumn(omitted)) {
+		key, err := w.genKey(table, columns)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		keys, added = KeyValues(columns, key), []Key{key}
+	}
+	values, err := w.genRowValues(table, keys, omitted)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	params := &DMLParams{
+		Type:   Insert,
+		Schema: table.Schema,
+		Table:  table.Name,
+		Keys:   keys,
+		Values: values,
+		added:  added,
+	}
+	return params, nil
+}
+
+// genRowValues generates values of all columns of a row with keys, except the omitted column
+func (w *Workload) genRowValues(table *Table, keys map[string]interface{}, omitted *Column) (map[string]interface{}, error) {
+	var err error
+	values := make(map[string]interface{}, len(table.Columns))
+	for name, value := range keys {
+		values[name] = value
+	}
+	for _, column := range table.Columns {
+		if _, ok := values[column.Name]; ok || column == omitted {
+			continue
+		}
+		values[column.Name], err = w.source.GenValue(w.rnd, column)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+	}
+	return values, nil
+}
+
+// genUpsertSQL generates a replace, upsert or insert-ignore of a full row, whose key
+// is a live key by upsert-hit-ratio so that the statement hits an existing row.
+func (w *Workload) genUpsertSQL(table *Table, tp OpType) (*DMLParams, error) {
+	var (
+		keys    map[string]interface{}
+		added   []Key
+		columns = table.KeyColumns()
+	)
+	// statements of tables without key columns never hit existing rows
+	if len(columns) == 0 {
+		return w.genInsertSQL(table)
+	}
+	if w.rnd.Float64() < w.upsertHitRatio {
+		key, ok, err := w.chooseKey(table)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		if ok {
+			keys = KeyValues(columns, key)
+		}
+	}
+	if keys == nil {
+		key, err := w.genKey(table, columns)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		keys, added = KeyValues(columns, key), []Key{key}
+	}
+	// keys are always explicit, so the auto increment column is never omitted
+	values, err := w.genRowValues(table, keys, nil)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	params := &DMLParams{
+		Type:   tp,
+		Schema: table.Schema,
+		Table:  table.Name,
+		Keys:   keys,
+		Values: values,
+		added:  added,
+	}
+	return params, nil
+}
+
+func (w *Workload) genUpdateSQL(table *Table) (*DMLParams, error) {
+	key, ok, err := w.chooseKey(table)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	// tables without live rows or key columns only receive inserts
+	if !ok {
+		return w.genInsertSQL(table)
+	}
+	keys := KeyValues(table.KeyColumns(), key)
+	values, err := w.genUpdateValues(table)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	params := &DMLParams{
+		Type:   Update,
+		Schema: table.Schema,
+		Table:  table.Name,
+		Keys:   keys,
+		Values: values,
+	}
+	return params, nil
+}
+
+// genRangeSQL generates a range update or delete of at most max-rows rows from a live row.
+// Rows are chosen by `key BETWEEN a AND b` if the key is a single integer column, otherwise
+// by `column = v LIMIT n` of an indexed column, whose value is read from the live row.
+// The live row is changed alone if there is neither.
+func (w *Workload) genRangeSQL(table *Table, tp OpType) (*DMLParams, error) {
+	key, ok, err := w.chooseKey(table)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	// tables without live rows or key columns only receive inserts
+	if !ok {
+		return w.genInsertSQL(table)
+	}
+	var (
+		rng     *RangeParams
+		columns = table.KeyColumns()
+		keys    = KeyValues(columns, key)
+		n       = 1 + w.rnd.Intn(w.maxRows)
+	)
+	begin, isInt := key.Values()[0].(int64)
+	if column := table.IndexedColumn(); w.isCounterKey(columns) && isInt {
+		// ids after the last generated one may be assigned to later inserts
+		end := begin + int64(n-1)
+		if last := w.nextIDs[tableID{table.Schema, table.Name}] - 1; end > last {
+			end = last
+		}
+		if end < begin {
+			end = begin
+		}
+		rng = &RangeParams{Column: columns[0].Name, Begin: begin, End: end}
+	} else if column != nil {
+		// the row may not be executed yet
+		value, found, err := w.source.ColumnValue(table, column, keys)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		if found {
+			rng = &RangeParams{Column: column.Name, Begin: value, Limit: n}
+		}
+	}
+
+	params := &DMLParams{
+		Type:   tp,
+		Schema: table.Schema,
+		Table:  table.Name,
+		Range:  rng,
+	}
+	if rng == nil {
+		params.Keys = keys
+	}
+	if tp == RangeUpdate {
+		if rng == nil {
+			params.Type = Update
+		}
+		params.Values, err = w.genUpdateValues(table)
+		return params, errors.Trace(err)
+	}
+
+	// keys of rows deleted by an indexed column are unknown, they are left in live
+	// keys and later statements of them change nothing.
+	liveKeys := w.keySets[tableID{table.Schema, table.Name}]
+	switch {
+	case rng == nil:
+		params.Type = Delete
+		liveKeys.Remove(key)
+		params.removed = []Key{key}
+	case rng.End != nil:
+		for id := begin; id <= rng.End.(int64); id++ {
+			if k := EncodeKey([]interface{}{id}); liveKeys.Remove(k) {
+				params.removed = append(params.removed, k)
+			}
+		}
+	}
+	return params, nil
+}
+
+// genUpdateValues generates a new value of a random updatable column
+func (w *Workload) genUpdateValues(table *Table) (map[string]interface{}, error) {
+	columns := table.UpdatableColumns()
+	if len(columns) == 0 {
+		return nil, errors.NotFoundf("updatable column in %s.%s", table.Schema, table.Name)
+	}
+	column := columns[w.rnd.Intn(len(columns))]
+	value, err := w.source.GenValue(w.rnd, column)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	return map[string]interface{}{column.Name: value}, nil
+}
+
+func (w *Workload) genDeleteSQL(table *Table) (*DMLParams, error) {
+	key, ok, err := w.chooseKey(table)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	// tables without live rows or key columns only receive inserts
+	if !ok {
+		return w.genInsertSQL(table)
+	}
+	w.keySets[tableID{table.Schema, table.Name}].Remove(key)
+	keys := KeyValues(table.KeyColumns(), key)
+	params := &DMLParams{
+		Type:    Delete,
+		Schema:  table.Schema,
+		Table:   table.Name,
+		Keys:    keys,
+		removed: []Key{key},
+	}
+	return params, nil
+}
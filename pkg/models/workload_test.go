@@ -0,0 +1,266 @@
+package models
+
+import (
+	"context"
+	"math/rand"
+	"testing"
+
+	"github.com/pingcap/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeSource is a TableSource of tables in memory, whose rows have ids from 1 to maxIDs
+type fakeSource struct {
+	tables map[string]*Table
+	maxIDs map[string]int64
+}
+
+func (s *fakeSource) FindTables(schema string) ([]string, error) {
+	names := make([]string, 0, len(s.tables))
+	for name, t := range s.tables {
+		if t.Schema == schema {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+func (s *fakeSource) LoadTable(schema, table string) (*Table, error) {
+	t, ok := s.tables[table]
+	if !ok || t.Schema != schema {
+		return nil, errors.NotFoundf("table %s.%s", schema, table)
+	}
+	return t, nil
+}
+
+func (s *fakeSource) MaxID(_, table, _ string) (int64, error) {
+	return s.maxIDs[table], nil
+}
+
+func (s *fakeSource) Keys(table *Table) ([]interface{}, error) {
+	keys := make([]interface{}, 0, s.maxIDs[table.Name])
+	for id := int64(1); id <= s.maxIDs[table.Name]; id++ {
+		keys = append(keys, EncodeKey([]interface{}{id}))
+	}
+	return keys, nil
+}
+
+func (s *fakeSource) ColumnValue(_ *Table, _ *Column, _ map[string]interface{}) (interface{}, bool, error) {
+	return "v", true, nil
+}
+
+func (s *fakeSource) IsIntegerColumn(column *Column) bool {
+	return column.Tp == "int"
+}
+
+func (s *fakeSource) GenValue(rnd *rand.Rand, column *Column) (interface{}, error) {
+	if column.Tp == "int" {
+		return rnd.Int63(), nil
+	}
+	return "v", nil
+}
+
+// newFakeTable creates a table with an integer primary key `id` and string columns
+func newFakeTable(name string, columns ...string) *Table {
+	id := &Column{Name: "id", Tp: "int", Key: "PRI", NotNull: true}
+	t := &Table{
+		Schema:                "s",
+		Name:                  name,
+		Columns:               []*Column{id},
+		IndexColumns:          map[string][]*Column{"primary": {id}},
+		NonUniqueIndexColumns: map[string][]*Column{},
+	}
+	for idx, column := range columns {
+		t.Columns = append(t.Columns, &Column{Idx: idx + 1, Name: column, Tp: "varchar"})
+	}
+	return t
+}
+
+func newFakeWorkload(t *testing.T, source *fakeSource, upsertHitRatio float64) *Workload {
+	cfg := &DBConfig{KeyDistribution: KeyDistributionConfig{Type: KeyUniform}, UpsertHitRatio: &upsertHitRatio, MaxRows: 10}
+	w := NewWorkload(source, rand.New(rand.NewSource(1)), cfg)
+	_, _, err := w.PrepareTables(context.Background(), "s")
+	require.NoError(t, err)
+	return w
+}
+
+func TestWorkloadKeyTracking(t *testing.T) {
+	source := &fakeSource{
+		tables: map[string]*Table{"t": newFakeTable("t", "c")},
+		maxIDs: map[string]int64{"t": 3},
+	}
+	w := newFakeWorkload(t, source, 0.5)
+	ctx := context.Background()
+
+	// ids of inserts continue from the max id in database
+	params, err := w.GenerateDML(ctx, Insert)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"id": int64(4)}, params.Keys)
+	assert.Equal(t, 2, len(params.Values))
+
+	// deletes remove live keys, which are never chosen again
+	deleted := make(map[int64]bool)
+	for i := 0; i < 4; i++ {
+		params, err = w.GenerateDML(ctx, Delete)
+		require.NoError(t, err)
+		require.Equal(t, Delete, params.Type)
+		id := params.Keys["id"].(int64)
+		assert.False(t, deleted[id])
+		deleted[id] = true
+	}
+
+	// updates fall back to inserts if there is no live row
+	params, err = w.GenerateDML(ctx, Update)
+	require.NoError(t, err)
+	assert.Equal(t, Insert, params.Type)
+	assert.Equal(t, int64(5), params.Keys["id"])
+
+	// ranges never exceed the last generated id
+	params, err = w.GenerateDML(ctx, RangeDelete)
+	require.NoError(t, err)
+	assert.Equal(t, &RangeParams{Column: "id", Begin: int64(5), End: int64(5)}, params.Range)
+	assert.Equal(t, 0, w.keySets[tableID{"s", "t"}].Len())
+
+	_, err = w.GenerateDML(ctx, Flush)
+	assert.Error(t, err)
+}
+
+func TestWorkloadUntrackDML(t *testing.T) {
+	source := &fakeSource{
+		tables: map[string]*Table{"t": newFakeTable("t", "c")},
+		maxIDs: map[string]int64{"t": 3},
+	}
+	w := newFakeWorkload(t, source, 0)
+	ctx := context.Background()
+	keys := func() int {
+		return w.keySets[tableID{"s", "t"}].Len()
+	}
+
+	// the id of a rolled back insert is skipped
+	params, err := w.GenerateDML(ctx, Insert)
+	require.NoError(t, err)
+	assert.Equal(t, 4, keys())
+	w.UntrackDML(params)
+	assert.Equal(t, 3, keys())
+	params, err = w.GenerateDML(ctx, Insert)
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), params.Keys["id"])
+
+	// keys of rolled back deletes are live again
+	for _, tp := range []OpType{Delete, RangeDelete, Replace} {
+		params, err = w.GenerateDML(ctx, tp)
+		require.NoError(t, err)
+		w.UntrackDML(params)
+		assert.Equal(t, 4, keys(), "%s", tp)
+	}
+
+	// statements replayed from files change nothing
+	w.UntrackDML(&DMLParams{Type: Delete, Schema: "s", Table: "t", Keys: map[string]interface{}{"id": int64(1)}})
+	assert.Equal(t, 4, keys())
+}
+
+func TestWorkloadUpsertHitRatio(t *testing.T) {
+	ctx := context.Background()
+	for _, ratio := range []float64{0, 1} {
+		source := &fakeSource{
+			tables: map[string]*Table{"t": newFakeTable("t", "c")},
+			maxIDs: map[string]int64{"t": 3},
+		}
+		w := newFakeWorkload(t, source, ratio)
+		for i := 0; i < 10; i++ {
+			params, err := w.GenerateDML(ctx, Upsert)
+			require.NoError(t, err)
+			hit := params.Keys["id"].(int64) <= 3
+			assert.Equal(t, ratio == 1, hit, "ratio %v, keys %v", ratio, params.Keys)
+		}
+	}
+}
+
+func TestWorkloadReloadTable(t *testing.T) {
+	source := &fakeSource{
+		tables: map[string]*Table{"t": newFakeTable("t", "c")},
+		maxIDs: map[string]int64{"t": 3},
+	}
+	w := newFakeWorkload(t, source, 0.5)
+	ctx := context.Background()
+	for i := 0; i < 2; i++ {
+		_, err := w.GenerateDML(ctx, Insert)
+		require.NoError(t, err)
+	}
+
+	// inserts generated before ADD COLUMN may not be executed yet, the next id
+	// and live keys are kept instead of being reloaded from database
+	source.tables["t"] = newFakeTable("t", "c", "c2")
+	require.NoError(t, w.RefreshTableCache(ctx, &DDLParams{Type: AddColumn, Schema: "s", Table: "t"}))
+	table, columns, err := w.GetTable(ctx, "s", "t")
+	require.NoError(t, err)
+	assert.Equal(t, source.tables["t"], table)
+	assert.Equal(t, []string{"id", "c", "c2"}, columns)
+	params, err := w.GenerateDML(ctx, Insert)
+	require.NoError(t, err)
+	assert.Equal(t, int64(6), params.Keys["id"])
+	assert.Contains(t, params.Values, "c2")
+	assert.Equal(t, 6, w.keySets[tableID{"s", "t"}].Len())
+
+	source.tables["t"] = newFakeTable("t", "c2")
+	require.NoError(t, w.RefreshTableCache(ctx, &DDLParams{Type: DropColumn, Schema: "s", Table: "t"}))
+	params, err = w.GenerateDML(ctx, Update)
+	require.NoError(t, err)
+	assert.Equal(t, Update, params.Type)
+	assert.Contains(t, params.Values, "c2")
+	assert.Equal(t, 6, w.keySets[tableID{"s", "t"}].Len())
+}
+
+func TestWorkloadTableLifecycle(t *testing.T) {
+	source := &fakeSource{
+		tables: map[string]*Table{"t": newFakeTable("t", "c")},
+		maxIDs: map[string]int64{"t": 3},
+	}
+	w := newFakeWorkload(t, source, 0.5)
+	ctx := context.Background()
+	for i := 0; i < 2; i++ {
+		_, err := w.GenerateDML(ctx, Insert)
+		require.NoError(t, err)
+	}
+
+	// the next id and live keys move to the new name, generated inserts may not be executed yet
+	delete(source.tables, "t")
+	delete(source.maxIDs, "t")
+	source.tables["t2"] = newFakeTable("t2", "c")
+	source.maxIDs["t2"] = 3
+	require.NoError(t, w.RefreshTableCache(ctx, &DDLParams{Type: RenameTable, Schema: "s", Table: "t", NewTable: "t2"}))
+	_, ok := w.CachedTable("s", "t")
+	assert.False(t, ok)
+	assert.Equal(t, 1, w.TableCount())
+	assert.Equal(t, int64(6), w.nextIDs[tableID{"s", "t2"}])
+	assert.Equal(t, 5, w.keySets[tableID{"s", "t2"}].Len())
+
+	// truncate clears live keys and restarts ids
+	source.maxIDs["t2"] = 0
+	require.NoError(t, w.RefreshTableCache(ctx, &DDLParams{Type: TruncateTable, Schema: "s", Table: "t2"}))
+	params, err := w.GenerateDML(ctx, Update)
+	require.NoError(t, err)
+	assert.Equal(t, Insert, params.Type)
+	assert.Equal(t, "t2", params.Table)
+	assert.Equal(t, int64(1), params.Keys["id"])
+	assert.Equal(t, 1, w.keySets[tableID{"s", "t2"}].Len())
+
+	source.tables["u"] = newFakeTable("u", "c")
+	require.NoError(t, w.RefreshTableCache(ctx, &DDLParams{Type: CreateTable, Schema: "s", Table: "u"}))
+	assert.Equal(t, 2, w.TableCount())
+	_, ok = w.CachedTable("s", "u")
+	assert.True(t, ok)
+
+	// dml is never generated for a dropped table
+	delete(source.tables, "t2")
+	delete(source.maxIDs, "t2")
+	require.NoError(t, w.RefreshTableCache(ctx, &DDLParams{Type: DropTable, Schema: "s", Table: "t2"}))
+	assert.Equal(t, 1, w.TableCount())
+	assert.NotContains(t, w.keySets, tableID{"s", "t2"})
+	for i := 0; i < 5; i++ {
+		params, err = w.GenerateDML(ctx, Insert)
+		require.NoError(t, err)
+		assert.Equal(t, "u", params.Table)
+	}
+}
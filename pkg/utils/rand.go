@@ -0,0 +1,43 @@
+package utils
+
+import (
+	"math/rand"
+	"time"
+	"unsafe"
+)
+
+const (
+	letterBytes   = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
+	letterIdxBits = 6                    // 6 bits to represent a letter index
+	letterIdxMask = 1<<letterIdxBits - 1 // All 1-bits, as many as letterIdxBits
+	letterIdxMax  = 63 / letterIdxBits   // # of letter indices fitting in 63 bits
+)
+
+// RandomTime generates a random time between 1970-01-01 and 2037-12-31
+func RandomTime(rnd *rand.Rand) time.Time {
+	min := time.Date(1970, 1, 1, 0, 0, 0, 0, time.UTC).Unix()
+	max := time.Date(2037, 12, 31, 0, 0, 0, 0, time.UTC).Unix()
+	delta := max - min
+	sec := rnd.Int63n(delta) + min
+	return time.Unix(sec, 0).UTC()
+}
+
+// RandomString generates a random string with n letters
+// https://stackoverflow.com/a/31832326/1115857
+func RandomString(rnd *rand.Rand, n int) string {
+	b := make([]byte, n)
+	// A src.Int63() generates 63 random bits, enough for letterIdxMax characters!
+	for i, cache, remain := n-1, rnd.Int63(), letterIdxMax; i >= 0; {
+		if remain == 0 {
+			cache, remain = rnd.Int63(), letterIdxMax
+		}
+		if idx := int(cache & letterIdxMask); idx < len(letterBytes) {
+			b[i] = letterBytes[idx]
+			i--
+		}
+		cache >>= letterIdxBits
+		remain--
+	}
+
+	return *(*string)(unsafe.Pointer(&b))
+}
@@ -0,0 +1,18 @@
+package utils
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRandomTime(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	for i := 0; i < 100; i++ {
+		tm := RandomTime(rnd)
+		assert.Equal(t, time.UTC, tm.Location())
+		assert.True(t, tm.Year() >= 1970 && tm.Year() <= 2037, tm.String())
+	}
+}